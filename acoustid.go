@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rubiojr/rplay/internal/acoustid"
+	"github.com/rubiojr/rplay/internal/audioinfo"
+	"github.com/rubiojr/rplay/internal/fps"
+)
+
+var acoustIDKey string
+var acoustIDURL string
+var acoustIDClient *acoustid.Client
+
+// minConfidence is the lowest confidence of the AcoustID matches used.
+var minConfidence = -1.0
+
+// setupAcoustID configures the AcoustID web service from the command line,
+// the environment or the [acoustid] section of the configuration file.
+func setupAcoustID() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	s := cfg.Section("acoustid")
+
+	if acoustIDKey == "" {
+		acoustIDKey = s.Key("api_key").String()
+	}
+	if acoustIDURL == "" {
+		acoustIDURL = s.Key("url").MustString(acoustid.DefaultBaseURL)
+	}
+	acoustIDClient = acoustid.NewClient(acoustIDKey)
+	acoustIDClient.BaseURL = strings.TrimSuffix(acoustIDURL, "/")
+	acoustIDClient.Timeout = s.Key("timeout").MustDuration(acoustIDClient.Timeout)
+	acoustIDClient.MaxRetries = s.Key("retries").MustInt(acoustIDClient.MaxRetries)
+	if minConfidence < 0 {
+		minConfidence = s.Key("min_confidence").MustFloat64(fps.DefaultMinConfidence)
+	}
+
+	return nil
+}
+
+// fingerprintFile calculates the AcoustID fingerprint of a song, decoding
+// it with the player's decoders. fpcalc is used, if installed, for other
+// formats.
+func fingerprintFile(path string) (acoustid.Fingerprint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return acoustid.Fingerprint{}, err
+	}
+	defer f.Close()
+
+	mime, r, err := sniffAudioType(f)
+	if err != nil {
+		return acoustid.Fingerprint{}, err
+	}
+	rate, pcm, err := readerFromAudioType(mime, r)
+	if err != nil {
+		fp, ferr := acoustid.NewFingerprint(path)
+		if errors.Is(ferr, acoustid.ErrFPCALCNotFound) {
+			return fp, err
+		}
+		return fp, ferr
+	}
+
+	// the decoders return stereo audio
+	return acoustid.NewFingerprintFromPCM(pcm, rate, 2, fileDuration(f))
+}
+
+// fileDuration returns the duration of a song in seconds, 0 if unknown.
+func fileDuration(f *os.File) int {
+	st, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	read := func(off, n int64) ([]byte, error) {
+		if off < 0 {
+			n += off
+			off = 0
+		}
+		b := make([]byte, n)
+		l, err := f.ReadAt(b, off)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return b[:l], nil
+	}
+
+	head, err := read(0, 1024*1024)
+	if err != nil {
+		return 0
+	}
+	info, err := audioinfo.Read(head, st.Size(), func() ([]byte, error) {
+		return read(st.Size()-64*1024, 64*1024)
+	})
+	if err != nil {
+		return 0
+	}
+	return int(info.Duration.Seconds())
+}
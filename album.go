@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// albumSongs returns the IDs of the songs in album, in disc and track order.
+// artist picks the album when several artists have one with that name.
+func albumSongs(album, artist string) ([]string, error) {
+	q := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(album)
+	docs, err := searchDocuments(fmt.Sprintf(`album:"%s"`, q))
+	if err != nil {
+		return nil, err
+	}
+
+	tracks, err := albumTracks(docs, album, artist)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, d := range tracks {
+		ids = append(ids, d.id)
+	}
+	return ids, nil
+}
+
+// albumTracks returns the songs of an album found by a search, sorted.
+func albumTracks(docs []*storedDocument, album, artist string) ([]*storedDocument, error) {
+	// the phrase query also matches albums containing the name
+	groups := map[string][]*storedDocument{}
+	keys := []string{}
+	for _, d := range docs {
+		if d.text("repository_id") != repoID || !strings.EqualFold(d.text("album"), album) || !playable(d.text("codec"), d.text("filename")) {
+			continue
+		}
+		key := albumKey(d)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], d)
+	}
+
+	names := []string{}
+	var tracks []*storedDocument
+	for _, key := range keys {
+		if artist != "" && !hasArtist(groups[key], artist) {
+			continue
+		}
+		names = append(names, albumName(groups[key]))
+		tracks = groups[key]
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("album %s not found", album)
+	}
+	if len(names) > 1 {
+		sort.Strings(names)
+		return nil, fmt.Errorf("several artists have an album named %s (%s), pick one with --artist", album, strings.Join(names, ", "))
+	}
+	sortTracks(tracks)
+	return tracks, nil
+}
+
+// albumKey identifies the album of a song, empty if it has none. Songs
+// without an album artist, like compilations often are, are grouped by
+// directory instead of by the artist of each song.
+func albumKey(d *storedDocument) string {
+	album := d.text("album")
+	if album == "" {
+		return ""
+	}
+	if a := d.text("album_artist"); a != "" {
+		return strings.ToLower(a) + "\x00" + strings.ToLower(album)
+	}
+	return albumDir(d.text("path")) + "\x00\x00" + strings.ToLower(album)
+}
+
+var discDirRe = regexp.MustCompile(`(?i)^(cd|dis[ck])[ _-]*\d+$`)
+
+// albumDir returns the directory of an album song, the parent of disc
+// directories like CD1.
+func albumDir(p string) string {
+	dir := path.Dir(p)
+	if discDirRe.MatchString(path.Base(dir)) {
+		dir = path.Dir(dir)
+	}
+	return dir
+}
+
+// albumName returns the artist of an album, Various Artists if its songs
+// have no album artist and several artists.
+func albumName(tracks []*storedDocument) string {
+	if a := tracks[0].text("album_artist"); a != "" {
+		return a
+	}
+	name := tracks[0].text("artist")
+	for _, d := range tracks[1:] {
+		if !strings.EqualFold(d.text("artist"), name) {
+			return "Various Artists in " + albumDir(d.text("path"))
+		}
+	}
+	return name
+}
+
+// hasArtist is true if artist is the album artist, or the artist of any
+// of its songs when there's no album artist.
+func hasArtist(tracks []*storedDocument, artist string) bool {
+	for _, d := range tracks {
+		a := d.text("album_artist")
+		if a == "" {
+			a = d.text("artist")
+		}
+		if strings.EqualFold(a, artist) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortTracks sorts album songs by disc and track number, songs without
+// them by filename.
+func sortTracks(docs []*storedDocument) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, b := docs[i], docs[j]
+		for _, f := range []string{"disc", "track"} {
+			x, _ := a.number(f)
+			y, _ := b.number(f)
+			if x != y {
+				return x < y
+			}
+		}
+		return a.text("filename") < b.text("filename")
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestSortTracks(t *testing.T) {
+	song := func(id string, disc, track float64) *storedDocument {
+		d := &storedDocument{id: id, fields: map[string][][]byte{}}
+		d.setText("filename", id+".mp3")
+		d.setNumber("disc", disc)
+		d.setNumber("track", track)
+		return d
+	}
+	docs := []*storedDocument{
+		song("d2t1", 2, 1),
+		song("d1t10", 1, 10),
+		song("d1t2", 1, 2),
+		song("b", 0, 0),
+		song("a", 0, 0),
+	}
+
+	sortTracks(docs)
+
+	want := []string{"a", "b", "d1t2", "d1t10", "d2t1"}
+	for i, d := range docs {
+		if d.id != want[i] {
+			t.Errorf("expected %s at position %d, got %s", want[i], i, d.id)
+		}
+	}
+}
+
+func TestPlayable(t *testing.T) {
+	tests := []struct {
+		codec, filename string
+		want            bool
+	}{
+		{"mp3", "song.mp3", true},
+		{"vorbis", "song.ogg", true},
+		{"opus", "song.ogg", false},
+		{"flac", "SONG.FLAC", true},
+		{"", "song.MP3", true},
+		{"", "song.m4a", false},
+		{"", "song.wav", false},
+	}
+	for _, tt := range tests {
+		if got := playable(tt.codec, tt.filename); got != tt.want {
+			t.Errorf("%s %s: expected %t, got %t", tt.codec, tt.filename, tt.want, got)
+		}
+	}
+}
+
+func TestAlbumTracks(t *testing.T) {
+	defer func(id string) { repoID = id }(repoID)
+	repoID = "repo"
+	song := func(id, album, albumArtist, artist string, track float64) *storedDocument {
+		d := &storedDocument{id: id, fields: map[string][][]byte{}}
+		d.setText("repository_id", "repo")
+		d.setText("filename", id+".mp3")
+		d.setText("album", album)
+		d.setText("album_artist", albumArtist)
+		d.setText("artist", artist)
+		d.setNumber("track", track)
+		return d
+	}
+	docs := []*storedDocument{
+		song("q2", "Greatest Hits", "", "Queen", 2),
+		song("q1", "Greatest Hits", "", "Queen", 1),
+		song("a1", "Greatest Hits", "ABBA", "Agnetha", 1),
+		song("a2", "Greatest Hits", "ABBA", "Frida", 2),
+		song("other", "Greatest Hits Live", "", "Queen", 1),
+	}
+
+	if _, err := albumTracks(docs, "greatest hits", ""); err == nil {
+		t.Error("expected an error for albums by several artists")
+	}
+	tracks, err := albumTracks(docs, "greatest hits", "queen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 || tracks[0].id != "q1" || tracks[1].id != "q2" {
+		t.Errorf("unexpected tracks %v", tracks)
+	}
+	if tracks, _ := albumTracks(docs[2:], "Greatest Hits", ""); len(tracks) != 2 {
+		t.Errorf("songs with the same album artist should be in the album, got %d", len(tracks))
+	}
+	if albumKey(docs[0]) == albumKey(docs[2]) || albumKey(docs[2]) != albumKey(docs[3]) {
+		t.Error("albums should be grouped by album artist")
+	}
+
+	// compilations without an album artist are grouped by directory
+	compilation := []*storedDocument{
+		song("c1", "Now 50", "", "Blur", 1),
+		song("c2", "Now 50", "", "Oasis", 2),
+		song("c3", "Now 50", "", "Pulp", 1),
+		song("other", "Now 50", "", "Suede", 1),
+	}
+	compilation[0].setText("path", "/music/Now 50/CD1/01.mp3")
+	compilation[1].setText("path", "/music/Now 50/CD1/02.mp3")
+	compilation[2].setText("path", "/music/Now 50/CD2/01.mp3")
+	compilation[2].setNumber("disc", 2)
+	compilation[3].setText("path", "/music/Suede/Now 50/01.mp3")
+	if _, err := albumTracks(compilation, "Now 50", ""); err == nil {
+		t.Error("expected an error for albums in several directories")
+	}
+	tracks, err = albumTracks(compilation, "Now 50", "oasis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 3 || tracks[0].id != "c1" || tracks[2].id != "c3" {
+		t.Errorf("expected the whole compilation, got %v", tracks)
+	}
+	if albumKey(compilation[0]) != albumKey(compilation[2]) {
+		t.Error("discs of a compilation should be in the same album")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// analysisFields are the song fields set by rplay analyze.
+var analysisFields = append([]string{fieldLoudness, fieldAlbumLoudness}, replayGainFields...)
+
+// analysisStore keeps the loudness measured with rplay analyze, keyed by
+// song ID, so it's applied again when songs are indexed instead of
+// measuring them again.
+type analysisStore struct {
+	db *leveldb.DB
+}
+
+func analysisPath() string {
+	return filepath.Join(filepath.Dir(indexPath), "analysis")
+}
+
+func openAnalysis() (*analysisStore, error) {
+	db, err := leveldb.OpenFile(analysisPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &analysisStore{db: db}, nil
+}
+
+func (s *analysisStore) close() error {
+	return s.db.Close()
+}
+
+// set replaces the values measured for a song.
+func (s *analysisStore) set(songID string, values map[string]float64) error {
+	v, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return s.db.Put([]byte(songID), v, nil)
+}
+
+// all returns the values measured for every song, by song ID.
+func (s *analysisStore) all() (map[string]map[string]float64, error) {
+	all := map[string]map[string]float64{}
+	iter := s.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		values := map[string]float64{}
+		if err := json.Unmarshal(iter.Value(), &values); err != nil {
+			return nil, err
+		}
+		all[string(iter.Key())] = values
+	}
+	return all, iter.Error()
+}
+
+// saveAnalysis stores the values measured for songs.
+func saveAnalysis(docs []*storedDocument) error {
+	s, err := openAnalysis()
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	for _, d := range docs {
+		values := map[string]float64{}
+		for _, field := range analysisFields {
+			if v, ok := d.number(field); ok {
+				values[field] = v
+			}
+		}
+		if err := s.set(d.id, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAnalysis returns the values measured for every song, by song ID.
+func loadAnalysis() (map[string]map[string]float64, error) {
+	s, err := openAnalysis()
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	return s.all()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalysisKeptWhenReindexing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(p string) { indexPath = p }(indexPath)
+	indexPath = filepath.Join(dir, "rplay.bluge")
+
+	d := &storedDocument{id: "song", fields: map[string][][]byte{}}
+	d.setText("title", "Intro")
+	d.setNumber(fieldTrackGain, -4.5)
+	d.setNumber(fieldTrackPeak, 0.9)
+	d.setNumber(fieldLoudness, -13.5)
+	if err := saveAnalysis([]*storedDocument{d}); err != nil {
+		t.Fatal(err)
+	}
+	analysis, err := loadAnalysis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis["song"]) != 3 {
+		t.Fatalf("unexpected values stored %v", analysis)
+	}
+
+	blobs, _ := fakeBlobs(id3v2Tag("Intro", 100), 1000)
+	b := MP3DocumentBuilder{analysis: analysis}
+	rebuilt := storedFields(b.buildDocument("song", "/music/intro.mp3", blobs))
+	for _, field := range []string{fieldTrackGain, fieldTrackPeak, fieldLoudness} {
+		if v, _ := rebuilt.number(field); v != analysis["song"][field] {
+			t.Errorf("%s is %v, want %v", field, v, analysis["song"][field])
+		}
+	}
+	if rebuilt.text(fieldGainSource) != "r128" {
+		t.Errorf("unexpected gain source %q", rebuilt.text(fieldGainSource))
+	}
+}
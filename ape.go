@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+const (
+	apeFooterSize = 32
+	id3v1Size     = 128
+)
+
+var errNoAPETag = errors.New("no APE tag found")
+
+// apeTag is an APEv1/APEv2 tag, found at the end of MP3 files. Keys are
+// lowercase, binary items are ignored.
+type apeTag map[string]string
+
+// findAPETag returns the offset of the APE tag items in b, the end of a
+// file. The offset is negative when the tag starts before b.
+func findAPETag(b []byte) (int, int, error) {
+	end := len(b)
+	if end >= id3v1Size && string(b[end-id3v1Size:end-id3v1Size+3]) == "TAG" {
+		end -= id3v1Size
+	}
+	footer := end - apeFooterSize
+	if footer < 0 || string(b[footer:footer+8]) != "APETAGEX" {
+		return 0, 0, errNoAPETag
+	}
+
+	// items and footer, the header isn't included
+	size := int(binary.LittleEndian.Uint32(b[footer+12:]))
+	if size < apeFooterSize {
+		return 0, 0, errNoAPETag
+	}
+	return end - size, footer, nil
+}
+
+// readAPETag parses the APE tag items in b.
+func readAPETag(b []byte) apeTag {
+	t := apeTag{}
+	for len(b) >= 9 {
+		size := int(binary.LittleEndian.Uint32(b))
+		flags := binary.LittleEndian.Uint32(b[4:])
+		b = b[8:]
+		k := bytes.IndexByte(b, 0)
+		if k < 0 || k+1+size > len(b) {
+			break
+		}
+		key := strings.ToLower(string(b[:k]))
+		value := string(b[k+1 : k+1+size])
+		b = b[k+1+size:]
+
+		// text items only
+		if flags>>1&3 == 0 {
+			t[key] = value
+		}
+	}
+	return t
+}
+
+func (t apeTag) Format() tag.Format     { return "APE" }
+func (t apeTag) FileType() tag.FileType { return tag.MP3 }
+func (t apeTag) Title() string          { return t["title"] }
+func (t apeTag) Album() string          { return t["album"] }
+func (t apeTag) Artist() string         { return t["artist"] }
+func (t apeTag) AlbumArtist() string    { return t["album artist"] }
+func (t apeTag) Composer() string       { return t["composer"] }
+func (t apeTag) Genre() string          { return t["genre"] }
+func (t apeTag) Picture() *tag.Picture  { return nil }
+func (t apeTag) Lyrics() string         { return t["lyrics"] }
+func (t apeTag) Comment() string        { return t["comment"] }
+
+func (t apeTag) Year() int {
+	y := t["year"]
+	if len(y) > 4 {
+		y = y[:4]
+	}
+	n, _ := strconv.Atoi(y)
+	return n
+}
+
+func (t apeTag) Track() (int, int) { return parseNumberOf(t["track"]) }
+func (t apeTag) Disc() (int, int)  { return parseNumberOf(t["disc"]) }
+
+func (t apeTag) Raw() map[string]interface{} {
+	raw := map[string]interface{}{}
+	for k, v := range t {
+		raw[k] = v
+	}
+	return raw
+}
+
+// parseNumberOf parses values like "3/12".
+func parseNumberOf(s string) (int, int) {
+	parts := strings.SplitN(s, "/", 2)
+	n, _ := strconv.Atoi(strings.TrimSpace(parts[0]))
+	total := 0
+	if len(parts) == 2 {
+		total, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+	}
+	return n, total
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/blugelabs/bluge"
+	"github.com/briandowns/spinner"
+	"github.com/muesli/reflow/truncate"
+	"github.com/rubiojr/rapi"
+	"github.com/rubiojr/rindex"
+	"github.com/rubiojr/rplay/internal/loudness"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	cmd := &cli.Command{
+		Name:      "analyze",
+		Usage:     "Measure the loudness of songs without ReplayGain tags",
+		ArgsUsage: "[query]",
+		Action:    analyzeCmd,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Analyze songs with ReplayGain values too",
+			},
+		},
+	}
+	appCommands = append(appCommands, cmd)
+}
+
+// analyzedSong is a song measured by rplay analyze.
+type analyzedSong struct {
+	doc   *storedDocument
+	meter *loudness.Meter
+}
+
+func analyzeCmd(c *cli.Context) error {
+	initApp()
+
+	q := c.Args().Get(0)
+	if q == "" {
+		q = "*"
+	}
+
+	// Fail fast if index does not exist
+	reader, err := bluge.OpenReader(blugeConf)
+	if err != nil {
+		return errNeedsIndex
+	}
+	reader.Close()
+
+	idx, err = rindex.New(indexPath, globalOptions.Repo, globalOptions.Password)
+	if err != nil {
+		return err
+	}
+
+	repo, err := rapi.OpenRepository(globalOptions)
+	if err != nil {
+		return err
+	}
+	repoID = repo.Config().ID
+
+	docs, err := searchDocuments(q)
+	if err != nil {
+		return err
+	}
+	pending := []*storedDocument{}
+	for _, d := range docs {
+		if d.text("repository_id") != repoID {
+			continue
+		}
+		if _, ok := d.number(fieldTrackGain); ok && !c.Bool("force") {
+			continue
+		}
+		pending = append(pending, d)
+	}
+	if len(pending) == 0 {
+		fmt.Println("Nothing to analyze")
+		return nil
+	}
+
+	// Ctrl-C stops analyzing and saves the songs measured so far
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	defer signal.Stop(sigc)
+	go func() {
+		<-sigc
+		cancel()
+	}()
+
+	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
+	s.Color("fgGreen")
+	s.Start()
+
+	analyzed := []*analyzedSong{}
+	failed := 0
+	for i, d := range pending {
+		name := d.text("title")
+		if name == "" {
+			name = d.text("filename")
+		}
+		s.Suffix = fmt.Sprintf(" [%d/%d] %s", i+1, len(pending), truncate.StringWithTail(name, statusStrLen, "..."))
+
+		m, err := measureSong(ctx, d.id)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			failed++
+			s.Stop()
+			fmt.Printf("🛑 %s: %v\n", name, err)
+			s.Start()
+			continue
+		}
+		analyzed = append(analyzed, &analyzedSong{doc: d, meter: m})
+	}
+	s.Stop()
+
+	updated := setLoudness(analyzed)
+	if err := saveAnalysis(updated); err != nil {
+		return err
+	}
+	if err := updateDocuments(updated); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n💥 %d analyzed, %d failed.\n", len(updated), failed)
+	return nil
+}
+
+// measureSong decodes the song and measures its loudness.
+func measureSong(ctx context.Context, id string) (*loudness.Meter, error) {
+	mime, song, closeSong, err := openSong(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSong()
+
+	pcm, err := decodeAudio(mime, song)
+	if err != nil {
+		return nil, err
+	}
+
+	pcm = NewReader(ctx, pcm)
+	m := loudness.NewMeter(outputSampleRate, outputChannels)
+	buf := make([]byte, outputBufferSize)
+	samples := make([]float64, outputBufferSize/2)
+	for {
+		n, err := io.ReadFull(pcm, buf)
+		for i := 0; i+1 < n; i += 2 {
+			samples[i/2] = float64(int16(uint16(buf[i])|uint16(buf[i+1])<<8)) / 32768
+		}
+		m.Write(samples[:n/2])
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// setLoudness stores the ReplayGain values of the analyzed songs. Songs
+// from the same album, see albumKey, measured together get album values
+// too.
+func setLoudness(songs []*analyzedSong) []*storedDocument {
+	albums := map[string][]*analyzedSong{}
+	docs := []*storedDocument{}
+	for _, s := range songs {
+		l := s.meter.Integrated()
+		s.doc.setNumber(fieldTrackGain, loudnessGain(l))
+		s.doc.setNumber(fieldTrackPeak, s.meter.Peak())
+		if !math.IsInf(l, -1) {
+			s.doc.setNumber(fieldLoudness, l)
+		}
+		s.doc.setText(fieldGainSource, "r128")
+		docs = append(docs, s.doc)
+
+		if album := albumKey(s.doc); album != "" {
+			albums[album] = append(albums[album], s)
+		}
+	}
+
+	for _, tracks := range albums {
+		blocks := []float64{}
+		peak := 0.0
+		for _, s := range tracks {
+			blocks = append(blocks, s.meter.Blocks()...)
+			peak = math.Max(peak, s.meter.Peak())
+		}
+		l := loudness.Integrated(blocks)
+		for _, s := range tracks {
+			s.doc.setNumber(fieldAlbumGain, loudnessGain(l))
+			s.doc.setNumber(fieldAlbumPeak, peak)
+			if !math.IsInf(l, -1) {
+				s.doc.setNumber(fieldAlbumLoudness, l)
+			}
+		}
+	}
+
+	return docs
+}
+
+// loudnessGain returns the ReplayGain gain in dB for a song with loudness l
+// in LUFS. Silent songs are left alone.
+func loudnessGain(l float64) float64 {
+	if math.IsInf(l, -1) {
+		return 0
+	}
+	return replayGainReference - l
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blugelabs/bluge"
+	"github.com/rubiojr/rapi"
+	"github.com/rubiojr/rindex"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	cmd := &cli.Command{
+		Name:   "dupes",
+		Usage:  "List the songs found in more than one location",
+		Action: dupesCmd,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "fuzzy",
+				Usage: "List groups of songs that look like copies, sharing most of their contents or tags",
+			},
+			&cli.Float64Flag{
+				Name:        "threshold",
+				Usage:       "Lowest similarity, from 0 to 1, of fuzzy duplicates",
+				Value:       similarThreshold,
+				Destination: &similarThreshold,
+			},
+		},
+	}
+	appCommands = append(appCommands, cmd)
+}
+
+func dupesCmd(c *cli.Context) error {
+	initApp()
+
+	if c.Bool("fuzzy") {
+		return fuzzyDupes()
+	}
+
+	// Fail fast if index does not exist
+	reader, err := bluge.OpenReader(blugeConf)
+	if err != nil {
+		return errNeedsIndex
+	}
+	reader.Close()
+
+	idx, err = rindex.New(indexPath, globalOptions.Repo, globalOptions.Password)
+	if err != nil {
+		return err
+	}
+	repo, err := rapi.OpenRepository(globalOptions)
+	if err != nil {
+		return err
+	}
+	repoID = repo.Config().ID
+
+	locations, err := openLocations()
+	if err != nil {
+		return err
+	}
+	defer locations.close()
+	dupes, err := locations.duplicates(repoID)
+	if err != nil {
+		return err
+	}
+
+	docs, err := searchDocuments("repository_id:" + repoID)
+	if err != nil {
+		return err
+	}
+	songs := []*storedDocument{}
+	for _, d := range docs {
+		if _, ok := dupes[d.id]; ok {
+			songs = append(songs, d)
+		}
+	}
+	sort.Slice(songs, func(i, j int) bool {
+		return songName(songs[i]) < songName(songs[j])
+	})
+
+	for _, d := range songs {
+		fmt.Println(colorize(songName(d), headerColor))
+		fmt.Printf("  ID: %s\n", d.id)
+		for _, l := range dupes[d.id] {
+			fmt.Printf("  %s:%s (snapshot %.8s, %s)\n", l.Host, l.Path, l.Snapshot, l.Time.Format("2006-1-2"))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Duplicates: %d\n", len(songs))
+
+	return nil
+}
+
+// fuzzyDupes lists the clusters of similar songs and how similar each pair
+// is.
+func fuzzyDupes() error {
+	songs, err := loadSimilarSongs()
+	if err != nil {
+		return err
+	}
+
+	clusters := clusterSongs(songs, similarThreshold)
+	for n, c := range clusters {
+		fmt.Println(colorize(fmt.Sprintf("Cluster %d", n+1), headerColor))
+		number := map[*similarSong]int{}
+		for i, s := range c.songs {
+			number[s] = i + 1
+			fmt.Printf("  [%d] %s\n", i+1, songName(s.doc))
+			fmt.Printf("      ID: %s\n", s.doc.id)
+		}
+		for _, p := range c.pairs {
+			fmt.Printf("  %.2f [%d] ~ [%d] (blobs %.2f, tags %.2f)\n", p.score(), number[p.a], number[p.b], p.blobs, p.tags)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Clusters: %d\n", len(clusters))
+
+	return nil
+}
+
+// songName returns the artist and title of a song, or its file name when
+// it has no tags.
+func songName(d *storedDocument) string {
+	artist, title := d.text("artist"), d.text("title")
+	switch {
+	case title == "":
+		return d.text("filename")
+	case artist == "":
+		return title
+	default:
+		return artist + " - " + title
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blugelabs/bluge"
+	"github.com/briandowns/spinner"
+	"github.com/muesli/reflow/padding"
+	"github.com/muesli/reflow/truncate"
+	"github.com/rubiojr/rapi"
+	"github.com/rubiojr/rindex"
+	"github.com/rubiojr/rplay/internal/acoustid"
+	"github.com/rubiojr/rplay/internal/fps"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	cmd := &cli.Command{
+		Name:      "enrich",
+		Usage:     "Fetch the metadata of songs with missing tags from AcoustID",
+		ArgsUsage: "[query]",
+		Action:    enrichCmd,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    "jobs",
+				Aliases: []string{"j"},
+				Usage:   "Songs fingerprinted at the same time",
+				Value:   2,
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "List the songs with missing tags without fetching anything",
+			},
+			&cli.BoolFlag{
+				Name:  "log-errors",
+				Usage: "Log errors",
+			},
+			&cli.BoolFlag{
+				Name:    "interactive",
+				Aliases: []string{"i"},
+				Usage:   "Choose the match for each song from the best ones",
+			},
+			&cli.Float64Flag{
+				Name:        "min-confidence",
+				Usage:       "Lowest confidence, from 0 to 1, of the matches used",
+				Value:       minConfidence,
+				Destination: &minConfidence,
+				DefaultText: fmt.Sprint(fps.DefaultMinConfidence),
+			},
+		},
+	}
+	appCommands = append(appCommands, cmd)
+}
+
+// enrichedFields are the tags fetched from AcoustID.
+var enrichedFields = []string{"artist", "title", "album"}
+
+// enrichStats are the results of rplay enrich so far.
+type enrichStats struct {
+	total    int
+	done     int
+	found    int
+	notFound int
+	skipped  int
+	errors   []error
+	last     string
+}
+
+func enrichCmd(c *cli.Context) error {
+	initApp()
+
+	q := c.Args().Get(0)
+	if q == "" {
+		q = "*"
+	}
+	dryRun := c.Bool("dry-run")
+	jobs := c.Int("jobs")
+	if jobs < 1 {
+		return errors.New("at least one job is needed")
+	}
+
+	// Fail fast if index does not exist
+	reader, err := bluge.OpenReader(blugeConf)
+	if err != nil {
+		return errNeedsIndex
+	}
+	reader.Close()
+
+	idx, err = rindex.New(indexPath, globalOptions.Repo, globalOptions.Password)
+	if err != nil {
+		return err
+	}
+	repo, err := rapi.OpenRepository(globalOptions)
+	if err != nil {
+		return err
+	}
+	repoID = repo.Config().ID
+
+	if err := setupAcoustID(); err != nil {
+		return err
+	}
+	if !dryRun {
+		if acoustIDKey == "" {
+			return acoustid.ErrMissingAPIKey
+		}
+	}
+
+	docs, err := searchDocuments(q)
+	if err != nil {
+		return err
+	}
+	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
+	var choose func(string, []fps.Candidate) *fps.Candidate
+	if c.Bool("interactive") {
+		choose = candidatePrompt(s, docs)
+	}
+	fprinter, err := newFingerprinter(choose)
+	if err != nil {
+		return err
+	}
+	// values inferred from paths are kept if inference comes first
+	keepInferred := providerBefore(fprinter, fps.ProviderPath, fps.ProviderAcoustID)
+	pending := []*storedDocument{}
+	changed := []*storedDocument{}
+	cached, unknown := 0, 0
+	for _, d := range docs {
+		if d.text("repository_id") != repoID || len(missingTags(d, keepInferred)) == 0 {
+			continue
+		}
+		// songs fingerprinted before, while playing or in an interrupted run
+		m, err := fprinter.Cached(d.id)
+		if err == nil {
+			cached++
+			if setFingerprintMetadata(d, m, false) {
+				changed = append(changed, d)
+			}
+			continue
+		}
+		if errors.Is(err, fps.ErrCachedNotFound) {
+			unknown++
+			continue
+		}
+		pending = append(pending, d)
+	}
+
+	if dryRun {
+		for _, d := range pending {
+			fmt.Printf("%s %s\n", colorize(d.id, headerColor), songName(d))
+			fmt.Printf("     missing %s\n", strings.Join(missingTags(d, keepInferred), ", "))
+		}
+		fmt.Printf("\n%d songs to fingerprint, %d fingerprinted before, %d not found before\n", len(pending), cached, unknown)
+		return nil
+	}
+	if len(pending) == 0 {
+		if len(changed) > 0 {
+			return updateDocuments(changed)
+		}
+		fmt.Println("Nothing to enrich")
+		return nil
+	}
+
+	// Ctrl-C stops fingerprinting, what was found is kept for the next run
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	defer signal.Stop(sigc)
+	go func() {
+		<-sigc
+		cancel()
+	}()
+
+	start := time.Now()
+	progress := make(chan enrichStats, 10)
+	done := make(chan struct{})
+	go func() {
+		enrichMonitor(s, c.Bool("log-errors"), progress)
+		close(done)
+	}()
+	stats, found := enrichSongs(ctx, fprinter, pending, jobs, progress)
+	close(progress)
+	<-done
+
+	for d, m := range found {
+		if setFingerprintMetadata(d, m, false) {
+			changed = append(changed, d)
+		}
+	}
+	if err := updateDocuments(changed); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		fmt.Println("\nInterrupted, run rplay enrich again to continue.")
+	}
+	fmt.Printf(
+		"\n💥 %d found, %d not found, %d skipped, %d errors, %d fingerprinted before, %d not found before. Took %d seconds.\n",
+		stats.found,
+		stats.notFound,
+		stats.skipped,
+		len(stats.errors),
+		cached,
+		unknown,
+		int(time.Since(start).Seconds()),
+	)
+	return nil
+}
+
+// missingTags returns the enriched fields a song has no value for, or only
+// the one inferred from its path unless keepInferred is set.
+func missingTags(d *storedDocument, keepInferred bool) []string {
+	missing := []string{}
+	for _, f := range enrichedFields {
+		if strings.TrimSpace(d.text(f)) == "" || (!keepInferred && fieldSource(d, f) == sourcePath) {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+// enrichSongs fingerprints songs with up to jobs songs at a time, until
+// done or ctx is canceled. Returns the metadata found for each song.
+func enrichSongs(ctx context.Context, fprinter fps.Fingerprinter, songs []*storedDocument, jobs int, progress chan enrichStats) (enrichStats, map[*storedDocument]*fps.Metadata) {
+	stats := enrichStats{total: len(songs), errors: []error{}}
+	found := map[*storedDocument]*fps.Metadata{}
+	var mu sync.Mutex
+	report := func(d *storedDocument, m *fps.Metadata, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		stats.done++
+		stats.last = songName(d)
+		switch {
+		case err == nil:
+			stats.found++
+			found[d] = m
+		case errors.Is(err, fps.ErrMetadataNotFound):
+			stats.notFound++
+		case errors.Is(err, fps.ErrSkipped):
+			stats.skipped++
+		default:
+			stats.errors = append(stats.errors, fmt.Errorf("%s: %w", stats.last, err))
+		}
+		s := stats
+		s.errors = append([]error{}, stats.errors...)
+		progress <- s
+	}
+
+	queue := make(chan *storedDocument)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range queue {
+				m, err := enrichSong(ctx, fprinter, d)
+				if ctx.Err() != nil {
+					return
+				}
+				report(d, m, err)
+			}
+		}()
+	}
+
+queue:
+	for _, d := range songs {
+		select {
+		case queue <- d:
+		case <-ctx.Done():
+			break queue
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return stats, found
+}
+
+// enrichSong fetches the metadata of a song, downloading it if it has to be
+// fingerprinted.
+func enrichSong(ctx context.Context, fprinter fps.Fingerprinter, d *storedDocument) (*fps.Metadata, error) {
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	song := songFromDocument(d, func(ctx context.Context) (string, error) {
+		if f == nil {
+			var err error
+			if f, err = downloadSong(ctx, d.id); err != nil {
+				return "", err
+			}
+		}
+		return f.Name(), nil
+	})
+	return fprinter.Fingerprint(ctx, song)
+}
+
+func enrichMonitor(s *spinner.Spinner, logErrors bool, progress chan enrichStats) {
+	s.Color("fgGreen")
+	s.Suffix = " Fingerprinting songs..."
+	s.Start()
+	defer s.Stop()
+
+	lastError := ""
+	for p := range progress {
+		if logErrors && len(p.errors) > 0 {
+			e := p.errors[len(p.errors)-1].Error()
+			if e != lastError {
+				s.Stop()
+				fmt.Println(e)
+				s.Start()
+				lastError = e
+			}
+		}
+		ls := truncate.StringWithTail(p.last, statusStrLen, "...")
+		s.Suffix = fmt.Sprintf(
+			" [%d/%d] %s 🎯 %d found, %d not found, %d skipped, %d err",
+			p.done,
+			p.total,
+			padding.String(ls, statusStrLen),
+			p.found,
+			p.notFound,
+			p.skipped,
+			len(p.errors),
+		)
+	}
+}
+
+// candidatePrompt returns a function asking the user to choose the match
+// for a song, one song at a time.
+func candidatePrompt(s *spinner.Spinner, docs []*storedDocument) func(string, []fps.Candidate) *fps.Candidate {
+	names := map[string]string{}
+	for _, d := range docs {
+		names[d.id] = songName(d)
+	}
+	in := bufio.NewReader(os.Stdin)
+	var mu sync.Mutex
+
+	return func(id string, candidates []fps.Candidate) *fps.Candidate {
+		mu.Lock()
+		defer mu.Unlock()
+		s.Stop()
+		defer s.Start()
+
+		fmt.Printf("\n%s\n", colorize(names[id], headerColor))
+		for i, c := range candidates {
+			album := c.Album
+			if types := append([]string{c.ReleaseGroupType}, c.SecondaryTypes...); types[0] != "" {
+				album += ", " + strings.Join(types, " + ")
+			}
+			fmt.Printf("  [%d] %s - %s (%s)\n", i+1, c.Artist, c.Title, album)
+			fmt.Printf("      confidence %.2f, score %.2f, %s\n", c.Confidence, c.Score, formatDuration(int64(c.Duration*outputSampleRate)))
+		}
+		for {
+			fmt.Printf("Choose 1-%d, 0 to skip [1]: ", len(candidates))
+			line, err := in.ReadString('\n')
+			if err != nil {
+				return nil
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				return &candidates[0]
+			}
+			if n, err := strconv.Atoi(line); err == nil && n >= 0 && n <= len(candidates) {
+				if n == 0 {
+					return nil
+				}
+				return &candidates[n-1]
+			}
+		}
+	}
+}
@@ -1,38 +1,46 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/blugelabs/bluge"
 	"github.com/briandowns/spinner"
-	"github.com/dhowden/tag"
 	"github.com/muesli/reflow/padding"
 	"github.com/muesli/reflow/truncate"
-	"github.com/rubiojr/rapi/repository"
+	"github.com/rubiojr/rapi"
 	"github.com/rubiojr/rapi/restic"
 	"github.com/rubiojr/rindex"
+	"github.com/rubiojr/rplay/internal/audioinfo"
+	"github.com/rubiojr/rplay/internal/fps"
 	"github.com/urfave/cli/v2"
+	"gopkg.in/ini.v1"
 )
 
 var tStart = time.Now()
 
 const statusStrLen = 30
 
-var audioRegexp *regexp.Regexp
-
-type AudioFilter struct{}
-
-type MP3DocumentBuilder struct{}
+type MP3DocumentBuilder struct {
+	// infers missing tags from the song path, if set
+	pathTags *pathTagger
+	// tags set with rplay tag, by song ID
+	overrides map[string]map[string]string
+	// metadata found online, by song ID
+	metadata map[string]*fps.Metadata
+	// loudness measured with rplay analyze, by song ID
+	analysis map[string]map[string]float64
+}
 
 func init() {
 	cmd := &cli.Command{
-		Name:   "index",
-		Usage:  "Index the repository",
-		Action: indexRepo,
+		Name:      "index",
+		Usage:     "Index the repository",
+		ArgsUsage: "[snapshot ID...]",
+		Action:    indexRepo,
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
 				Name:     "log-errors",
@@ -44,42 +52,113 @@ func init() {
 				Usage:    "Re-index files",
 				Required: false,
 			},
+			&cli.StringSliceFlag{
+				Name:  "include",
+				Usage: "Index files matching `GLOB` (default: known audio extensions)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "Skip files matching `GLOB`",
+			},
+			&cli.StringSliceFlag{
+				Name:  "include-regex",
+				Usage: "Index files whose path matches `REGEX`",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude-regex",
+				Usage: "Skip files whose path matches `REGEX`",
+			},
+			&cli.BoolFlag{
+				Name:  "magic",
+				Usage: "Also index files with audio contents and other extensions",
+			},
+			&cli.Int64Flag{
+				Name:        "max-tag-bytes",
+				Usage:       "Most bytes read from each song to find its tags, besides its first blob",
+				Value:       tagBudget,
+				Destination: &tagBudget,
+			},
+			&cli.StringSliceFlag{
+				Name:  "host",
+				Usage: "Only index snapshots for `HOST`",
+			},
+			&cli.StringSliceFlag{
+				Name:  "tag",
+				Usage: "Only index snapshots with all the tags in `TAG[,TAG]`, can be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "path",
+				Usage: "Only index files under `PATH`",
+			},
+			&cli.IntFlag{
+				Name:  "latest",
+				Usage: "Only index the latest `N` snapshots for each host and paths",
+			},
+			&cli.StringSliceFlag{
+				Name:  "tag-pattern",
+				Usage: "Infer missing tags from paths matching `PATTERN`, like {artist}/{album}/{track} - {title}",
+			},
 		},
 	}
 	appCommands = append(appCommands, cmd)
 }
 
-func (m *AudioFilter) ShouldIndex(path string) bool {
-	return audioRegexp.Match([]byte(path))
-}
-
 func indexRepo(cli *cli.Context) error {
-	var err error
-
-	audioRegexp, err = regexp.Compile(`\.(flac|ogg|mp3)$`)
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	f, err := indexFilter(cli, cfg)
+	if err != nil {
+		return err
+	}
+	pathTags, err := pathTaggerFromConfig(cfg, cli.StringSlice("tag-pattern"))
 	if err != nil {
 		return err
 	}
 
-	progress := make(chan rindex.IndexStats, 10)
-	idxOpts := rindex.IndexOptions{
-		Filter:          &AudioFilter{},
-		AppendFileMeta:  true,
-		DocumentBuilder: &MP3DocumentBuilder{},
+	idx, err := rindex.New(indexPath, globalOptions.Repo, globalOptions.Password)
+	if err != nil {
+		return err
+	}
+	repo, err := rapi.OpenRepository(globalOptions)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+	snapshots, err := restic.LoadAllSnapshots(ctx, repo, nil)
+	if err != nil {
+		return err
 	}
+
 	if cli.Bool("reindex") {
-		idxOpts.Reindex = true
 		fmt.Println("Re-indexing all snapshots and files")
 	}
-	go progressMonitor(cli.Bool("log-errors"), progress)
-
-	idx, err := rindex.New(indexPath, globalOptions.Repo, globalOptions.Password)
+	indexer, err := newSongIndexer(idx.IndexEngine, f, indexScope(cli), cli.Bool("reindex"))
 	if err != nil {
 		return err
 	}
-	stats, err := idx.Index(context.Background(), idxOpts, progress)
+	defer indexer.close()
+	indexer.builder.pathTags = pathTags
+	if indexer.builder.overrides, err = loadOverrides(); err != nil {
+		return err
+	}
+	if indexer.builder.metadata, err = loadFingerprintMetadata(); err != nil {
+		return err
+	}
+	if indexer.builder.analysis, err = loadAnalysis(); err != nil {
+		return err
+	}
+
+	progress := make(chan rindex.IndexStats, 10)
+	go progressMonitor(cli.Bool("log-errors"), progress)
+
+	stats, err := indexer.index(ctx, repo, snapshots, progress)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	fmt.Printf(
 		"\n💥 %d indexed, %d already present. Took %d seconds.\n",
@@ -90,35 +169,168 @@ func indexRepo(cli *cli.Context) error {
 	return nil
 }
 
-func (i MP3DocumentBuilder) BuildDocument(fileID string, node *restic.Node, repo *repository.Repository) *bluge.Document {
-	buf, err := repo.LoadBlob(context.Background(), restic.DataBlob, node.Content[0], nil)
-	var id3Info tag.Metadata
-	if err == nil {
-		// ignore errors when reading tags, we still want to index them
-		id3Info, _ = tag.ReadFrom(bytes.NewReader(buf))
+// indexFilter returns the filter for the songs to index, from the command
+// line flags or the configuration file.
+func indexFilter(c *cli.Context, cfg *ini.File) (*audioFilter, error) {
+	p := patternsFromConfig(cfg)
+
+	if c.IsSet("include") || c.IsSet("include-regex") {
+		p.include = c.StringSlice("include")
+		p.includeRegex = c.StringSlice("include-regex")
+	}
+	if c.IsSet("exclude") || c.IsSet("exclude-regex") {
+		p.exclude = c.StringSlice("exclude")
+		p.excludeRegex = c.StringSlice("exclude-regex")
+	}
+	if c.IsSet("magic") {
+		p.magic = c.Bool("magic")
+	}
+
+	return newAudioFilter(p)
+}
+
+// indexScope returns the snapshots and paths to index from the command
+// line.
+func indexScope(c *cli.Context) *snapshotScope {
+	s := &snapshotScope{
+		hosts:  c.StringSlice("host"),
+		paths:  c.StringSlice("path"),
+		latest: c.Int("latest"),
+		ids:    c.Args().Slice(),
+	}
+	for _, t := range c.StringSlice("tag") {
+		s.tags.Set(t)
 	}
+	return s
+}
+
+func (i MP3DocumentBuilder) buildDocument(fileID, nodepath string, blobs *songBlobs) *bluge.Document {
+	// songs without tags are indexed too, err is only set if the song
+	// can't be loaded
+	id3Info, head, err := readSongTags(blobs)
 
 	artist := ""
 	title := ""
 	album := ""
 	genre := ""
 	year := 0
+	albumArtist := ""
+	composer := ""
+	track, disc := 0, 0
 	if id3Info != nil {
 		artist = id3Info.Artist()
 		title = id3Info.Title()
 		album = id3Info.Album()
 		genre = id3Info.Genre()
 		year = id3Info.Year()
+		albumArtist = id3Info.AlbumArtist()
+		composer = id3Info.Composer()
+		track, _ = id3Info.Track()
+		disc, _ = id3Info.Disc()
+	}
+
+	// tags missing from the song are inferred from its path
+	sources := map[string]string{}
+	if i.pathTags != nil {
+		tags := i.pathTags.infer(nodepath)
+		for field, v := range map[string]*string{"artist": &artist, "title": &title, "album": &album} {
+			if strings.TrimSpace(*v) == "" && tags[field] != "" {
+				*v = tags[field]
+				sources[field] = sourcePath
+			}
+		}
+		for field, v := range map[string]*int{"track": &track, "year": &year} {
+			if *v == 0 && tags[field] != "" {
+				*v, _ = strconv.Atoi(tags[field])
+				sources[field] = sourcePath
+			}
+		}
 	}
+
+	// tags set by the user replace the song tags, which are kept
+	originals := []bluge.Field{}
+	texts := map[string]*string{"artist": &artist, "title": &title, "album": &album, "genre": &genre, "album_artist": &albumArtist}
+	for field, value := range i.overrides[fileID] {
+		if v, ok := texts[field]; ok {
+			if sources[field] == "" {
+				originals = append(originals, bluge.NewTextField(originalField(field), *v).StoreValue())
+			}
+			*v = value
+		} else if field == "year" {
+			if sources[field] == "" {
+				originals = append(originals, bluge.NewNumericField(originalField(field), float64(year)).StoreValue())
+			}
+			year, _ = strconv.Atoi(value)
+		} else {
+			continue
+		}
+		sources[field] = sourceUser
+	}
+
 	doc := bluge.NewDocument(fileID).
 		AddField(bluge.NewTextField("artist", artist).StoreValue()).
 		AddField(bluge.NewTextField("title", title).StoreValue()).
 		AddField(bluge.NewTextField("album", album).StoreValue()).
 		AddField(bluge.NewTextField("genre", genre).StoreValue()).
-		AddField(bluge.NewNumericField("year", float64(year)).StoreValue())
+		AddField(bluge.NewNumericField("year", float64(year)).StoreValue()).
+		AddField(bluge.NewTextField("album_artist", albumArtist).StoreValue()).
+		AddField(bluge.NewTextField("composer", composer).StoreValue()).
+		AddField(bluge.NewNumericField("track", float64(track)).StoreValue()).
+		AddField(bluge.NewNumericField("disc", float64(disc)).StoreValue())
+
+	for field, source := range sources {
+		doc.AddField(bluge.NewTextField(sourceField(field), source).StoreValue())
+	}
+	for _, f := range originals {
+		doc.AddField(f)
+	}
+
+	if err == nil {
+		addAudioInfo(doc, head, blobs)
+	}
+
+	// the loudness measured replaces the tags, like when it was measured
+	rg, gainSource := readReplayGain(id3Info), "tags"
+	if values := i.analysis[fileID]; len(values) > 0 {
+		rg, gainSource = values, "r128"
+	}
+	for field, v := range rg {
+		doc.AddField(bluge.NewNumericField(field, v).StoreValue())
+	}
+	if len(rg) > 0 {
+		doc.AddField(bluge.NewTextField(fieldGainSource, gainSource).StoreValue())
+	}
+
+	// metadata found online is kept when reindexing
+	if m := i.metadata[fileID]; m != nil {
+		d := storedFields(doc)
+		if setFingerprintMetadata(d, m, false) {
+			return d.document()
+		}
+	}
+
 	return doc
 }
 
+// addAudioInfo adds the song duration and stream properties to doc. head
+// is the beginning of the song.
+func addAudioInfo(doc *bluge.Document, head []byte, blobs *songBlobs) {
+	info, err := audioinfo.Read(head, blobs.size, blobs.tail)
+	if err != nil {
+		return
+	}
+
+	doc.AddField(bluge.NewKeywordField("codec", info.Codec).StoreValue().Aggregatable())
+	if info.Duration > 0 {
+		doc.AddField(bluge.NewNumericField("duration", info.Duration.Seconds()).StoreValue())
+	}
+	if info.Bitrate > 0 {
+		doc.AddField(bluge.NewNumericField("bitrate", float64(info.Bitrate/1000)).StoreValue())
+	}
+	doc.AddField(bluge.NewNumericField("sample_rate", float64(info.SampleRate)).StoreValue()).
+		AddField(bluge.NewNumericField("channels", float64(info.Channels)).StoreValue())
+}
+
 func progressMonitor(logErrors bool, progress chan rindex.IndexStats) {
 	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
 	s.Color("fgGreen")
@@ -131,7 +343,6 @@ func progressMonitor(logErrors bool, progress chan rindex.IndexStats) {
 				if len(p.Errors) > 0 {
 					e := p.Errors[len(p.Errors)-1].Error()
 					if e != lastError {
-						panic(e)
 						fmt.Println("\n", e)
 						lastError = e
 					}
@@ -156,5 +367,4 @@ func progressMonitor(logErrors bool, progress chan rindex.IndexStats) {
 			time.Sleep(100 * time.Millisecond)
 		}
 	}
-	s.Stop()
 }
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rubiojr/rplay/internal/fps"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	cmd := &cli.Command{
+		Name:  "metadata-cache",
+		Usage: "Inspect and edit the metadata found online",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List the songs in the cache",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "not-found",
+						Usage: "Only list the songs not found",
+					},
+				},
+				Action: metadataCacheList,
+			},
+			{
+				Name:      "show",
+				Usage:     "Show what's cached for a song",
+				ArgsUsage: "<song ID>",
+				Action:    metadataCacheShow,
+			},
+			{
+				Name:      "delete",
+				Usage:     "Remove songs from the cache, so they're looked up again",
+				ArgsUsage: "<song ID...>",
+				Action:    metadataCacheDelete,
+			},
+			{
+				Name:   "purge-negative",
+				Usage:  "Remove the songs not found, so they're looked up again",
+				Action: metadataCachePurge,
+			},
+			{
+				Name:      "export",
+				Usage:     "Export the cache as JSON",
+				ArgsUsage: "[file]",
+				Action:    metadataCacheExport,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import songs exported as JSON, replacing the ones cached",
+				ArgsUsage: "<file>",
+				Action:    metadataCacheImport,
+			},
+		},
+	}
+	appCommands = append(appCommands, cmd)
+}
+
+func metadataCacheList(c *cli.Context) error {
+	initApp()
+	cache, err := metadataCache()
+	if err != nil {
+		return err
+	}
+	entries, err := cache.Entries()
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, m := range entries {
+		if c.Bool("not-found") && !m.NotFound {
+			continue
+		}
+		n++
+		name := "not found"
+		if !m.NotFound {
+			name = strings.Join(nonEmpty(m.Artist, m.Title, m.Album), " - ")
+		}
+		updated := "-"
+		if !m.Updated.IsZero() {
+			updated = m.Updated.Format("2006-01-02")
+		}
+		fmt.Printf("%s %s %s\n", colorize(m.FileID, headerColor), updated, name)
+	}
+	fmt.Printf("\n%d songs\n", n)
+	return nil
+}
+
+func metadataCacheShow(c *cli.Context) error {
+	initApp()
+	if c.NArg() != 1 {
+		return errors.New("a song ID is needed")
+	}
+	cache, err := metadataCache()
+	if err != nil {
+		return err
+	}
+	m, err := cache.Entry(c.Args().First())
+	if err != nil {
+		return err
+	}
+	return writeJSON(os.Stdout, m)
+}
+
+func metadataCacheDelete(c *cli.Context) error {
+	initApp()
+	if c.NArg() == 0 {
+		return errors.New("no songs to delete")
+	}
+	cache, err := metadataCache()
+	if err != nil {
+		return err
+	}
+	for _, id := range c.Args().Slice() {
+		if err := cache.Delete(id); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func metadataCachePurge(c *cli.Context) error {
+	initApp()
+	cache, err := metadataCache()
+	if err != nil {
+		return err
+	}
+	n, err := cache.PurgeNotFound()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d songs removed\n", n)
+	return nil
+}
+
+func metadataCacheExport(c *cli.Context) error {
+	initApp()
+	cache, err := metadataCache()
+	if err != nil {
+		return err
+	}
+	entries, err := cache.Entries()
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() == 0 {
+		return writeJSON(os.Stdout, entries)
+	}
+	f, err := os.Create(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(f, entries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func metadataCacheImport(c *cli.Context) error {
+	initApp()
+	if c.NArg() != 1 {
+		return errors.New("a file to import is needed")
+	}
+	f, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries := []*fps.Metadata{}
+	if err := json.NewDecoder(f).Decode(&entries); err != nil {
+		return err
+	}
+	cache, err := metadataCache()
+	if err != nil {
+		return err
+	}
+	for _, m := range entries {
+		if m.FileID == "" {
+			return errors.New("songs without an ID can't be imported")
+		}
+		m.Cached = false
+	}
+	if err := cache.Save(entries...); err != nil {
+		return err
+	}
+	fmt.Printf("%d songs imported\n", len(entries))
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// nonEmpty returns the values that aren't empty.
+func nonEmpty(values ...string) []string {
+	list := []string{}
+	for _, v := range values {
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
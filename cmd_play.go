@@ -4,21 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
-	"os/signal"
-	"path/filepath"
-	"syscall"
 	"time"
 
 	"github.com/blugelabs/bluge"
 	"github.com/briandowns/spinner"
-	"github.com/h2non/filetype"
 	"github.com/muesli/reflow/truncate"
 	"github.com/rubiojr/rapi"
 	"github.com/rubiojr/rapi/repository"
 	"github.com/rubiojr/rindex"
-	"github.com/rubiojr/rplay/internal/acoustid"
 	"github.com/rubiojr/rplay/internal/fps"
 	"github.com/urfave/cli/v2"
 )
@@ -28,7 +25,15 @@ var repoID = ""
 var idx rindex.Indexer
 var fetchMetadata = false
 var overrideMetadata = false
-var tmpFileName string
+
+// metadataFinder finds the metadata of the songs played. It's built once
+// so the web service rate limits apply to every song.
+var metadataFinder *fps.Chain
+
+var audioOut audioSink
+
+// uiOut shows the songs played and the player status.
+var uiOut io.Writer = os.Stdout
 
 func init() {
 	cmd := &cli.Command{
@@ -36,6 +41,24 @@ func init() {
 		Usage:  "Play a song (random if no argument given)",
 		Action: playCmd,
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "album",
+				Usage: "Play the album `NAME` in track order",
+			},
+			&cli.StringFlag{
+				Name:  "artist",
+				Usage: "Artist of the album played, when several have one with the same name",
+			},
+			&cli.BoolFlag{
+				Name:  "gapless",
+				Usage: "Start the next song with no gap",
+			},
+			&cli.StringFlag{
+				Name:        "replaygain",
+				Usage:       "Loudness normalization (track, album, off)",
+				Value:       "track",
+				Destination: &replayGainMode,
+			},
 			&cli.BoolFlag{
 				Name:        "fetch-metadata",
 				Required:    false,
@@ -55,6 +78,26 @@ func init() {
 		Usage:  "Play songs randomly and endlessly",
 		Action: playCmd,
 		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "gapless",
+				Usage: "Start the next song with no gap",
+			},
+			&cli.IntFlag{
+				Name:  "crossfade",
+				Usage: "Overlap songs for `SECONDS`",
+			},
+			&cli.StringFlag{
+				Name:        "fade-curve",
+				Usage:       "Crossfade curve (linear, equal-power, s-curve)",
+				Value:       "equal-power",
+				Destination: &fadeCurve,
+			},
+			&cli.StringFlag{
+				Name:        "replaygain",
+				Usage:       "Loudness normalization (track, album, off)",
+				Value:       "track",
+				Destination: &replayGainMode,
+			},
 			&cli.BoolFlag{
 				Name:        "fetch-metadata",
 				Required:    false,
@@ -70,38 +113,70 @@ func init() {
 	appCommands = append(appCommands, cmd)
 }
 
+// randomize returns a random song the player can decode.
 func randomize() (string, error) {
-	var err error
 	hits := []string{}
-
-	count, err := idx.Search("repository_id:"+repoID, func(field string, value []byte) bool {
-		if field == "_id" {
-			hits = append(hits, string(value))
+	var id, codec, filename string
+	_, err := searchIndex("repository_id:"+repoID, func(field string, value []byte) bool {
+		switch field {
+		case "_id":
+			id = string(value)
+		case "codec":
+			codec = string(value)
+		case "filename":
+			filename = string(value)
 		}
 		return true
-	}, nil)
+	}, func() bool {
+		if playable(codec, filename) {
+			hits = append(hits, id)
+		}
+		id, codec, filename = "", "", ""
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
 
-	if count == 0 {
+	if len(hits) == 0 {
 		return "", errors.New("no songs found")
 	}
 
 	rand.Seed(time.Now().UnixNano())
-	r := rand.Intn(len(hits))
-
-	return hits[r], err
+	return hits[rand.Intn(len(hits))], nil
 }
 
 func playCmd(c *cli.Context) error {
 	initApp()
-	tmpFileName = filepath.Join(defaultCacheDir(), fmt.Sprintf("song-%d", time.Now().UnixNano()))
+
+	if err := setupTransition(c.Bool("gapless"), c.Int("crossfade")); err != nil {
+		return err
+	}
+	if err := setupReplayGain(); err != nil {
+		return err
+	}
 
 	// overrideMetadata also means fetchMetadata
 	if overrideMetadata {
 		fetchMetadata = overrideMetadata
 	}
 
-	if fetchMetadata && acoustid.FindFPCALC() == "" {
-		fmt.Fprintln(os.Stderr, "\n⚠️  fpcalc not found, acousting fingerprinting won't work\n")
+	if fetchMetadata {
+		if err := setupAcoustID(); err != nil {
+			return err
+		}
+		if acoustIDKey == "" {
+			fmt.Fprint(os.Stderr, "\n⚠️  AcoustID API key not set, metadata won't be fetched\n\n")
+		}
+		finder, err := newFingerprinter(nil)
+		if err != nil {
+			return err
+		}
+		metadataFinder = finder
+		if overrideMetadata {
+			// replace the tags with what's found online
+			metadataFinder = metadataFinder.Without(fps.ProviderTags, fps.ProviderPath)
+		}
 	}
 
 	// Fail fast if index does not exist
@@ -123,150 +198,372 @@ func playCmd(c *cli.Context) error {
 
 	repoID = repo.Config().ID
 
+	var album []string
+	if name := c.String("album"); name != "" {
+		album, err = albumSongs(name, c.String("artist"))
+		if err != nil {
+			return err
+		}
+	}
+
+	// A single output is used for the whole session, songs are resampled
+	// to its sample rate.
+	uiOut = uiWriter(outputName)
+	audioOut, err = newAudioSink(outputName)
+	if err != nil {
+		return err
+	}
+	defer audioOut.Close()
+
+	restore := setupControls()
+	defer restore()
+
+	if album != nil {
+		fmt.Fprintf(uiOut, "Playing %s, %d songs...\n", c.String("album"), len(album))
+		return playList(repo, songList(album))
+	}
+
 	id := c.Args().Get(0)
 	if id == "" {
-		err = randomizeSongs(repo)
-	} else {
-		fmt.Printf("Playing %s...\n", id)
-		err = playSong(context.Background(), id, repo)
+		return randomizeSongs(repo)
 	}
 
-	return err
+	fmt.Fprintf(uiOut, "Playing %s...\n", id)
+	return playList(repo, songList([]string{id}))
 }
 
 func randomizeSongs(repo *repository.Repository) error {
-	signal_chan := make(chan os.Signal, 1)
-	signal.Notify(signal_chan, syscall.SIGINT)
-	ctx, cancel := context.WithCancel(context.Background())
-	lastCancel := time.Now()
-	go func() {
-		for {
-			s := <-signal_chan
-			switch s {
-			case syscall.SIGINT:
-				cancel()
-				now := time.Now()
-				if time.Since(lastCancel) < 2*time.Second {
-					os.Remove(tmpFileName)
-					os.Exit(0)
-				}
-				lastCancel = now
-			default:
+	fmt.Fprintln(uiOut, "Playing a random selection of songs...")
+	fmt.Fprintln(uiOut, "Ctrl-C once to play the next song, twice to exit.")
+
+	return playList(repo, randomize)
+}
+
+// songList returns a playList source that plays ids in order.
+func songList(ids []string) func() (string, error) {
+	return func() (string, error) {
+		if len(ids) == 0 {
+			return "", nil
+		}
+		id := ids[0]
+		ids = ids[1:]
+		return id, nil
+	}
+}
+
+// playList plays songs one after another until next returns an empty ID,
+// handling the next, previous and quit player controls.
+//
+// When a transition mode is enabled, the following song is prepared while
+// the current one plays, so it starts without a gap or is mixed into the
+// end of the current one.
+func playList(repo *repository.Repository, next func() (string, error)) error {
+	history := []string{}
+	pos := -1
+	// returned by next() but not played yet
+	pending := ""
+	upcoming := func() (string, error) {
+		if pos+1 < len(history) {
+			return history[pos+1], nil
+		}
+		if pending == "" {
+			var err error
+			pending, err = next()
+			if err != nil {
+				return "", err
 			}
 		}
+		return pending, nil
+	}
+
+	var preloaded *preload
+	defer func() {
+		if preloaded != nil {
+			preloaded.discard()
+		}
 	}()
+	// the end of the previous song, mixed into the next one
+	var tail []byte
 
-	fmt.Println("Playing a random selection of songs...")
-	fmt.Println("Ctrl-C once to play the next song, twice to exit.")
 	for {
-		id, err := randomize()
+		id, err := upcoming()
 		if err != nil {
 			return err
 		}
+		if id == "" {
+			return nil
+		}
+		if pos+1 == len(history) {
+			history = append(history, id)
+			pending = ""
+		}
+		pos++
 
-		fmt.Println()
-		err = playSong(ctx, id, repo)
-		switch err {
-		case context.Canceled:
-			ctx, cancel = context.WithCancel(context.Background())
-			continue
-		case nil:
-			continue
-		default:
-			fmt.Printf("\n\n🛑 %v\n", err)
+		ctx, cancel := context.WithCancel(context.Background())
+		controls.startSong(cancel)
+
+		var t *track
+		if preloaded != nil && preloaded.id == id {
+			t, err = preloaded.wait(ctx)
+		} else {
+			if preloaded != nil {
+				preloaded.discard()
+			}
+			t, err = prepareSong(ctx, id)
+		}
+		preloaded = nil
+
+		if err == nil && transition != transitionNone {
+			if nid, err := upcoming(); err == nil && nid != "" {
+				preloaded = preloadSong(nid)
+			}
+		}
+
+		fmt.Fprintln(uiOut)
+		if err == nil {
+			tail, err = playTrack(ctx, t, tail)
+			t.Close()
+		}
+		cancel()
+
+		switch controls.lastAction() {
+		case actionQuit:
+			fmt.Fprintln(uiOut)
+			return nil
+		case actionPrevious:
+			// play the previous song, or this one again if it's the first
+			pos -= 2
+			if pos < -1 {
+				pos = -1
+			}
+		}
+
+		if err != nil {
+			tail = nil
+			if err != context.Canceled {
+				fmt.Fprintf(uiOut, "\n\n🛑 %v\n", err)
+			}
 		}
 	}
 }
 
-func playSong(ctx context.Context, id string, repo *repository.Repository) error {
-	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond)
+// track is a song ready to be played.
+type track struct {
+	id   string
+	meta map[string][]byte
+	// the downloaded song, only when it was fingerprinted
+	file *os.File
+	// 16 bit stereo audio at the output sample rate
+	pcm       io.Reader
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeSong func()
+}
+
+// prepareSong loads the song metadata and starts fetching and decoding
+// the song.
+func prepareSong(ctx context.Context, id string) (*track, error) {
+	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond, spinner.WithWriter(uiOut))
 	s.Color("fgMagenta")
 	s.Suffix = " Song found, buffering..."
 
-	var ssize float64
 	meta := map[string][]byte{}
-	_, err := idx.Search("_id:"+id, func(field string, value []byte) bool {
-		if field == "size" {
-			ssize, _ = bluge.DecodeNumericFloat64(value)
-			return true
-		}
+	// the song fields, to look up its metadata
+	doc := &storedDocument{id: id, fields: map[string][][]byte{}}
+	_, err := searchIndex("_id:"+id, func(field string, value []byte) bool {
 		if !filterFieldPlay(field) {
 			meta[field] = value
 		}
+		doc.fields[field] = append(doc.fields[field], append([]byte{}, value...))
 		return true
 	}, nil)
 
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.fields) > 0 && !playable(doc.text("codec"), doc.text("filename")) {
+		return nil, fmt.Errorf("%s can't be played, unsupported audio type %s", id, doc.text("codec"))
+	}
+
 	title := string(meta["title"])
 	if title != "" {
 		s.Suffix = fmt.Sprintf(" Song found, buffering '%s'...", truncate.StringWithTail(title, 20, ""))
 	}
 
-	// Limit to 30MiB songs for now
-	if ssize > 31457280 {
-		return errors.New("song too big")
+	ctx, cancel := context.WithCancel(ctx)
+	t := &track{id: id, meta: meta, ctx: ctx, cancel: cancel, closeSong: func() {}}
+
+	// the song is looked up first, so it's played from the file if the
+	// fingerprinter downloaded it, and streamed otherwise
+	if fetchMetadata {
+		s.Suffix = " 🌍 fetching metadata..."
+		err := fixMetadata(ctx, doc, t.download, meta)
+		if err != nil {
+			meta["metadata source"] = []byte("🤷")
+		}
 	}
 
-	tmpFile, err := os.Create(tmpFileName)
-	if err != nil {
-		return err
+	if err := t.open(); err != nil {
+		t.Close()
+		return nil, err
 	}
-	defer tmpFile.Close()
 
-	err = idx.Fetch(ctx, id, tmpFile)
+	s.Stop()
+
+	return t, nil
+}
+
+// open starts decoding the song from the beginning.
+func (t *track) open() error {
+	t.closeSong()
+	t.closeSong = func() {}
+
+	mime, song, closeSong, err := openSong(t.ctx, t.id, t.file)
 	if err != nil {
 		return err
 	}
+	t.closeSong = closeSong
 
-	kind, err := filetype.MatchFile(tmpFileName)
+	pcm, err := decodeAudio(mime, song)
 	if err != nil {
 		return err
 	}
-	if kind.MIME.Value == "" {
-		return fmt.Errorf("mime type not found. damaged file?")
-	}
+	t.pcm = newGainReader(pcm, replayGain(t.meta))
 
-	if fetchMetadata {
-		s.Suffix = " 🌍 fetching metadata..."
-		err := fixMetadata(id, tmpFileName, meta)
+	return nil
+}
+
+// download fetches the whole song to a temporary file, the first time it's
+// called, and returns its name.
+func (t *track) download(ctx context.Context) (string, error) {
+	if t.file == nil {
+		f, err := downloadSong(ctx, t.id)
 		if err != nil {
-			meta["metadata source"] = []byte("🤷")
+			return "", err
 		}
+		t.file = f
 	}
+	return t.file.Name(), nil
+}
 
-	s.Stop()
+func (t *track) Close() {
+	t.closeSong()
+	t.cancel()
+	if t.file != nil {
+		t.file.Close()
+		os.Remove(t.file.Name())
+	}
+}
 
+// playTrack plays t mixing tail, the end of the previous song, into its
+// beginning. It returns the end of t that has to be mixed into the next
+// song, if any.
+func playTrack(ctx context.Context, t *track, tail []byte) ([]byte, error) {
 	// Sort metadata
 	keys := []string{
-		"title", "artist", "album", "genre", "year", "metadata source", "filename", "_id",
+		"title", "artist", "album", "album_artist", "track", "disc", "composer",
+		"genre", "year", "duration", "codec", "bitrate",
+		"sample_rate", "channels", "metadata source", "filename", "_id",
 	}
 	for _, k := range keys {
-		printMetadata(k, meta[k], headerColor)
+		printMetadata(uiOut, k, t.meta[k], headerColor)
 	}
 
-	song, err := os.Open(tmpFileName)
-	if err != nil {
-		return err
+	var start int64
+	for {
+		la := newLookahead(t.pcm, crossfadeFrames())
+		cr := newControlledReader(newFadeMixer(tail, la, fadeCurves[fadeCurve]), controls)
+		err := cr.skipTo(start)
+		if err == nil {
+			_, err = io.Copy(audioOut, NewReader(ctx, cr))
+		}
+		if err == io.EOF {
+			err = nil
+		}
+
+		// Seeking backwards plays the song again from the new position
+		serr, ok := err.(*seekError)
+		if !ok {
+			return la.tail(), err
+		}
+		tail = nil
+		start = serr.frame
+		if err := t.open(); err != nil {
+			return nil, err
+		}
 	}
-	defer song.Close()
-	return play(ctx, kind.MIME.Value, song)
 }
 
-func fixMetadata(id, song string, meta map[string][]byte) error {
-	fprinter := fps.New(filepath.Join(defaultIndexDir(), "acoustid.db"))
+// openSong returns the song audio type and contents, streamed from the
+// repository or read from file if it has been downloaded already.
+// The returned function stops streaming the song.
+func openSong(ctx context.Context, id string, file *os.File) (string, io.Reader, func(), error) {
+	var song io.Reader
+	closeSong := func() {}
+
+	if file != nil {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", nil, nil, err
+		}
+		song = file
+	} else {
+		ctx, cancel := context.WithCancel(ctx)
+		stream := streamSong(ctx, id)
+		closeSong = func() {
+			stream.CloseRead()
+			cancel()
+		}
+		song = stream
+	}
 
-	fmeta, err := fprinter.Fingerprint(id, song)
+	mime, song, err := sniffAudioType(song)
 	if err != nil {
-		return err
+		closeSong()
+		return "", nil, nil, err
 	}
 
-	if string(meta["artist"]) == "" || overrideMetadata {
-		meta["artist"] = []byte(fmeta.Artist)
+	return mime, song, closeSong, nil
+}
+
+// downloadSong fetches the whole song to a temporary file and returns it
+// opened for reading.
+func downloadSong(ctx context.Context, id string) (*os.File, error) {
+	tmpFile, err := ioutil.TempFile(defaultCacheDir(), "song-")
+	if err != nil {
+		return nil, err
 	}
-	if string(meta["title"]) == "" || overrideMetadata {
-		meta["title"] = []byte(fmeta.Title)
+
+	err = idx.Fetch(ctx, id, tmpFile)
+	if err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return nil, err
 	}
-	if string(meta["album"]) == "" || overrideMetadata {
-		meta["album"] = []byte(fmeta.Album)
+
+	return tmpFile, nil
+}
+
+// fixMetadata looks up the metadata of a song and adds it to meta. file
+// downloads the song, only if it has to be fingerprinted.
+func fixMetadata(ctx context.Context, doc *storedDocument, file func(context.Context) (string, error), meta map[string][]byte) error {
+	fmeta, err := metadataFinder.Fingerprint(ctx, songFromDocument(doc, file))
+	if err != nil {
+		return err
+	}
+	// the metadata is shown even if the index can't be updated, it's
+	// saved again the next time
+	saveFingerprintMetadata(doc.id, fmeta, overrideMetadata)
+
+	for _, field := range fps.Fields {
+		source := fieldSource(doc, field)
+		if source == sourceUser {
+			continue
+		}
+		if string(meta[field]) == "" || source == sourcePath || overrideMetadata {
+			if v := *fmeta.Field(field); v != "" {
+				meta[field] = []byte(v)
+			}
+		}
 	}
 
 	meta["metadata source"] = []byte(fmt.Sprintf("%t", fmeta.Cached))
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/rubiojr/rindex"
 	"github.com/urfave/cli/v2"
@@ -19,6 +20,11 @@ func init() {
 				Usage:    "Enable verbose output",
 				Required: false,
 			},
+			&cli.BoolFlag{
+				Name:    "locations",
+				Aliases: []string{"l"},
+				Usage:   "List every host and path where the songs were found",
+			},
 		},
 	}
 	appCommands = append(appCommands, cmd)
@@ -29,6 +35,15 @@ func doSearch(c *cli.Context) error {
 	q := c.Args().Get(0)
 	verbose := c.Bool("verbose")
 
+	var locations *locationStore
+	if c.Bool("locations") {
+		var err error
+		if locations, err = openLocations(); err != nil {
+			return err
+		}
+		defer locations.close()
+	}
+
 	idx, err := rindex.New(indexPath, globalOptions.Repo, globalOptions.Password)
 	if err != nil {
 		return err
@@ -36,13 +51,23 @@ func doSearch(c *cli.Context) error {
 
 	fmt.Printf("Searching for %s...\n", q)
 
+	var id, repository string
 	count, err := idx.Search(q, func(field string, value []byte) bool {
+		switch field {
+		case "_id":
+			id = string(value)
+		case "repository_id":
+			repository = string(value)
+		}
 		if filterField(field) && !verbose {
 			return true
 		}
-		printMetadata(field, value, headerColor)
+		printMetadata(os.Stdout, field, value, headerColor)
 		return true
 	}, func() bool {
+		if locations != nil {
+			printLocations(locations, id, repository)
+		}
 		fmt.Println()
 		return true
 	})
@@ -51,3 +76,14 @@ func doSearch(c *cli.Context) error {
 
 	return err
 }
+
+func printLocations(locations *locationStore, id, repository string) {
+	list, err := locations.locations(id, repository)
+	if err != nil {
+		printRow(os.Stdout, "Locations", "error", headerColor)
+		return
+	}
+	for _, l := range list {
+		printRow(os.Stdout, "Location", l.Host+":"+l.Path, headerColor)
+	}
+}
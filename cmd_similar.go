@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/blugelabs/bluge"
+	"github.com/rubiojr/rapi"
+	"github.com/rubiojr/rindex"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	cmd := &cli.Command{
+		Name:      "similar",
+		Usage:     "List songs that look like copies of a song",
+		ArgsUsage: "<id>",
+		Action:    similarCmd,
+		Flags: []cli.Flag{
+			&cli.Float64Flag{
+				Name:        "threshold",
+				Usage:       "Lowest similarity, from 0 to 1, of the songs listed",
+				Value:       similarThreshold,
+				Destination: &similarThreshold,
+			},
+		},
+	}
+	appCommands = append(appCommands, cmd)
+}
+
+func similarCmd(c *cli.Context) error {
+	initApp()
+
+	id := c.Args().Get(0)
+	if id == "" {
+		return errors.New("missing song ID")
+	}
+
+	songs, err := loadSimilarSongs()
+	if err != nil {
+		return err
+	}
+	var song *similarSong
+	for _, s := range songs {
+		if s.doc.id == id {
+			song = s
+		}
+	}
+	if song == nil {
+		return fmt.Errorf("song %s not found", id)
+	}
+
+	found := similarSongs(song, songs, similarThreshold)
+	for _, sim := range found {
+		printSimilarity(sim.b, sim)
+	}
+	fmt.Printf("Similar songs: %d\n", len(found))
+
+	return nil
+}
+
+// loadSimilarSongs returns the songs in the repository to compare.
+func loadSimilarSongs() ([]*similarSong, error) {
+	// Fail fast if index does not exist
+	reader, err := bluge.OpenReader(blugeConf)
+	if err != nil {
+		return nil, errNeedsIndex
+	}
+	reader.Close()
+
+	idx, err = rindex.New(indexPath, globalOptions.Repo, globalOptions.Password)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := rapi.OpenRepository(globalOptions)
+	if err != nil {
+		return nil, err
+	}
+	repoID = repo.Config().ID
+
+	docs, err := searchDocuments("repository_id:" + repoID)
+	if err != nil {
+		return nil, err
+	}
+	songs := []*similarSong{}
+	for _, d := range docs {
+		songs = append(songs, newSimilarSong(d))
+	}
+	return songs, nil
+}
+
+func printSimilarity(song *similarSong, sim similarity) {
+	fmt.Printf("%s %s\n", colorize(fmt.Sprintf("%.2f", sim.score()), headerColor), songName(song.doc))
+	fmt.Printf("     ID: %s\n", song.doc.id)
+	fmt.Printf("     blobs %.2f, tags %.2f\n", sim.blobs, sim.tags)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/blugelabs/bluge"
+	"github.com/rubiojr/rindex"
+	"github.com/urfave/cli/v2"
+)
+
+func init() {
+	cmd := &cli.Command{
+		Name:      "tag",
+		Usage:     "Correct the tags of songs, without changing them in the repository",
+		ArgsUsage: "[song ID...]",
+		Action:    tagCmd,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "artist",
+				Usage: "Set the artist",
+			},
+			&cli.StringFlag{
+				Name:  "title",
+				Usage: "Set the title",
+			},
+			&cli.StringFlag{
+				Name:  "album",
+				Usage: "Set the album",
+			},
+			&cli.StringFlag{
+				Name:  "album-artist",
+				Usage: "Set the album artist",
+			},
+			&cli.StringFlag{
+				Name:  "genre",
+				Usage: "Set the genre",
+			},
+			&cli.IntFlag{
+				Name:  "year",
+				Usage: "Set the year",
+			},
+			&cli.BoolFlag{
+				Name:  "clear",
+				Usage: "Restore the tags read from the songs",
+			},
+			&cli.StringFlag{
+				Name:    "query",
+				Aliases: []string{"q"},
+				Usage:   "Tag every song found by `QUERY`",
+			},
+		},
+	}
+	appCommands = append(appCommands, cmd)
+}
+
+// tagFlags are the rplay tag flags setting each song field.
+var tagFlags = map[string]string{
+	"artist":       "artist",
+	"title":        "title",
+	"album":        "album",
+	"album-artist": "album_artist",
+	"genre":        "genre",
+	"year":         "year",
+}
+
+func tagCmd(c *cli.Context) error {
+	initApp()
+
+	tags := map[string]string{}
+	for flag, field := range tagFlags {
+		if c.IsSet(flag) {
+			tags[field] = c.String(flag)
+		}
+	}
+	if y, ok := tags["year"]; ok {
+		if _, err := strconv.Atoi(y); err != nil {
+			return fmt.Errorf("invalid year %s", y)
+		}
+	}
+	clear := c.Bool("clear")
+	if len(tags) == 0 && !clear {
+		return errors.New("nothing to change, set a tag or --clear")
+	}
+	q := c.String("query")
+	if c.NArg() == 0 && q == "" {
+		return errors.New("no songs to tag, pass their IDs or --query")
+	}
+
+	// Fail fast if index does not exist
+	reader, err := bluge.OpenReader(blugeConf)
+	if err != nil {
+		return errNeedsIndex
+	}
+	reader.Close()
+
+	idx, err = rindex.New(indexPath, globalOptions.Repo, globalOptions.Password)
+	if err != nil {
+		return err
+	}
+
+	docs := []*storedDocument{}
+	for _, id := range c.Args().Slice() {
+		found, err := searchDocuments("_id:" + id)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("song %s not found", id)
+		}
+		docs = append(docs, found...)
+	}
+	if q != "" {
+		found, err := searchDocuments(q)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, found...)
+	}
+
+	store, err := openOverrides()
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	changed := []*storedDocument{}
+	for _, d := range docs {
+		ok, err := retag(store, d, tags, clear)
+		if err != nil {
+			return err
+		}
+		if ok {
+			changed = append(changed, d)
+			fmt.Printf("%s %s\n", colorize(d.id, headerColor), songName(d))
+		}
+	}
+	if err := updateDocuments(changed); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d songs tagged\n", len(changed))
+	return nil
+}
+
+// retag stores the tags set for a song and applies them to it, after
+// restoring the song tags if clearing. Returns true if the song changed.
+func retag(store *overrideStore, d *storedDocument, tags map[string]string, clear bool) (bool, error) {
+	current, err := store.get(d.id)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	if clear {
+		if err := store.remove(d.id); err != nil {
+			return false, err
+		}
+		current = nil
+		changed = clearOverrides(d)
+	}
+	if len(tags) == 0 {
+		return changed, nil
+	}
+
+	if current == nil {
+		current = map[string]string{}
+	}
+	for field, value := range tags {
+		current[field] = value
+	}
+	if err := store.set(d.id, current); err != nil {
+		return false, err
+	}
+	return overrideTags(d, tags) || changed, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	gap "github.com/muesli/go-app-paths"
+	"gopkg.in/ini.v1"
+)
+
+var configPath = defaultConfigPath()
+
+func defaultConfigPath() string {
+	scope := gap.NewScope(gap.User, "rplay")
+	path, err := scope.ConfigPath("config.ini")
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+// loadConfig reads the configuration file. Keys can be repeated to set
+// several values. A missing file is an empty configuration.
+func loadConfig() (*ini.File, error) {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return ini.Empty(), nil
+	}
+	return ini.LoadSources(ini.LoadOptions{AllowShadows: true}, configPath)
+}
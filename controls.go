@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const controlsHelp = "⌨️  space pause, ←/→ seek, n next, p previous, +/- volume, q quit"
+
+const (
+	seekStep      = 10 // seconds
+	volumeStep    = 10 // percent
+	maxVolume     = 200
+	defaultVolume = 100
+)
+
+type playerAction int
+
+const (
+	actionNone playerAction = iota
+	actionNext
+	actionPrevious
+	actionQuit
+)
+
+// playerControls holds the playback state changed by key presses and
+// signals while a song plays.
+type playerControls struct {
+	mu            sync.Mutex
+	cond          *sync.Cond
+	paused        bool
+	volume        int
+	seek          int
+	action        playerAction
+	cancel        context.CancelFunc
+	lastInterrupt time.Time
+}
+
+var controls = newPlayerControls()
+
+func newPlayerControls() *playerControls {
+	c := &playerControls{volume: defaultVolume}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// setupControls sends Ctrl-C and, when stdin is a terminal, key presses to
+// the player controls. The returned function stops reading keys and
+// restores the terminal state.
+func setupControls() func() {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for s := range sigc {
+			if s == syscall.SIGTERM {
+				controls.skip(actionQuit)
+				continue
+			}
+			controls.interrupt()
+		}
+	}()
+
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		return func() {}
+	}
+	restoreTerm, err := makeCbreak(fd)
+	if err != nil {
+		return func() {}
+	}
+	var once sync.Once
+	restore := func() {
+		once.Do(func() { restoreTerm() })
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer func() {
+			// leave the terminal usable if handling a key panics
+			if r := recover(); r != nil {
+				restore()
+				panic(r)
+			}
+		}()
+		controls.readKeys(os.Stdin, done)
+	}()
+	fmt.Fprintln(uiOut, controlsHelp)
+
+	return func() {
+		close(done)
+		<-stopped
+		restore()
+	}
+}
+
+// startSong resets the song state. cancel stops the song being played.
+func (c *playerControls) startSong(cancel context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancel = cancel
+	c.action = actionNone
+	c.seek = 0
+	c.paused = false
+}
+
+// skip stops the song being played, remembering what to do next.
+func (c *playerControls) skip(a playerAction) {
+	c.mu.Lock()
+	c.action = a
+	c.paused = false
+	cancel := c.cancel
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// interrupt handles Ctrl-C: once plays the next song, twice in a row quits.
+func (c *playerControls) interrupt() {
+	c.mu.Lock()
+	a := actionNext
+	if time.Since(c.lastInterrupt) < 2*time.Second {
+		a = actionQuit
+	}
+	c.lastInterrupt = time.Now()
+	c.mu.Unlock()
+
+	c.skip(a)
+}
+
+func (c *playerControls) lastAction() playerAction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.action
+}
+
+func (c *playerControls) togglePause() {
+	c.mu.Lock()
+	c.paused = !c.paused
+	paused := c.paused
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	if paused {
+		printStatus("⏸  Paused")
+	} else {
+		printStatus("▶️  Playing")
+	}
+}
+
+func (c *playerControls) changeVolume(delta int) {
+	c.mu.Lock()
+	c.volume += delta
+	if c.volume < 0 {
+		c.volume = 0
+	} else if c.volume > maxVolume {
+		c.volume = maxVolume
+	}
+	v := c.volume
+	c.mu.Unlock()
+
+	printStatus(fmt.Sprintf("🔊 Volume %d%%", v))
+}
+
+func (c *playerControls) requestSeek(seconds int) {
+	c.mu.Lock()
+	c.seek += seconds
+	c.mu.Unlock()
+}
+
+// takeSeek returns the pending seek in seconds and clears it.
+func (c *playerControls) takeSeek() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.seek
+	c.seek = 0
+	return s
+}
+
+func (c *playerControls) gain() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return float64(c.volume) / 100
+}
+
+// waitPlaying blocks while playback is paused.
+func (c *playerControls) waitPlaying() {
+	c.mu.Lock()
+	for c.paused {
+		c.cond.Wait()
+	}
+	c.mu.Unlock()
+}
+
+// readKeys applies the key presses read from r, a terminal in cbreak mode,
+// until done is closed or reading fails.
+func (c *playerControls) readKeys(r io.Reader, done <-chan struct{}) {
+	br := bufio.NewReader(r)
+	// reads time out returning io.EOF, to check if done
+	readByte := func() (byte, error) {
+		for {
+			select {
+			case <-done:
+				return 0, io.ErrClosedPipe
+			default:
+			}
+			if b, err := br.ReadByte(); err != io.EOF {
+				return b, err
+			}
+		}
+	}
+	for {
+		b, err := readByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case ' ':
+			c.togglePause()
+		case 'n':
+			c.skip(actionNext)
+		case 'p':
+			c.skip(actionPrevious)
+		case '+', '=':
+			c.changeVolume(volumeStep)
+		case '-':
+			c.changeVolume(-volumeStep)
+		case 'q':
+			c.skip(actionQuit)
+		case 3: // Ctrl-C
+			c.interrupt()
+		case 0x1b: // arrow keys, ESC [ A-D
+			if b, err := readByte(); err != nil || b != '[' {
+				continue
+			}
+			b, err := readByte()
+			if err != nil {
+				return
+			}
+			switch b {
+			case 'A':
+				c.changeVolume(volumeStep)
+			case 'B':
+				c.changeVolume(-volumeStep)
+			case 'C':
+				c.requestSeek(seekStep)
+			case 'D':
+				c.requestSeek(-seekStep)
+			}
+		}
+	}
+}
+
+// seekError is returned by controlledReader when seeking backwards, the
+// song has to be played again from the beginning and skip frame frames.
+type seekError struct {
+	frame int64
+}
+
+func (e *seekError) Error() string {
+	return fmt.Sprintf("seeking to %s", formatDuration(e.frame))
+}
+
+// controlledReader applies the player controls (pause, seek and volume) to
+// a stream of 16 bit stereo samples at the output sample rate.
+type controlledReader struct {
+	r   io.Reader
+	c   *playerControls
+	pos int64
+}
+
+func newControlledReader(r io.Reader, c *playerControls) *controlledReader {
+	return &controlledReader{r: r, c: c}
+}
+
+func (cr *controlledReader) Read(p []byte) (int, error) {
+	cr.c.waitPlaying()
+
+	if s := cr.c.takeSeek(); s != 0 {
+		target := cr.pos + int64(s*outputSampleRate)
+		if target < 0 {
+			target = 0
+		}
+		if target < cr.pos {
+			return 0, &seekError{frame: target}
+		}
+		if err := cr.skipTo(target); err != nil {
+			return 0, err
+		}
+		printStatus(fmt.Sprintf("⏩ %s", formatDuration(target)))
+	}
+
+	// whole frames only, so samples are never split
+	n, err := io.ReadFull(cr.r, p[:len(p)&^3])
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	cr.pos += int64(n / 4)
+	applyGain(p[:n], cr.c.gain())
+
+	return n, err
+}
+
+// skipTo discards the frames before frame.
+func (cr *controlledReader) skipTo(frame int64) error {
+	if frame <= cr.pos {
+		return nil
+	}
+	n, err := io.CopyN(ioutil.Discard, cr.r, (frame-cr.pos)*4)
+	cr.pos += n / 4
+	return err
+}
+
+func applyGain(p []byte, gain float64) {
+	if gain == 1 {
+		return
+	}
+	for i := 0; i+1 < len(p); i += 2 {
+		s := float64(int16(uint16(p[i]) | uint16(p[i+1])<<8))
+		v := clipSample(s * gain)
+		p[i] = uint8(v)
+		p[i+1] = uint8(v >> 8)
+	}
+}
+
+func formatDuration(frames int64) string {
+	secs := frames / outputSampleRate
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+func printStatus(s string) {
+	fmt.Fprintf(uiOut, "\r\033[K%s", s)
+}
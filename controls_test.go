@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadKeysStops(t *testing.T) {
+	c := newPlayerControls()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		// the reader returns io.EOF once the keys are read, like a
+		// terminal read timing out
+		c.readKeys(strings.NewReader("\x1b[C\x1b[C"), done)
+		close(stopped)
+	}()
+
+	seek := 0
+	for deadline := time.Now().Add(5 * time.Second); seek < 2*seekStep && time.Now().Before(deadline); {
+		seek += c.takeSeek()
+		time.Sleep(time.Millisecond)
+	}
+	if seek != 2*seekStep {
+		t.Errorf("unexpected seek %d", seek)
+	}
+
+	close(done)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readKeys didn't stop")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/blugelabs/bluge"
+	"github.com/blugelabs/bluge/search"
+	"github.com/rubiojr/rindex"
+)
+
+// indexMu serializes the use of the index, the player looks up and
+// updates songs in the background.
+var indexMu sync.Mutex
+
+// Stored fields that aren't indexed as text. Everything else is a text
+// field, as added by rindex and MP3DocumentBuilder.
+var numericFields = map[string]bool{
+	"size":             true,
+	"year":             true,
+	"original_year":    true,
+	"track":            true,
+	"disc":             true,
+	"duration":         true,
+	"bitrate":          true,
+	"sample_rate":      true,
+	"channels":         true,
+	fieldTrackGain:     true,
+	fieldTrackPeak:     true,
+	fieldAlbumGain:     true,
+	fieldAlbumPeak:     true,
+	fieldLoudness:      true,
+	fieldAlbumLoudness: true,
+}
+
+var dateTimeFields = map[string]bool{
+	"mtime":         true,
+	"snapshot_time": true,
+}
+
+var keywordFields = map[string]bool{
+	"codec":         true,
+	"snapshot_id":   true,
+	"snapshot_tags": true,
+
+	fieldRecordingID:    true,
+	fieldReleaseID:      true,
+	fieldReleaseGroupID: true,
+	fieldArtistID:       true,
+}
+
+// storedDocument holds the stored fields of an indexed song, so they can be
+// changed and the song indexed again.
+type storedDocument struct {
+	id     string
+	fields map[string][][]byte
+}
+
+// searchDocuments returns the stored fields of the songs matching query.
+func searchDocuments(query string) ([]*storedDocument, error) {
+	docs := []*storedDocument{}
+	doc := &storedDocument{fields: map[string][][]byte{}}
+	_, err := searchIndex(query, func(field string, value []byte) bool {
+		return doc.visitField(field, value)
+	}, func() bool {
+		docs = append(docs, doc)
+		doc = &storedDocument{fields: map[string][][]byte{}}
+		return true
+	})
+
+	return docs, err
+}
+
+// readDocuments returns the stored fields of the songs found by a search.
+func readDocuments(iter search.DocumentMatchIterator) ([]*storedDocument, error) {
+	docs := []*storedDocument{}
+	match, err := iter.Next()
+	for err == nil && match != nil {
+		doc := &storedDocument{fields: map[string][][]byte{}}
+		if err := match.VisitStoredFields(doc.visitField); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+		match, err = iter.Next()
+	}
+	return docs, err
+}
+
+// visitField adds a stored field read from the index.
+func (d *storedDocument) visitField(field string, value []byte) bool {
+	v := make([]byte, len(value))
+	copy(v, value)
+	if field == "_id" {
+		d.id = string(v)
+	} else {
+		d.fields[field] = append(d.fields[field], v)
+	}
+	return true
+}
+
+func (d *storedDocument) text(field string) string {
+	if v, ok := d.fields[field]; ok {
+		return string(v[0])
+	}
+	return ""
+}
+
+func (d *storedDocument) number(field string) (float64, bool) {
+	v, ok := d.fields[field]
+	if !ok {
+		return 0, false
+	}
+	n, err := bluge.DecodeNumericFloat64(v[0])
+	return n, err == nil
+}
+
+func (d *storedDocument) setText(field, value string) {
+	d.fields[field] = [][]byte{[]byte(value)}
+}
+
+func (d *storedDocument) setNumber(field string, value float64) {
+	d.fields[field] = [][]byte{bluge.NewNumericField(field, value).Value()}
+}
+
+// document builds a bluge document from the stored fields.
+func (d *storedDocument) document() *bluge.Document {
+	doc := bluge.NewDocument(d.id)
+	for field, values := range d.fields {
+		for _, v := range values {
+			switch {
+			case numericFields[field]:
+				n, err := bluge.DecodeNumericFloat64(v)
+				if err != nil {
+					continue
+				}
+				doc.AddField(bluge.NewNumericField(field, n).StoreValue())
+			case keywordFields[field]:
+				doc.AddField(bluge.NewKeywordField(field, string(v)).StoreValue().Aggregatable())
+			case dateTimeFields[field]:
+				t, err := bluge.DecodeDateTime(v)
+				if err != nil {
+					continue
+				}
+				doc.AddField(bluge.NewDateTimeField(field, t).StoreValue())
+			default:
+				doc.AddField(bluge.NewTextField(field, string(v)).StoreValue())
+			}
+		}
+	}
+	doc.AddField(bluge.NewCompositeFieldExcluding("_all", nil))
+
+	return doc
+}
+
+// storedFields returns the stored fields of a document built to be
+// indexed.
+func storedFields(doc *bluge.Document) *storedDocument {
+	d := &storedDocument{fields: map[string][][]byte{}}
+	for _, f := range *doc {
+		switch {
+		case !f.Store():
+			continue
+		case f.Name() == "_id":
+			d.id = string(f.Value())
+		default:
+			d.fields[f.Name()] = append(d.fields[f.Name()], f.Value())
+		}
+	}
+	return d
+}
+
+// searchIndex searches the index, see rindex.Indexer.Search.
+func searchIndex(query string, fv rindex.FieldVisitor, sv rindex.SearchResultVisitor) (uint64, error) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	return idx.Search(query, fv, sv)
+}
+
+// updateDocuments replaces the indexed songs with docs.
+func updateDocuments(docs []*storedDocument) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	for _, d := range docs {
+		if err := idx.IndexEngine.Index(d.document()); err != nil {
+			idx.IndexEngine.Close()
+			return err
+		}
+	}
+	return idx.IndexEngine.Close()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/rubiojr/rindex"
+	"github.com/rubiojr/rindex/blugeindex"
+)
+
+// The player looks up and updates songs while preparing the next one,
+// run with -race.
+func TestConcurrentIndexAccess(t *testing.T) {
+	defer func(i rindex.Indexer) { idx = i }(idx)
+	idx = rindex.Indexer{IndexEngine: blugeindex.NewBlugeIndex(t.TempDir(), 0)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d := &storedDocument{id: fmt.Sprintf("song%d", i), fields: map[string][][]byte{}}
+			d.setText("title", "Song")
+			for j := 0; j < 5; j++ {
+				d.setNumber("track", float64(j))
+				if err := updateDocuments([]*storedDocument{d}); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := searchDocuments("_id:" + d.id); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	docs, err := searchDocuments("title:song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 4 {
+		t.Errorf("expected 4 songs, got %d", len(docs))
+	}
+}
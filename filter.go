@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/h2non/filetype"
+	"gopkg.in/ini.v1"
+)
+
+// audioExtensions are the songs indexed when no include patterns are given.
+var audioExtensions = []string{
+	"mp3", "flac", "ogg", "opus", "m4a", "wav", "aiff", "aif", "wma",
+}
+
+// audioFilter decides which files are indexed from their path and,
+// optionally, their contents. Matching is case-insensitive.
+type audioFilter struct {
+	include []pathMatcher
+	exclude []pathMatcher
+	// also index files with audio contents and an unknown extension
+	magic bool
+}
+
+type pathMatcher func(path string) bool
+
+// globMatcher matches the file name, or the whole path when the pattern
+// has a path separator.
+func globMatcher(pattern string) (pathMatcher, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+
+	return func(path string) bool {
+		path = strings.ToLower(path)
+		if !strings.Contains(pattern, "/") {
+			path = filepath.Base(path)
+		}
+		ok, _ := filepath.Match(pattern, path)
+		return ok
+	}, nil
+}
+
+func regexpMatcher(expr string) (pathMatcher, error) {
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+// filterPatterns are the patterns used to build an audioFilter.
+type filterPatterns struct {
+	include      []string
+	exclude      []string
+	includeRegex []string
+	excludeRegex []string
+	magic        bool
+}
+
+// patternsFromConfig reads the patterns from the [index] section of the
+// configuration file.
+func patternsFromConfig(cfg *ini.File) filterPatterns {
+	s := cfg.Section("index")
+	values := func(key string) []string {
+		if !s.HasKey(key) {
+			return nil
+		}
+		return s.Key(key).ValueWithShadows()
+	}
+
+	return filterPatterns{
+		include:      values("include"),
+		exclude:      values("exclude"),
+		includeRegex: values("include_regex"),
+		excludeRegex: values("exclude_regex"),
+		magic:        s.Key("magic").MustBool(false),
+	}
+}
+
+func newAudioFilter(p filterPatterns) (*audioFilter, error) {
+	f := &audioFilter{magic: p.magic}
+
+	add := func(list *[]pathMatcher, patterns []string, m func(string) (pathMatcher, error)) error {
+		for _, p := range patterns {
+			matcher, err := m(p)
+			if err != nil {
+				return err
+			}
+			*list = append(*list, matcher)
+		}
+		return nil
+	}
+
+	include := p.include
+	if len(include) == 0 && len(p.includeRegex) == 0 {
+		for _, ext := range audioExtensions {
+			include = append(include, "*."+ext)
+		}
+	}
+	if err := add(&f.include, include, globMatcher); err != nil {
+		return nil, err
+	}
+	if err := add(&f.include, p.includeRegex, regexpMatcher); err != nil {
+		return nil, err
+	}
+	if err := add(&f.exclude, p.exclude, globMatcher); err != nil {
+		return nil, err
+	}
+	if err := add(&f.exclude, p.excludeRegex, regexpMatcher); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *audioFilter) excluded(path string) bool {
+	for _, m := range f.exclude {
+		if m(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldIndex returns true if the path matches the include patterns and
+// none of the exclude ones.
+func (f *audioFilter) ShouldIndex(path string) bool {
+	if f.excluded(path) {
+		return false
+	}
+	for _, m := range f.include {
+		if m(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayBeAudio returns true if the contents of the file have to be checked
+// to know if it's a song.
+func (f *audioFilter) mayBeAudio(path string) bool {
+	return f.magic && !f.excluded(path)
+}
+
+// isAudio returns true if head, the beginning of a file, looks like audio.
+func isAudio(head []byte) bool {
+	return filetype.IsAudio(head)
+}
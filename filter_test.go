@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestAudioFilter(t *testing.T) {
+	f, err := newAudioFilter(filterPatterns{
+		exclude:      []string{"/music/podcasts/*"},
+		excludeRegex: []string{`\bdemo\b`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"/music/song.mp3":             true,
+		"/music/SONG.MP3":             true,
+		"/music/song.Opus":            true,
+		"/music/song.aiff":            true,
+		"/music/cover.jpg":            false,
+		"/music/podcasts/ep1.mp3":     false,
+		"/music/band - Demo tape.ogg": false,
+	}
+	for path, want := range tests {
+		if got := f.ShouldIndex(path); got != want {
+			t.Errorf("%s: expected %t, got %t", path, want, got)
+		}
+	}
+}
+
+func TestAudioFilterInclude(t *testing.T) {
+	f, err := newAudioFilter(filterPatterns{
+		include:      []string{"*.flac"},
+		includeRegex: []string{`^/vinyl/.*\.wav$`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"/music/song.FLAC":  true,
+		"/music/song.mp3":   false,
+		"/vinyl/side a.WAV": true,
+		"/music/side a.wav": false,
+	}
+	for path, want := range tests {
+		if got := f.ShouldIndex(path); got != want {
+			t.Errorf("%s: expected %t, got %t", path, want, got)
+		}
+	}
+}
+
+func TestAudioFilterInvalid(t *testing.T) {
+	if _, err := newAudioFilter(filterPatterns{include: []string{"[a-"}}); err == nil {
+		t.Error("expected an error with an invalid glob")
+	}
+	if _, err := newAudioFilter(filterPatterns{excludeRegex: []string{"(a"}}); err == nil {
+		t.Error("expected an error with an invalid regex")
+	}
+}
+
+func TestPatternsFromConfig(t *testing.T) {
+	cfg, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true}, []byte(`
+[index]
+exclude = *.wma
+exclude = /music/podcasts/*
+include_regex = \.mp3$
+magic = true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := patternsFromConfig(cfg)
+	if len(p.exclude) != 2 || p.exclude[1] != "/music/podcasts/*" {
+		t.Errorf("expected repeated keys to add patterns, got %v", p.exclude)
+	}
+	if len(p.include) != 0 || len(p.includeRegex) != 1 || !p.magic {
+		t.Errorf("unexpected patterns %+v", p)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+
+	"github.com/rubiojr/rplay/internal/flac"
+)
+
+// Left and right downmix weights for multi-channel FLAC streams, indexed by
+// channel count, in FLAC channel order.
+var flacDownmix = map[int][][2]float64{
+	// L R C
+	3: {{1, 0}, {0, 1}, {0.707, 0.707}},
+	// FL FR BL BR
+	4: {{1, 0}, {0, 1}, {0.707, 0}, {0, 0.707}},
+	// FL FR C BL BR
+	5: {{1, 0}, {0, 1}, {0.707, 0.707}, {0.707, 0}, {0, 0.707}},
+	// FL FR C LFE BL BR
+	6: {{1, 0}, {0, 1}, {0.707, 0.707}, {0, 0}, {0.707, 0}, {0, 0.707}},
+	// FL FR C LFE BC SL SR
+	7: {{1, 0}, {0, 1}, {0.707, 0.707}, {0, 0}, {0.5, 0.5}, {0.707, 0}, {0, 0.707}},
+	// FL FR C LFE BL BR SL SR
+	8: {{1, 0}, {0, 1}, {0.707, 0.707}, {0, 0}, {0.707, 0}, {0, 0.707}, {0.707, 0}, {0, 0.707}},
+}
+
+// flacReader converts decoded FLAC frames to 16 bit little endian stereo
+// samples, the format the audio output expects.
+type flacReader struct {
+	d   *flac.Decoder
+	buf []byte
+	out []byte
+}
+
+func NewReaderFromFLACDecoder(d *flac.Decoder) io.Reader {
+	return &flacReader{d: d}
+}
+
+func (f *flacReader) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		frame, err := f.d.Next()
+		if err != nil {
+			return 0, err
+		}
+		f.buf = f.convert(frame)
+	}
+
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+func (f *flacReader) convert(frame *flac.Frame) []byte {
+	size := frame.BlockSize * 4
+	if cap(f.out) < size {
+		f.out = make([]byte, size)
+	}
+	out := f.out[:size]
+
+	s := frame.Samples
+	shift := frame.BitsPerSample - 16
+	for i := 0; i < frame.BlockSize; i++ {
+		var l, r int32
+		switch len(s) {
+		case 1:
+			l = scaleSample(s[0][i], shift)
+			r = l
+		case 2:
+			l = scaleSample(s[0][i], shift)
+			r = scaleSample(s[1][i], shift)
+		default:
+			l, r = downmix(s, i, shift)
+		}
+		out[4*i] = uint8(l)
+		out[4*i+1] = uint8(l >> 8)
+		out[4*i+2] = uint8(r)
+		out[4*i+3] = uint8(r >> 8)
+	}
+
+	return out
+}
+
+func scaleSample(v int32, shift int) int32 {
+	if shift > 0 {
+		return v >> uint(shift)
+	}
+	return v << uint(-shift)
+}
+
+func downmix(s [][]int32, i, shift int) (int32, int32) {
+	weights, ok := flacDownmix[len(s)]
+	if !ok {
+		return scaleSample(s[0][i], shift), scaleSample(s[1][i], shift)
+	}
+
+	var l, r, lw, rw float64
+	for ch, w := range weights {
+		v := float64(scaleSample(s[ch][i], shift))
+		l += v * w[0]
+		r += v * w[1]
+		lw += w[0]
+		rw += w[1]
+	}
+
+	return int32(l / lw), int32(r / rw)
+}
@@ -11,6 +11,7 @@ require (
 	github.com/Sereal/Sereal v0.0.0-20200820125258-a016b7cda3f3 // indirect
 	github.com/asdine/storm v2.1.2+incompatible
 	github.com/blugelabs/bluge v0.1.4-0.20201021190638-c304a6733af6
+	github.com/blugelabs/query_string v0.1.0
 	github.com/briandowns/spinner v1.11.1
 	github.com/dgryski/go-metro v0.0.0-20200812162917-85c65e2d0165 // indirect
 	github.com/dhowden/tag v0.0.0-20201120070457-d52dcb253c63
@@ -28,20 +29,21 @@ require (
 	github.com/pkg/xattr v0.4.2 // indirect
 	github.com/rubiojr/rapi v0.0.0-20201123145704-4dcc4cc7dde0
 	github.com/rubiojr/rindex v0.0.0-20201128155201-37ee8d28d522
+	github.com/syndtr/goleveldb v1.0.0
 	github.com/tinylib/msgp v1.1.3 // indirect
 	github.com/urfave/cli/v2 v2.2.0
 	github.com/vmihailenco/msgpack v4.0.4+incompatible // indirect
 	github.com/willf/bitset v1.1.11 // indirect
-	go.etcd.io/bbolt v1.3.5 // indirect
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897 // indirect
 	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b // indirect
 	golang.org/x/oauth2 v0.0.0-20201109201403-9fd604954f58 // indirect
-	golang.org/x/sys v0.0.0-20201109165425-215b40eba54c // indirect
+	golang.org/x/sys v0.0.0-20201109165425-215b40eba54c
 	golang.org/x/text v0.3.4 // indirect
 	golang.org/x/tools v0.0.0-20201110030525-169ad6d6ecb2 // indirect
 	google.golang.org/api v0.35.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20201109203340-2640f1f9cdfb // indirect
 	google.golang.org/grpc v1.33.2 // indirect
-	gopkg.in/ini.v1 v1.62.0 // indirect
+	gopkg.in/ini.v1 v1.62.0
 )
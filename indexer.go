@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/blugelabs/bluge"
+	"github.com/rubiojr/rapi/repository"
+	"github.com/rubiojr/rapi/restic"
+	"github.com/rubiojr/rapi/walker"
+	"github.com/rubiojr/rindex"
+	"github.com/rubiojr/rindex/blugeindex"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	lopt "github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// songIndexer walks the repository snapshots indexing songs. Documents and
+// caches are compatible with the ones created by rindex, whose Index can't
+// be used: its Filter only gets the path, so files can't be checked for
+// audio contents, the DocumentBuilder doesn't get the path to infer tags
+// from, snapshots can't be selected and songs indexed before aren't
+// reported, to record where else they are.
+type songIndexer struct {
+	engine  *blugeindex.BlugeIndex
+	filter  *audioFilter
+	scope   *snapshotScope
+	reindex bool
+	builder MP3DocumentBuilder
+
+	// songs indexed
+	songs *leveldb.DB
+	// songs visited during this run
+	visited *leveldb.DB
+	// snapshots indexed
+	snapshots *leveldb.DB
+	// snapshots whose song locations are recorded, the ones indexed
+	// before locations were recorded aren't
+	located *leveldb.DB
+	// files checked for audio contents that aren't songs
+	notAudio *leveldb.DB
+	// every location of the songs
+	locations *locationStore
+	// only record the locations of the songs indexed, while walking a
+	// snapshot indexed before
+	locateOnly bool
+	// snapshots of the songs found again, by song ID, added to the songs
+	// once the snapshots are walked
+	seen map[string]*songSnapshots
+
+	stats rindex.IndexStats
+}
+
+func newSongIndexer(engine *blugeindex.BlugeIndex, f *audioFilter, scope *snapshotScope, reindex bool) (*songIndexer, error) {
+	i := &songIndexer{engine: engine, filter: f, scope: scope, reindex: reindex, seen: map[string]*songSnapshots{}}
+	i.stats.Errors = []error{}
+
+	cacheDir := filepath.Join(filepath.Dir(engine.IndexPath), "cache")
+	os.MkdirAll(cacheDir, 0755)
+	// songs visited are only remembered during this run
+	if err := os.RemoveAll(filepath.Join(cacheDir, "idtmp.cache")); err != nil {
+		return nil, err
+	}
+	o := &lopt.Options{
+		Filter: filter.NewBloomFilter(10),
+		NoSync: true,
+	}
+	caches := map[string]**leveldb.DB{
+		"id.cache":       &i.songs,
+		"idtmp.cache":    &i.visited,
+		"snap.cache":     &i.snapshots,
+		"locsnap.cache":  &i.located,
+		"notaudio.cache": &i.notAudio,
+	}
+	var err error
+	for name, db := range caches {
+		if *db, err = leveldb.OpenFile(filepath.Join(cacheDir, name), o); err != nil {
+			i.close()
+			return nil, err
+		}
+	}
+	if i.locations, err = openLocations(); err != nil {
+		i.close()
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// index indexes the songs in the snapshots in scope, skipping the ones
+// indexed before unless reindexing.
+func (i *songIndexer) index(ctx context.Context, repo *repository.Repository, snapshots []*restic.Snapshot, progress chan rindex.IndexStats) (rindex.IndexStats, error) {
+	snapshots, err := i.scope.selectSnapshots(snapshots)
+	if err != nil {
+		i.engine.Close()
+		return i.stats, err
+	}
+
+	for _, sn := range snapshots {
+		key := i.snapshotKey(sn)
+		_, err := i.snapshots.Get(key, nil)
+		indexed := err == nil && !i.reindex
+		if _, err := i.located.Get(key, nil); err == nil && indexed {
+			continue
+		}
+		i.locateOnly = indexed
+		i.stats.ScannedSnapshots++
+		if err := i.walkSnapshot(ctx, repo, sn, progress); err != nil {
+			i.stats.Errors = append(i.stats.Errors, err)
+			continue
+		}
+		for _, db := range []*leveldb.DB{i.snapshots, i.located} {
+			if err := db.Put(key, []byte{}, nil); err != nil {
+				i.stats.Errors = append(i.stats.Errors, err)
+			}
+		}
+	}
+
+	if err := i.addSnapshots(); err != nil {
+		i.engine.Close()
+		return i.stats, err
+	}
+	return i.stats, i.engine.Close()
+}
+
+// addSnapshots adds the snapshots songs indexed before were found in to
+// their snapshot_time and snapshot_tags fields.
+func (i *songIndexer) addSnapshots() error {
+	if len(i.seen) == 0 {
+		return nil
+	}
+	// writes the songs indexed so far
+	if err := i.engine.Close(); err != nil {
+		return err
+	}
+	reader, err := i.engine.OpenReader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for id, snapshots := range i.seen {
+		iter, err := i.engine.SearchWithReaderAndQuery("_id:"+id, reader)
+		if err != nil {
+			return err
+		}
+		docs, err := readDocuments(iter)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 || !snapshots.addTo(docs[0]) {
+			continue
+		}
+		if err := i.engine.Index(docs[0].document()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotKey identifies the snapshot in the cache of indexed snapshots.
+// Snapshots indexed with a path scope are cached apart from the fully
+// indexed ones.
+func (i *songIndexer) snapshotKey(sn *restic.Snapshot) []byte {
+	key := append([]byte{}, sn.ID()[:]...)
+	if scope := i.scope.key(); scope != "" {
+		key = append(key, scope...)
+	}
+	return key
+}
+
+func (i *songIndexer) walkSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, progress chan rindex.IndexStats) error {
+	if sn.Tree == nil {
+		return fmt.Errorf("snapshot %v has no tree", sn.ID().Str())
+	}
+
+	return walker.Walk(ctx, repo, *sn.Tree, nil, func(parentTreeID restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading tree %v: %v\n", parentTreeID, err)
+			return false, walker.ErrSkipNode
+		}
+		if node != nil && node.Type == "dir" && !i.scope.walksPath(nodepath) {
+			return false, walker.ErrSkipNode
+		}
+
+		i.scanNode(repo, sn, node, nodepath)
+		select {
+		case progress <- i.stats:
+		default:
+		}
+		return true, nil
+	})
+}
+
+func (i *songIndexer) scanNode(repo *repository.Repository, sn *restic.Snapshot, node *restic.Node, nodepath string) {
+	if node == nil {
+		return
+	}
+	i.stats.ScannedNodes++
+	if node.Type != "file" {
+		return
+	}
+	i.stats.ScannedFiles++
+
+	if !i.scope.includesFile(nodepath) {
+		i.stats.Mismatch++
+		return
+	}
+	matched := i.filter.ShouldIndex(nodepath)
+	if !matched && (!i.filter.mayBeAudio(nodepath) || len(node.Content) == 0) {
+		i.stats.Mismatch++
+		return
+	}
+
+	fileIDBytes := nodeFileID(node)
+	if !i.needsIndexing(fileIDBytes) {
+		i.stats.AlreadyIndexed++
+		i.addLocation(repo, sn, fileIDBytes, nodepath)
+		i.addSeen(hex.EncodeToString(fileIDBytes), sn)
+		return
+	}
+	if i.locateOnly {
+		return
+	}
+
+	blobs := newSongBlobs(repo, node)
+	if !matched {
+		if _, err := i.notAudio.Get(fileIDBytes, nil); err == nil {
+			i.stats.Mismatch++
+			return
+		}
+		head, err := blobs.blob(0)
+		if err != nil {
+			i.stats.Errors = append(i.stats.Errors, err)
+			return
+		}
+		if !isAudio(head) {
+			i.stats.Mismatch++
+			if err := i.notAudio.Put(fileIDBytes, []byte{}, nil); err != nil {
+				i.stats.Errors = append(i.stats.Errors, err)
+			}
+			return
+		}
+	}
+
+	packed, err := marshalBlobIDs(node.Content, repo.Index())
+	if err != nil {
+		i.stats.Errors = append(i.stats.Errors, err)
+		return
+	}
+	i.stats.LastMatch = node.Name
+	doc := i.builder.buildDocument(hex.EncodeToString(fileIDBytes), nodepath, blobs)
+	doc.AddField(bluge.NewTextField("blobs", packed).StoreValue()).
+		AddField(bluge.NewTextField("filename", node.Name).StoreValue()).
+		AddField(bluge.NewTextField("repository_id", repo.Config().ID).StoreValue()).
+		AddField(bluge.NewTextField("path", nodepath).StoreValue()).
+		AddField(bluge.NewTextField("hostname", sn.Hostname).StoreValue()).
+		AddField(bluge.NewDateTimeField("mtime", node.ModTime).StoreValue()).
+		AddField(bluge.NewNumericField("size", float64(node.Size)).StoreValue()).
+		AddField(bluge.NewKeywordField("snapshot_id", sn.ID().String()).StoreValue().Aggregatable()).
+		AddField(bluge.NewDateTimeField("snapshot_time", sn.Time).StoreValue())
+	for _, tag := range sn.Tags {
+		doc.AddField(bluge.NewKeywordField("snapshot_tags", tag).StoreValue().Aggregatable())
+	}
+	doc.AddField(bluge.NewCompositeFieldExcluding("_all", nil))
+
+	if err := i.engine.Index(doc); err != nil {
+		i.stats.Errors = append(i.stats.Errors, err)
+		return
+	}
+	i.stats.IndexedFiles++
+	if err := i.songs.Put(fileIDBytes, []byte{}, nil); err != nil {
+		i.stats.Errors = append(i.stats.Errors, err)
+	}
+	if err := i.visited.Put(fileIDBytes, []byte{}, nil); err != nil {
+		i.stats.Errors = append(i.stats.Errors, err)
+	}
+	i.addLocation(repo, sn, fileIDBytes, nodepath)
+}
+
+// needsIndexing is false for the songs visited during this run, and the
+// ones indexed before unless reindexing.
+func (i *songIndexer) needsIndexing(fileID []byte) bool {
+	if _, err := i.visited.Get(fileID, nil); err == nil {
+		return false
+	}
+	_, err := i.songs.Get(fileID, nil)
+	return err != nil || i.reindex
+}
+
+// addSeen records a snapshot a song indexed before is in.
+func (i *songIndexer) addSeen(id string, sn *restic.Snapshot) {
+	snapshots, ok := i.seen[id]
+	if !ok {
+		snapshots = &songSnapshots{tags: map[string]bool{}}
+		i.seen[id] = snapshots
+	}
+	snapshots.add(sn.Time, sn.Tags)
+}
+
+func (i *songIndexer) addLocation(repo *repository.Repository, sn *restic.Snapshot, fileID []byte, nodepath string) {
+	err := i.locations.add(fileID, &songLocation{
+		Repository: repo.Config().ID,
+		Host:       sn.Hostname,
+		Path:       nodepath,
+		Snapshot:   sn.ID().String(),
+		Time:       sn.Time,
+	})
+	if err != nil {
+		i.stats.Errors = append(i.stats.Errors, err)
+	}
+}
+
+func (i *songIndexer) close() {
+	for _, db := range []*leveldb.DB{i.songs, i.visited, i.snapshots, i.located, i.notAudio} {
+		if db != nil {
+			db.Close()
+		}
+	}
+	if i.locations != nil {
+		i.locations.close()
+	}
+}
+
+// nodeFileID returns the song ID, the hash of its contents.
+func nodeFileID(node *restic.Node) []byte {
+	var bb []byte
+	for _, c := range node.Content {
+		bb = append(bb, c[:]...)
+	}
+	sha := sha256.Sum256(bb)
+	return sha[:]
+}
+
+// marshalBlobIDs returns the location of the song blobs in the repository
+// packs, used to fetch the song.
+func marshalBlobIDs(ids restic.IDs, idx restic.MasterIndex) (string, error) {
+	pblist := []restic.PackedBlob{}
+	for _, id := range ids {
+		pblist = append(pblist, idx.Lookup(restic.BlobHandle{ID: id, Type: restic.DataBlob})...)
+	}
+	j, err := json.Marshal(pblist)
+	return string(j), err
+}
@@ -1,27 +1,39 @@
 package acoustid
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os/exec"
 	"strconv"
 	"strings"
 )
 
+// DefaultBaseURL is the AcoustID web service.
+const DefaultBaseURL = "https://api.acoustid.org/v2"
+
+var ErrMissingAPIKey = errors.New("AcoustID API key not set")
+
+var ErrFPCALCNotFound = errors.New("fpcalc not found")
+
 type Fingerprint struct {
 	fingerprint string
 	duration    int
+	// not set by fpcalc
+	raw []uint32
+}
+
+// Duration is the length of the fingerprinted song in seconds.
+func (f Fingerprint) Duration() int {
+	return f.duration
+}
+
+// String returns the compressed fingerprint, as sent to AcoustID.
+func (f Fingerprint) String() string {
+	return f.fingerprint
 }
 
-type AcoustIDRequest struct {
-	Fingerprint string `json:"fingerprint"`
-	Duration    int    `json:"duration"`
-	ApiKey      string `json:"client"`
-	Metadata    string `json:"meta"`
+// Raw returns the uncompressed fingerprint, nil when calculated by fpcalc.
+func (f Fingerprint) Raw() []uint32 {
+	return f.raw
 }
 
 type Result struct {
@@ -49,8 +61,9 @@ type Result struct {
 }
 
 type AcoustIDResponse struct {
-	Results []Result `json:"results"`
-	Status  string   `json:"status"`
+	Results []Result  `json:"results"`
+	Status  string    `json:"status"`
+	Error   *APIError `json:"error"`
 }
 
 func FindFPCALC() string {
@@ -62,12 +75,17 @@ func FindFPCALC() string {
 	return fpcalc
 }
 
+// NewFingerprint fingerprints a file with fpcalc, for the formats
+// NewFingerprintFromPCM can't be used with.
 func NewFingerprint(file string) (Fingerprint, error) {
 	var err error
 
 	fp := Fingerprint{}
 
 	fpcalc := FindFPCALC()
+	if fpcalc == "" {
+		return fp, ErrFPCALCNotFound
+	}
 
 	out, err := exec.Command(fpcalc, file).Output()
 	if err != nil {
@@ -86,56 +104,3 @@ func NewFingerprint(file string) (Fingerprint, error) {
 
 	return fp, nil
 }
-
-func MakeAcoustIDRequest(fp Fingerprint) (AcoustIDResponse, error) {
-	if ACOUSTID_API_KEY == "" {
-		return AcoustIDResponse{}, errors.New("invalid acoustid api key found")
-	}
-
-	request := AcoustIDRequest{
-		Fingerprint: fp.fingerprint,
-		Duration:    fp.duration,
-		ApiKey:      ACOUSTID_API_KEY,
-		Metadata:    "recordings+releasegroups+compress",
-	}
-
-	return request.do()
-}
-
-func (a *AcoustIDRequest) do() (AcoustIDResponse, error) {
-	client := http.Client{}
-	aidResp := AcoustIDResponse{}
-	pdata, err := a.postValues()
-	if err != nil {
-		return aidResp, err
-	}
-
-	response, err := client.PostForm("http://api.acoustid.org/v2/lookup", pdata)
-	if err != nil {
-		return aidResp, err
-	}
-	defer response.Body.Close()
-
-	body, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return aidResp, err
-	}
-
-	err = json.Unmarshal(body, &aidResp)
-	if err != nil {
-		return aidResp, err
-	}
-
-	return aidResp, nil
-}
-
-func (a *AcoustIDRequest) postValues() (url.Values, error) {
-	query := fmt.Sprintf(
-		"client=%s&duration=%d&meta=%s&fingerprint=%s",
-		a.ApiKey,
-		a.Duration,
-		a.Metadata,
-		a.Fingerprint)
-
-	return url.ParseQuery(query)
-}
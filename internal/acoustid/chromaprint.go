@@ -0,0 +1,236 @@
+package acoustid
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Chromaprint settings of the default algorithm, the one used by fpcalc.
+const (
+	// SampleRate is the rate audio is resampled to before fingerprinting.
+	SampleRate = 11025
+	// MaxDuration is the length, in seconds, of the audio fingerprinted
+	// from the start of a song, like fpcalc.
+	MaxDuration = 120
+
+	algorithm      = 1 // CHROMAPRINT_ALGORITHM_TEST2
+	frameSize      = 4096
+	frameIncrement = frameSize / 3
+	minFreq        = 28
+	maxFreq        = 3520
+	numBands       = 12
+	// size of the buffers passed to the resampler
+	resampleBufferSize = 1024 * 32
+)
+
+var chromaFilterCoefficients = []float64{0.25, 0.75, 1.0, 0.75, 0.25}
+
+// chromaprint fingerprints mono 16 bit audio, fed a chunk at a time.
+type chromaprint struct {
+	resampler   *avResampler
+	pending     []int16
+	resampled   []int16
+	frame       []int16
+	spectrum    *powerSpectrum
+	power       []float64
+	notes       []int
+	chroma      [][]float64
+	chromaCount int
+	image       integralImage
+	fingerprint []uint32
+}
+
+func newChromaprint(sampleRate int) *chromaprint {
+	c := &chromaprint{
+		spectrum: newPowerSpectrum(frameSize),
+		power:    make([]float64, frameSize/2+1),
+		chroma:   make([][]float64, 8),
+	}
+	if sampleRate != SampleRate {
+		c.resampler = newAVResampler(SampleRate, sampleRate)
+		c.resampled = make([]int16, resampleBufferSize)
+	}
+
+	// chroma band of each FFT bin, -1 if it's out of the range used
+	c.notes = make([]int, frameSize/2+1)
+	for i := range c.notes {
+		c.notes[i] = -1
+	}
+	minIndex := max(1, freqToIndex(minFreq))
+	maxIndex := min(frameSize/2, freqToIndex(maxFreq))
+	for i := minIndex; i < maxIndex; i++ {
+		freq := float64(i) * SampleRate / frameSize
+		octave := math.Log(freq/(440.0/16)) / math.Log(2)
+		c.notes[i] = int(numBands * (octave - math.Floor(octave)))
+	}
+	return c
+}
+
+func freqToIndex(freq float64) int {
+	return int(math.Round(frameSize * freq / SampleRate))
+}
+
+// consume adds mono samples at the input sample rate.
+func (c *chromaprint) consume(samples []int16) {
+	if c.resampler == nil {
+		c.addSamples(samples)
+		return
+	}
+	for len(samples) > 0 {
+		n := min(len(samples), resampleBufferSize-len(c.pending))
+		c.pending = append(c.pending, samples[:n]...)
+		samples = samples[n:]
+		if len(c.pending) == resampleBufferSize {
+			c.resample()
+		}
+	}
+}
+
+func (c *chromaprint) resample() {
+	written, consumed := c.resampler.resample(c.resampled, c.pending)
+	c.addSamples(c.resampled[:written])
+	if consumed > len(c.pending) {
+		consumed = len(c.pending)
+	}
+	c.pending = append(c.pending[:0], c.pending[consumed:]...)
+}
+
+// addSamples adds samples at SampleRate, processing a frame every
+// frameIncrement samples.
+func (c *chromaprint) addSamples(samples []int16) {
+	for len(samples) > 0 {
+		n := min(len(samples), frameSize-len(c.frame))
+		c.frame = append(c.frame, samples[:n]...)
+		samples = samples[n:]
+		if len(c.frame) == frameSize {
+			c.processFrame()
+			c.frame = append(c.frame[:0], c.frame[frameIncrement:]...)
+		}
+	}
+}
+
+func (c *chromaprint) processFrame() {
+	c.spectrum.compute(c.frame, c.power)
+	features := make([]float64, numBands)
+	for i, note := range c.notes {
+		if note >= 0 {
+			features[note] += c.power[i]
+		}
+	}
+
+	// smooth the chroma over time, in a ring of the last 8 frames
+	c.chroma[c.chromaCount%8] = features
+	c.chromaCount++
+	taps := len(chromaFilterCoefficients)
+	if c.chromaCount < taps {
+		return
+	}
+	row := make([]float64, numBands)
+	for j, k := range chromaFilterCoefficients {
+		prev := c.chroma[(c.chromaCount-taps+j)%8]
+		for i := range row {
+			row[i] += prev[i] * k
+		}
+	}
+
+	norm := 0.0
+	for _, v := range row {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for i := range row {
+		if norm < 0.01 {
+			row[i] = 0
+		} else {
+			row[i] /= norm
+		}
+	}
+
+	c.image.addRow(row)
+	if rows := len(c.image.rows); rows >= maxFilterWidth {
+		c.fingerprint = append(c.fingerprint, subFingerprint(&c.image, rows-maxFilterWidth))
+	}
+}
+
+// finish processes what's left in the resampler and returns the raw
+// fingerprint.
+func (c *chromaprint) finish() []uint32 {
+	if c.resampler != nil && len(c.pending) > 0 {
+		c.resample()
+	}
+	return c.fingerprint
+}
+
+// NewFingerprintFromPCM calculates the fingerprint of signed 16 bit little
+// endian PCM audio, with channels interleaved, without calling fpcalc.
+// The first MaxDuration seconds are fingerprinted. duration is the length
+// of the audio in seconds, if it's 0 the whole audio is read to know it.
+func NewFingerprintFromPCM(pcm io.Reader, sampleRate, channels, duration int) (Fingerprint, error) {
+	if sampleRate <= 1000 || channels < 1 {
+		return Fingerprint{}, errors.New("unsupported audio format")
+	}
+
+	c := newChromaprint(sampleRate)
+	buf := make([]byte, 4096*2*channels)
+	mono := make([]int16, 4096)
+	limit := int64(MaxDuration * sampleRate)
+	var frames int64
+	for {
+		n, err := io.ReadFull(pcm, buf)
+		n -= n % (2 * channels)
+		count := n / (2 * channels)
+		if remaining := limit - frames; remaining > 0 {
+			if int64(count) > remaining {
+				count = int(remaining)
+			}
+			for i := 0; i < count; i++ {
+				sum := 0
+				for ch := 0; ch < channels; ch++ {
+					sum += int(int16(binary.LittleEndian.Uint16(buf[(i*channels+ch)*2:])))
+				}
+				mono[i] = int16(sum / channels)
+			}
+			c.consume(mono[:count])
+		}
+		frames += int64(n / (2 * channels))
+
+		if duration > 0 && frames >= limit {
+			break
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return Fingerprint{}, err
+		}
+	}
+
+	raw := c.finish()
+	if len(raw) == 0 {
+		return Fingerprint{}, errors.New("audio too short to fingerprint")
+	}
+	if duration == 0 {
+		duration = int(frames / int64(sampleRate))
+	}
+	return Fingerprint{
+		fingerprint: encodeFingerprint(raw, algorithm),
+		duration:    duration,
+		raw:         raw,
+	}, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,188 @@
+package acoustid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+// Cases from Chromaprint's fingerprint compressor tests.
+func TestCompressFingerprint(t *testing.T) {
+	tests := []struct {
+		raw  []uint32
+		want []byte
+	}{
+		{[]uint32{1}, []byte{0, 0, 0, 1, 1}},
+		{[]uint32{7}, []byte{0, 0, 0, 1, 73, 0}},
+		{[]uint32{1 << 6}, []byte{0, 0, 0, 1, 7, 0}},
+		{[]uint32{1 << 8}, []byte{0, 0, 0, 1, 7, 2}},
+		{[]uint32{1, 0}, []byte{0, 0, 0, 2, 65, 0}},
+	}
+	for _, tt := range tests {
+		if got := compressFingerprint(tt.raw, 0); !bytes.Equal(got, tt.want) {
+			t.Errorf("compressFingerprint(%v) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+
+	if fp := encodeFingerprint([]uint32{1}, algorithm); fp != "AQAAAQE" {
+		t.Errorf("unexpected encoded fingerprint %s", fp)
+	}
+}
+
+// pcm returns seconds of 16 bit stereo audio, the sum of sine waves at freqs
+// changing every half a second, plus some noise.
+func pcm(rate, seconds int, freqs [][]float64) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	buf := &bytes.Buffer{}
+	for i := 0; i < rate*seconds; i++ {
+		notes := freqs[(i*2/rate)%len(freqs)]
+		v := 0.0
+		for _, f := range notes {
+			v += math.Sin(2 * math.Pi * f * float64(i) / float64(rate))
+		}
+		s := int16(v/float64(len(notes))*8000 + rnd.NormFloat64()*200)
+		binary.Write(buf, binary.LittleEndian, [2]int16{s, s})
+	}
+	return buf.Bytes()
+}
+
+var melody = [][]float64{
+	{440, 554.37}, {523.25, 659.25}, {392, 493.88, 587.33}, {349.23, 440},
+	{329.63, 415.3}, {293.66, 369.99}, {261.63, 329.63, 392}, {246.94},
+}
+
+func TestChromaBands(t *testing.T) {
+	// bands start at A, notes are truncated so tones in the middle of
+	// each band are used
+	for _, tt := range []struct {
+		freq float64
+		band int
+	}{{452.9, 0}, {538.6, 3}, {905.8, 0}, {678.6, 7}, {1281.2, 6}} {
+		c := newChromaprint(SampleRate)
+		frame := make([]int16, frameSize)
+		for i := range frame {
+			frame[i] = int16(10000 * math.Sin(2*math.Pi*tt.freq*float64(i)/SampleRate))
+		}
+		c.spectrum.compute(frame, c.power)
+		features := make([]float64, numBands)
+		for i, note := range c.notes {
+			if note >= 0 {
+				features[note] += c.power[i]
+			}
+		}
+		best := 0
+		for i, v := range features {
+			if v > features[best] {
+				best = i
+			}
+		}
+		if best != tt.band {
+			t.Errorf("%.2f Hz is in band %d, want %d", tt.freq, best, tt.band)
+		}
+	}
+}
+
+func TestResampler(t *testing.T) {
+	r := newAVResampler(SampleRate, 44100)
+	src := make([]int16, 44100)
+	for i := range src {
+		src[i] = 1000
+	}
+	dst := make([]int16, len(src))
+	written, consumed := r.resample(dst, src)
+	if written < 11000 || written > SampleRate {
+		t.Errorf("unexpected resampled length %d", written)
+	}
+	if consumed > len(src) || consumed < len(src)-r.filterLength {
+		t.Errorf("unexpected consumed samples %d", consumed)
+	}
+	for i, s := range dst[:written] {
+		if s < 995 || s > 1005 {
+			t.Fatalf("sample %d is %d, the level should be kept", i, s)
+		}
+	}
+}
+
+func TestNewFingerprintFromPCM(t *testing.T) {
+	audio := pcm(SampleRate, 30, melody)
+	fp, err := NewFingerprintFromPCM(bytes.NewReader(audio), SampleRate, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Duration() != 30 {
+		t.Errorf("unexpected duration %d", fp.Duration())
+	}
+	frames := (30*SampleRate-frameSize)/frameIncrement + 1
+	if want := frames - len(chromaFilterCoefficients) + 1 - maxFilterWidth + 1; len(fp.Raw()) != want {
+		t.Errorf("got %d sub-fingerprints, want %d", len(fp.Raw()), want)
+	}
+	if fp.fingerprint[:4] != "AQAA" {
+		t.Errorf("unexpected fingerprint header %s", fp.fingerprint[:4])
+	}
+
+	again, _ := NewFingerprintFromPCM(bytes.NewReader(audio), SampleRate, 2, 0)
+	if again.fingerprint != fp.fingerprint {
+		t.Error("fingerprints should be deterministic")
+	}
+
+	// the same song at 44.1 kHz should give a close fingerprint
+	hifi, err := NewFingerprintFromPCM(bytes.NewReader(pcm(44100, 30, melody)), 44100, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ber := bitErrorRate(fp.Raw(), hifi.Raw()); ber > 0.15 {
+		t.Errorf("bit error rate %.2f between sample rates", ber)
+	}
+
+	other, _ := NewFingerprintFromPCM(bytes.NewReader(pcm(SampleRate, 30, melody[3:])), SampleRate, 2, 0)
+	if ber := bitErrorRate(fp.Raw(), other.Raw()); ber < 0.25 {
+		t.Errorf("bit error rate %.2f between different songs", ber)
+	}
+
+	if _, err := NewFingerprintFromPCM(bytes.NewReader(audio[:4000]), SampleRate, 2, 0); err == nil {
+		t.Error("expected an error for short audio")
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	audio := pcm(8000, MaxDuration+10, melody)
+	fp, err := NewFingerprintFromPCM(bytes.NewReader(audio), 8000, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Duration() != MaxDuration+10 {
+		t.Errorf("unexpected duration %d", fp.Duration())
+	}
+	short, _ := NewFingerprintFromPCM(bytes.NewReader(audio[:len(audio)*MaxDuration/(MaxDuration+10)]), 8000, 2, 0)
+	if fp.fingerprint != short.fingerprint {
+		t.Error("only the first MaxDuration seconds should be fingerprinted")
+	}
+
+	// reading stops after MaxDuration when the duration is known
+	r := bytes.NewReader(audio)
+	known, err := NewFingerprintFromPCM(r, 8000, 2, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if known.Duration() != 300 || known.fingerprint != fp.fingerprint {
+		t.Errorf("unexpected fingerprint for a known duration %d", known.Duration())
+	}
+	if r.Len() == 0 {
+		t.Error("the whole audio was read")
+	}
+}
+
+func bitErrorRate(a, b []uint32) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	errs := 0
+	for i := 0; i < n; i++ {
+		errs += bits.OnesCount32(a[i] ^ b[i])
+	}
+	return float64(errs) / float64(32*n)
+}
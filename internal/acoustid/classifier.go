@@ -0,0 +1,139 @@
+package acoustid
+
+import "math"
+
+// integralImage is the summed area table of the chroma image, one row per
+// frame with a column per chroma band.
+type integralImage struct {
+	rows [][numBands]float64
+}
+
+func (img *integralImage) addRow(row []float64) {
+	var r [numBands]float64
+	sum := 0.0
+	for i, v := range row {
+		sum += v
+		r[i] = sum
+	}
+	if n := len(img.rows); n > 0 {
+		for i := range r {
+			r[i] += img.rows[n-1][i]
+		}
+	}
+	img.rows = append(img.rows, r)
+}
+
+// area sums the rows r1 to r2 and columns c1 to c2, ends excluded.
+func (img *integralImage) area(r1, c1, r2, c2 int) float64 {
+	if r1 == r2 || c1 == c2 {
+		return 0
+	}
+	a := img.rows[r2-1][c2-1]
+	if r1 > 0 {
+		a -= img.rows[r1-1][c2-1]
+	}
+	if c1 > 0 {
+		a -= img.rows[r2-1][c1-1]
+	}
+	if r1 > 0 && c1 > 0 {
+		a += img.rows[r1-1][c1-1]
+	}
+	return a
+}
+
+// filter is a Haar-like filter over w frames and h chroma bands starting at
+// band y.
+type filter struct {
+	kind, y, h, w int
+}
+
+func subtractLog(a, b float64) float64 {
+	return math.Log(1+a) - math.Log(1+b)
+}
+
+func (f filter) apply(img *integralImage, x int) float64 {
+	y, w, h := f.y, f.w, f.h
+	var a, b float64
+	switch f.kind {
+	case 0:
+		a = img.area(x, y, x+w, y+h)
+	case 1:
+		h2 := h / 2
+		a = img.area(x, y+h2, x+w, y+h)
+		b = img.area(x, y, x+w, y+h2)
+	case 2:
+		w2 := w / 2
+		a = img.area(x+w2, y, x+w, y+h)
+		b = img.area(x, y, x+w2, y+h)
+	case 3:
+		w2, h2 := w/2, h/2
+		a = img.area(x, y+h2, x+w2, y+h) + img.area(x+w2, y, x+w, y+h2)
+		b = img.area(x, y, x+w2, y+h2) + img.area(x+w2, y+h2, x+w, y+h)
+	case 4:
+		h3 := h / 3
+		a = img.area(x, y+h3, x+w, y+2*h3)
+		b = img.area(x, y, x+w, y+h3) + img.area(x, y+2*h3, x+w, y+h)
+	case 5:
+		w3 := w / 3
+		a = img.area(x+w3, y, x+2*w3, y+h)
+		b = img.area(x, y, x+w3, y+h) + img.area(x+2*w3, y, x+w, y+h)
+	}
+	return subtractLog(a, b)
+}
+
+// quantizer maps filter responses to 0-3.
+type quantizer struct {
+	t0, t1, t2 float64
+}
+
+func (q quantizer) quantize(v float64) uint32 {
+	if v < q.t1 {
+		if v < q.t0 {
+			return 0
+		}
+		return 1
+	}
+	if v < q.t2 {
+		return 2
+	}
+	return 3
+}
+
+type classifier struct {
+	filter
+	quantizer
+}
+
+// classifiers of the default Chromaprint algorithm (TEST2), 2 bits each.
+var classifiers = [16]classifier{
+	{filter{0, 4, 3, 15}, quantizer{1.98215, 2.35817, 2.63523}},
+	{filter{4, 4, 6, 15}, quantizer{-1.03809, -0.651211, -0.282167}},
+	{filter{1, 0, 4, 16}, quantizer{-0.298702, 0.119262, 0.558497}},
+	{filter{3, 8, 2, 12}, quantizer{-0.105439, 0.0153946, 0.135898}},
+	{filter{3, 4, 4, 8}, quantizer{-0.142891, 0.0258736, 0.200632}},
+	{filter{4, 0, 3, 5}, quantizer{-0.826319, -0.590612, -0.368214}},
+	{filter{1, 2, 2, 9}, quantizer{-0.557409, -0.233035, 0.0534525}},
+	{filter{2, 7, 3, 4}, quantizer{-0.0646826, 0.00620476, 0.0784847}},
+	{filter{2, 6, 2, 16}, quantizer{-0.192387, -0.029699, 0.215855}},
+	{filter{2, 1, 3, 2}, quantizer{-0.0397818, -0.00568076, 0.0292026}},
+	{filter{5, 10, 1, 15}, quantizer{-0.53823, -0.369934, -0.190235}},
+	{filter{3, 6, 2, 10}, quantizer{-0.124877, 0.0296483, 0.139239}},
+	{filter{2, 1, 1, 14}, quantizer{-0.101475, 0.0225617, 0.126995}},
+	{filter{3, 5, 6, 4}, quantizer{-0.0799915, -0.00729616, 0.063262}},
+	{filter{1, 9, 2, 12}, quantizer{-0.272556, 0.019424, 0.302559}},
+	{filter{3, 4, 2, 14}, quantizer{-0.164292, -0.0321188, 0.08463}},
+}
+
+// maxFilterWidth is the widest classifier, in frames.
+const maxFilterWidth = 16
+
+var grayCode = [4]uint32{0, 1, 3, 2}
+
+// subFingerprint classifies the frames starting at x.
+func subFingerprint(img *integralImage, x int) uint32 {
+	var bits uint32
+	for _, c := range classifiers {
+		bits = bits<<2 | grayCode[c.quantize(c.apply(img, x))]
+	}
+	return bits
+}
@@ -0,0 +1,129 @@
+package acoustid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/rplay/internal/webclient"
+)
+
+// AcoustID allows 3 requests per second for each application.
+const (
+	DefaultRate  = 3
+	DefaultBurst = 3
+)
+
+// Error codes returned by the web service.
+const (
+	ErrCodeInvalidFingerprint = 3
+	ErrCodeInvalidAPIKey      = 4
+	ErrCodeInternal           = 5
+	ErrCodeServiceUnavailable = 13
+	ErrCodeTooManyRequests    = 14
+)
+
+// APIError is an error returned by the web service.
+type APIError struct {
+	// HTTP status code of the response
+	StatusCode int    `json:"-"`
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("acoustid: %s (code %d, HTTP %d)", e.Message, e.Code, e.StatusCode)
+}
+
+// Temporary returns true if the request may succeed later.
+func (e *APIError) Temporary() bool {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= 500:
+		return true
+	case e.Code == ErrCodeInternal, e.Code == ErrCodeServiceUnavailable, e.Code == ErrCodeTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// Client looks up fingerprints in the AcoustID web service.
+type Client struct {
+	APIKey string
+	// web service URL, without a trailing slash
+	BaseURL string
+	webclient.Client
+}
+
+// NewClient returns a client for the AcoustID web service, limited to
+// the requests per second allowed.
+func NewClient(apiKey string) *Client {
+	return &Client{
+		APIKey:  apiKey,
+		BaseURL: DefaultBaseURL,
+		Client: webclient.Client{
+			Timeout:    10 * time.Second,
+			MaxRetries: 3,
+			Backoff:    500 * time.Millisecond,
+			MaxBackoff: 10 * time.Second,
+			Limiter:    webclient.NewRateLimiter(DefaultRate, DefaultBurst),
+			HTTPClient: http.DefaultClient,
+		},
+	}
+}
+
+// Lookup returns the recordings matching a fingerprint.
+func (c *Client) Lookup(ctx context.Context, fp Fingerprint) (*AcoustIDResponse, error) {
+	if c.APIKey == "" {
+		return nil, ErrMissingAPIKey
+	}
+
+	values := url.Values{}
+	values.Set("client", c.APIKey)
+	values.Set("duration", strconv.Itoa(fp.duration))
+	values.Set("meta", "recordings releasegroups compress")
+	values.Set("fingerprint", fp.fingerprint)
+
+	resp := &AcoustIDResponse{}
+	err := c.do(ctx, "/lookup", values, resp)
+	return resp, err
+}
+
+// do posts values to the web service, retrying temporary errors, and
+// decodes the response into v.
+func (c *Client) do(ctx context.Context, path string, values url.Values, v *AcoustIDResponse) error {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, c.BaseURL+path, strings.NewReader(values.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+	return c.Client.Do(ctx, newRequest, func(resp *webclient.Response) error {
+		return decode(resp, v)
+	})
+}
+
+// decode decodes a response into v, returning the error it has.
+func decode(resp *webclient.Response, v *AcoustIDResponse) error {
+	*v = AcoustIDResponse{}
+	if err := json.Unmarshal(resp.Body, v); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		}
+		return err
+	}
+	if v.Status != "ok" || resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: "unexpected response status " + v.Status}
+		if v.Error != nil {
+			apiErr.Code, apiErr.Message = v.Error.Code, v.Error.Message
+		}
+		return apiErr
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package acoustid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const lookupResponse = `{
+  "status": "ok",
+  "results": [{
+    "id": "9ff43b6a-4f16-427c-93c2-92307ca505e0",
+    "score": 0.97,
+    "recordings": [{
+      "id": "cd2e7c47-16f5-46c6-a37c-a1eb7bf599ff",
+      "title": "Song",
+      "duration": 213,
+      "artists": [{"id": "a1", "name": "Artist"}],
+      "releasegroups": [{"id": "r1", "title": "Album", "type": "Album"}]
+    }]
+  }]
+}`
+
+func testClient(url string) *Client {
+	c := NewClient("key")
+	c.BaseURL = url
+	c.Backoff = time.Millisecond
+	c.MaxBackoff = 5 * time.Millisecond
+	c.Limiter = nil
+	return c
+}
+
+func TestLookup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lookup" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.FormValue("client") != "key" || r.FormValue("fingerprint") != "AQAA" || r.FormValue("duration") != "213" {
+			t.Errorf("unexpected form %v", r.Form)
+		}
+		if r.FormValue("meta") != "recordings releasegroups compress" {
+			t.Errorf("unexpected meta %q", r.FormValue("meta"))
+		}
+		w.Write([]byte(lookupResponse))
+	}))
+	defer srv.Close()
+
+	resp, err := testClient(srv.URL).Lookup(context.Background(), Fingerprint{fingerprint: "AQAA", duration: 213})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Recordings[0].Title != "Song" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestLookupRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"status": "error", "error": {"code": 14, "message": "rate limit exceeded"}}`))
+		default:
+			w.Write([]byte(lookupResponse))
+		}
+	}))
+	defer srv.Close()
+
+	_, err := testClient(srv.URL).Lookup(context.Background(), Fingerprint{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 requests, got %d", calls)
+	}
+}
+
+func TestLookupGivesUp(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+	c.MaxRetries = 2
+	_, err := c.Lookup(context.Background(), Fingerprint{})
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected an API error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 requests, got %d", calls)
+	}
+}
+
+func TestLookupAPIError(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status": "error", "error": {"code": 4, "message": "invalid API key"}}`))
+	}))
+	defer srv.Close()
+
+	_, err := testClient(srv.URL).Lookup(context.Background(), Fingerprint{})
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected an API error, got %v", err)
+	}
+	if apiErr.Code != ErrCodeInvalidAPIKey || apiErr.Message != "invalid API key" || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 request, got %d", calls)
+	}
+}
+
+func TestLookupTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c := testClient(srv.URL)
+	c.Timeout = 10 * time.Millisecond
+	c.MaxRetries = 1
+	start := time.Now()
+	if _, err := c.Lookup(context.Background(), Fingerprint{}); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("the request wasn't canceled")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Lookup(ctx, Fingerprint{}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestLookupWithoutKey(t *testing.T) {
+	c := testClient("http://localhost:0")
+	c.APIKey = ""
+	if _, err := c.Lookup(context.Background(), Fingerprint{}); err != ErrMissingAPIKey {
+		t.Errorf("expected ErrMissingAPIKey, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package acoustid
+
+import "encoding/base64"
+
+const (
+	maxNormalValue = 7
+	normalBits     = 3
+	exceptionBits  = 5
+)
+
+// compressFingerprint packs a raw fingerprint the way Chromaprint does: the
+// algorithm, the length, and the positions of the bits changing between
+// sub-fingerprints.
+func compressFingerprint(raw []uint32, algorithm byte) []byte {
+	normal := []byte{}
+	exceptional := []byte{}
+	var prev uint32
+	for _, sub := range raw {
+		x := sub ^ prev
+		prev = sub
+		bit, lastBit := byte(1), byte(0)
+		for ; x != 0; x >>= 1 {
+			if x&1 != 0 {
+				d := bit - lastBit
+				if d >= maxNormalValue {
+					normal = append(normal, maxNormalValue)
+					exceptional = append(exceptional, d-maxNormalValue)
+				} else {
+					normal = append(normal, d)
+				}
+				lastBit = bit
+			}
+			bit++
+		}
+		normal = append(normal, 0)
+	}
+
+	n := len(raw)
+	out := []byte{algorithm, byte(n >> 16), byte(n >> 8), byte(n)}
+	out = append(out, packBits(normal, normalBits)...)
+	return append(out, packBits(exceptional, exceptionBits)...)
+}
+
+// packBits packs the lowest size bits of each value, least significant bits
+// first.
+func packBits(values []byte, size uint) []byte {
+	out := make([]byte, (len(values)*int(size)+7)/8)
+	pos := uint(0)
+	for _, v := range values {
+		for b := uint(0); b < size; b++ {
+			if v>>b&1 != 0 {
+				out[pos/8] |= 1 << (pos % 8)
+			}
+			pos++
+		}
+	}
+	return out
+}
+
+// encodeFingerprint returns the compressed fingerprint as sent to AcoustID.
+func encodeFingerprint(raw []uint32, algorithm byte) string {
+	return base64.RawURLEncoding.EncodeToString(compressFingerprint(raw, algorithm))
+}
@@ -0,0 +1,75 @@
+package acoustid
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// powerSpectrum computes the power spectrum of windowed frames with a radix-2
+// FFT.
+type powerSpectrum struct {
+	size    int
+	window  []float64
+	twiddle []complex128
+	buf     []complex128
+	rev     []int
+}
+
+// newPowerSpectrum returns the spectrum of frames of size 16 bit samples,
+// size a power of 2. Samples are scaled to -1..1 by the window.
+func newPowerSpectrum(size int) *powerSpectrum {
+	p := &powerSpectrum{
+		size:    size,
+		window:  make([]float64, size),
+		twiddle: make([]complex128, size/2),
+		buf:     make([]complex128, size),
+		rev:     make([]int, size),
+	}
+
+	// Hamming window
+	for i := range p.window {
+		p.window[i] = (0.54 - 0.46*math.Cos(float64(i)*2*math.Pi/float64(size-1))) / math.MaxInt16
+	}
+	for i := range p.twiddle {
+		p.twiddle[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/float64(size)))
+	}
+	bits := 0
+	for 1<<bits < size {
+		bits++
+	}
+	for i := range p.rev {
+		r := 0
+		for b := 0; b < bits; b++ {
+			r |= (i >> b & 1) << (bits - 1 - b)
+		}
+		p.rev[i] = r
+	}
+	return p
+}
+
+// compute writes the power of each frequency, size/2+1 values, to out.
+func (p *powerSpectrum) compute(frame []int16, out []float64) {
+	for i, s := range frame {
+		p.buf[p.rev[i]] = complex(float64(s)*p.window[i], 0)
+	}
+
+	for n := 2; n <= p.size; n <<= 1 {
+		step := p.size / n
+		for start := 0; start < p.size; start += n {
+			for k := 0; k < n/2; k++ {
+				t := p.twiddle[k*step] * p.buf[start+k+n/2]
+				u := p.buf[start+k]
+				p.buf[start+k] = u + t
+				p.buf[start+k+n/2] = u - t
+			}
+		}
+	}
+
+	for i := 0; i <= p.size/2; i++ {
+		re, im := real(p.buf[i]), imag(p.buf[i])
+		if i == 0 || i == p.size/2 {
+			im = 0
+		}
+		out[i] = re*re + im*im
+	}
+}
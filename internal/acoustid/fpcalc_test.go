@@ -0,0 +1,161 @@
+package acoustid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rubiojr/rplay/internal/flac"
+)
+
+// The fixtures are audio with the fingerprints Chromaprint calculates for
+// it. silence-44100 is the silence of Chromaprint's API tests, clips of
+// songs are added with testdata/fpcalc/generate.sh.
+func TestFingerprintMatchesFpcalc(t *testing.T) {
+	fixtures, err := filepath.Glob("testdata/fpcalc/*.raw.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fpcalc fixtures")
+	}
+
+	for _, f := range fixtures {
+		name := strings.TrimSuffix(f, ".raw.json")
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			var raw struct {
+				Fingerprint []uint32 `json:"fingerprint"`
+			}
+			var compressed struct {
+				Fingerprint string `json:"fingerprint"`
+			}
+			readJSON(t, name+".raw.json", &raw)
+			readJSON(t, name+".json", &compressed)
+
+			pcm, rate, channels, err := readFixture(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fp, err := NewFingerprintFromPCM(bytes.NewReader(pcm), rate, channels, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := fp.Raw()
+			if len(got) != len(raw.Fingerprint) {
+				t.Errorf("got %d sub-fingerprints, fpcalc %d", len(got), len(raw.Fingerprint))
+			}
+			for i := range got {
+				if i < len(raw.Fingerprint) && got[i] != raw.Fingerprint[i] {
+					t.Errorf("sub-fingerprint %d is %08x, fpcalc %08x", i, got[i], raw.Fingerprint[i])
+					break
+				}
+			}
+			if fp.String() != compressed.Fingerprint {
+				t.Errorf("fingerprint %s, fpcalc %s", fp.String(), compressed.Fingerprint)
+			}
+		})
+	}
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
+
+// readFixture returns the 16 bit interleaved samples of name.wav or
+// name.flac.
+func readFixture(name string) ([]byte, int, int, error) {
+	if f, err := os.Open(name + ".wav"); err == nil {
+		defer f.Close()
+		return readWAV(f)
+	}
+	f, err := os.Open(name + ".flac")
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer f.Close()
+	return readFLAC(f)
+}
+
+// readWAV reads a 16 bit PCM WAV file.
+func readWAV(r io.Reader) ([]byte, int, int, error) {
+	var riff struct {
+		ID   [4]byte
+		Size uint32
+		Wave [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return nil, 0, 0, err
+	}
+	if string(riff.ID[:]) != "RIFF" || string(riff.Wave[:]) != "WAVE" {
+		return nil, 0, 0, errors.New("not a WAV file")
+	}
+
+	rate, channels := 0, 0
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return nil, 0, 0, err
+		}
+		data := make([]byte, chunk.Size+chunk.Size%2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, 0, 0, err
+		}
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			if len(data) < 16 || binary.LittleEndian.Uint16(data[14:]) != 16 {
+				return nil, 0, 0, errors.New("not 16 bit PCM")
+			}
+			channels = int(binary.LittleEndian.Uint16(data[2:]))
+			rate = int(binary.LittleEndian.Uint32(data[4:]))
+		case "data":
+			if rate == 0 {
+				return nil, 0, 0, errors.New("data before the format")
+			}
+			return data[:chunk.Size], rate, channels, nil
+		}
+	}
+}
+
+// readFLAC decodes a 16 bit FLAC file.
+func readFLAC(r io.Reader) ([]byte, int, int, error) {
+	d, err := flac.NewDecoder(r)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if d.BitsPerSample() != 16 {
+		return nil, 0, 0, errors.New("not 16 bit")
+	}
+
+	buf := &bytes.Buffer{}
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			return buf.Bytes(), d.SampleRate(), d.Channels(), nil
+		}
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		for i := 0; i < frame.BlockSize; i++ {
+			for _, ch := range frame.Samples {
+				binary.Write(buf, binary.LittleEndian, int16(ch[i]))
+			}
+		}
+	}
+}
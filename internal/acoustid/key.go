@@ -1,3 +0,0 @@
-package acoustid
-
-const ACOUSTID_API_KEY = ""
@@ -0,0 +1,136 @@
+package acoustid
+
+import "math"
+
+// Resampler settings used by Chromaprint.
+const (
+	resampleFilterLength = 16
+	resamplePhaseShift   = 8
+	resampleCutoff       = 0.8
+	// Kaiser window with beta 9
+	resampleWindow = 9
+	filterShift    = 15
+)
+
+// avResampler is the polyphase resampler from the libavcodec version
+// bundled with Chromaprint (resample2.c), without linear interpolation.
+// Fingerprints depend on the exact samples, so it's ported as it is,
+// integer arithmetic included.
+type avResampler struct {
+	filterBank   []int16
+	filterLength int
+	phaseShift   uint
+	phaseMask    int
+	srcIncr      int
+	dstIncr      int
+	index        int
+	frac         int
+}
+
+func newAVResampler(outRate, inRate int) *avResampler {
+	factor := math.Min(float64(outRate)*resampleCutoff/float64(inRate), 1)
+	phaseCount := 1 << resamplePhaseShift
+	r := &avResampler{
+		phaseShift:   resamplePhaseShift,
+		phaseMask:    phaseCount - 1,
+		filterLength: int(math.Max(math.Ceil(resampleFilterLength/factor), 1)),
+		srcIncr:      outRate,
+		dstIncr:      inRate * phaseCount,
+	}
+	r.filterBank = buildFilter(factor, r.filterLength, phaseCount, 1<<filterShift, resampleWindow)
+	r.index = -phaseCount * ((r.filterLength - 1) / 2)
+	return r
+}
+
+// bessel is the zeroth order modified Bessel function of the first kind.
+func bessel(x float64) float64 {
+	v, lastv, t := 1.0, 0.0, 1.0
+	x = x * x / 4
+	for i := 1.0; v != lastv; i++ {
+		lastv = v
+		t *= x / (i * i)
+		v += t
+	}
+	return v
+}
+
+// buildFilter returns the windowed sinc filter for each phase.
+func buildFilter(factor float64, tapCount, phaseCount, scale, window int) []int16 {
+	filter := make([]int16, tapCount*phaseCount)
+	tab := make([]float64, tapCount)
+	center := (tapCount - 1) / 2
+
+	for ph := 0; ph < phaseCount; ph++ {
+		norm := 0.0
+		for i := 0; i < tapCount; i++ {
+			x := math.Pi * (float64(i-center) - float64(ph)/float64(phaseCount)) * factor
+			y := 1.0
+			if x != 0 {
+				y = math.Sin(x) / x
+			}
+			w := 2 * x / (factor * float64(tapCount) * math.Pi)
+			y *= bessel(float64(window) * math.Sqrt(math.Max(1-w*w, 0)))
+			tab[i] = y
+			norm += y
+		}
+		for i := 0; i < tapCount; i++ {
+			// lrintf
+			v := math.RoundToEven(float64(float32(tab[i] * float64(scale) / norm)))
+			filter[ph*tapCount+i] = int16(math.Max(math.Min(v, math.MaxInt16), math.MinInt16))
+		}
+	}
+	return filter
+}
+
+// resample resamples src into dst and returns the samples written and the
+// ones consumed from src. Samples not consumed have to be passed again with
+// the following ones.
+func (r *avResampler) resample(dst, src []int16) (written, consumed int) {
+	index, frac := r.index, r.frac
+	dstIncrFrac := r.dstIncr % r.srcIncr
+	dstIncr := r.dstIncr / r.srcIncr
+
+	for written = 0; written < len(dst); written++ {
+		filter := r.filterBank[r.filterLength*(index&r.phaseMask):]
+		sampleIndex := index >> r.phaseShift
+		var val int32
+
+		if sampleIndex < 0 {
+			for i := 0; i < r.filterLength; i++ {
+				j := sampleIndex + i
+				if j < 0 {
+					j = -j
+				}
+				val += int32(src[j%len(src)]) * int32(filter[i])
+			}
+		} else if sampleIndex+r.filterLength > len(src) {
+			break
+		} else {
+			for i := 0; i < r.filterLength; i++ {
+				val += int32(src[sampleIndex+i]) * int32(filter[i])
+			}
+		}
+
+		val = (val + (1 << (filterShift - 1))) >> filterShift
+		if uint32(val+32768) > 65535 {
+			val = (val >> 31) ^ 32767
+		}
+		dst[written] = int16(val)
+
+		frac += dstIncrFrac
+		index += dstIncr
+		if frac >= r.srcIncr {
+			frac -= r.srcIncr
+			index++
+		}
+	}
+
+	if index > 0 {
+		consumed = index >> r.phaseShift
+	}
+	if index >= 0 {
+		index &= r.phaseMask
+	}
+	r.index, r.frac = index, frac
+	return written, consumed
+}
@@ -0,0 +1,29 @@
+#!/bin/sh
+# Creates the fixtures comparing NewFingerprintFromPCM with fpcalc: clips
+# of a song as WAV and FLAC at 44.1 kHz and 11025 Hz, mono and stereo, with
+# the raw (NAME.raw.json) and compressed (NAME.json) fingerprints fpcalc
+# calculates for them. Needs ffmpeg and fpcalc.
+#
+#   ./generate.sh song.mp3 [start seconds]
+set -e
+
+src="$1"
+start="${2:-30}"
+if [ -z "$src" ]; then
+	echo "usage: $0 <song> [start seconds]" >&2
+	exit 1
+fi
+cd "$(dirname "$0")"
+
+clip() {
+	name="$1"; rate="$2"; channels="$3"; ext="$4"
+	ffmpeg -loglevel error -y -ss "$start" -t 10 -i "$src" \
+		-map_metadata -1 -ar "$rate" -ac "$channels" -sample_fmt s16 "$name.$ext"
+	fpcalc -json "$name.$ext" > "$name.json"
+	fpcalc -raw -json "$name.$ext" > "$name.raw.json"
+}
+
+clip stereo-44100 44100 2 wav
+clip mono-44100 44100 1 flac
+clip stereo-11025 11025 2 flac
+clip mono-11025 11025 1 wav
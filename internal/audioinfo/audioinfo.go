@@ -0,0 +1,107 @@
+// Package audioinfo reads the properties of MP3, Ogg and FLAC files, like
+// their duration and bitrate, from the beginning and the end of the file.
+package audioinfo
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/rubiojr/rplay/internal/flac"
+)
+
+var ErrUnknownFormat = errors.New("audioinfo: unknown audio format")
+
+// Info holds the properties of an audio file. Fields are zero when unknown.
+type Info struct {
+	// mp3, mp2, mp1, vorbis, opus or flac
+	Codec    string
+	Duration time.Duration
+	// average bitrate in bits per second
+	Bitrate    int
+	SampleRate int
+	Channels   int
+}
+
+// Read returns the properties of an audio file size bytes long. head holds
+// the beginning of the file, or the whole file. tail returns the end of the
+// file, it's only called for formats that need it.
+func Read(head []byte, size int64, tail func() ([]byte, error)) (Info, error) {
+	audio := head[id3v2Size(head):]
+	if size <= int64(len(head)) {
+		tail = func() ([]byte, error) { return head, nil }
+	}
+
+	var info Info
+	var err error
+	switch {
+	case bytes.HasPrefix(audio, []byte("fLaC")):
+		info, err = readFLAC(audio)
+	case bytes.HasPrefix(audio, []byte("OggS")):
+		info, err = readOgg(audio, tail)
+	case isContainer(audio):
+		return Info{}, ErrUnknownFormat
+	default:
+		info, err = readMPEG(head, size)
+	}
+	if err != nil {
+		return info, err
+	}
+
+	if info.Bitrate == 0 && info.Duration > 0 {
+		info.Bitrate = int(float64(size*8) / info.Duration.Seconds())
+	}
+	return info, nil
+}
+
+// isContainer is true for WAV, AIFF and MP4 files, whose audio may look
+// like MPEG frames.
+func isContainer(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("RIFF")) || bytes.HasPrefix(b, []byte("FORM")) ||
+		len(b) >= 8 && string(b[4:8]) == "ftyp"
+}
+
+// id3v2Size returns the size of the ID3v2 tag at the beginning of b, if any.
+func id3v2Size(b []byte) int {
+	size := TagSize(b)
+	if size > int64(len(b)) {
+		return len(b)
+	}
+	return int(size)
+}
+
+// TagSize returns the size of the ID3v2 tag starting with header, the first
+// 10 bytes of a file, or 0 if there's none.
+func TagSize(header []byte) int64 {
+	if len(header) < 10 || string(header[:3]) != "ID3" {
+		return 0
+	}
+	b := header
+	size := 10 + (int64(b[6]&0x7f)<<21 | int64(b[7]&0x7f)<<14 | int64(b[8]&0x7f)<<7 | int64(b[9]&0x7f))
+	// footer
+	if b[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+func samplesDuration(samples int64, rate int) time.Duration {
+	if rate == 0 || samples <= 0 {
+		return 0
+	}
+	return time.Duration(samples) * time.Second / time.Duration(rate)
+}
+
+func readFLAC(b []byte) (Info, error) {
+	si, _, err := flac.ReadStreamInfo(bytes.NewReader(b))
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{
+		Codec:      "flac",
+		Duration:   samplesDuration(int64(si.TotalSamples), int(si.SampleRate)),
+		SampleRate: int(si.SampleRate),
+		Channels:   int(si.Channels),
+	}, nil
+}
@@ -0,0 +1,202 @@
+package audioinfo
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// MPEG 1 layer III, 128 kbps, 44.1 kHz, stereo frames are 417 bytes long.
+func mp3Frame() []byte {
+	f := make([]byte, 417)
+	copy(f, []byte{0xff, 0xfb, 0x90, 0x00})
+	return f
+}
+
+func mp3Frames(n int) []byte {
+	b := []byte{}
+	for i := 0; i < n; i++ {
+		b = append(b, mp3Frame()...)
+	}
+	return b
+}
+
+func noTail() ([]byte, error) {
+	panic("the end of the file shouldn't be needed")
+}
+
+func frameDuration(frames int64) time.Duration {
+	return time.Duration(frames*1152) * time.Second / 44100
+}
+
+func TestMP3FrameScan(t *testing.T) {
+	// ID3v2 tag with 20 bytes of frames
+	file := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 20}, make([]byte, 20)...)
+	file = append(file, mp3Frames(100)...)
+
+	info, err := Read(file, int64(len(file)), noTail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Codec != "mp3" || info.SampleRate != 44100 || info.Channels != 2 {
+		t.Errorf("unexpected stream properties %+v", info)
+	}
+	if info.Duration != frameDuration(100) {
+		t.Errorf("expected duration %s, got %s", frameDuration(100), info.Duration)
+	}
+	if info.Bitrate/1000 != 128 {
+		t.Errorf("expected 128 kbps, got %d", info.Bitrate)
+	}
+
+	// only the beginning of the file is available
+	info, err = Read(file[:417*10], int64(len(file)), noTail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := info.Duration - frameDuration(100); d < -10*time.Millisecond || d > 10*time.Millisecond {
+		t.Errorf("expected estimated duration close to %s, got %s", frameDuration(100), info.Duration)
+	}
+}
+
+func TestMP3Xing(t *testing.T) {
+	xing := mp3Frame()
+	x := 4 + 32
+	copy(xing[x:], "Info")
+	binary.BigEndian.PutUint32(xing[x+4:], 1|8)
+	binary.BigEndian.PutUint32(xing[x+8:], 1000)
+	lame := x + 16
+	copy(xing[lame:], "LAME3.100")
+	// 576 samples of delay and 1000 of padding
+	copy(xing[lame+21:], []byte{576 >> 4, 576&0xf<<4 | 1000>>8, 1000 & 0xff})
+
+	file := append(xing, mp3Frames(10)...)
+	info, err := Read(file, 1001*417, noTail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Duration(1000*1152-1576) * time.Second / 44100
+	if info.Duration != want {
+		t.Errorf("expected duration %s, got %s", want, info.Duration)
+	}
+
+	gap, ok := ReadEncoderGap(file)
+	if want := (EncoderGap{Header: 1152, Delay: 576, Padding: 1000}); !ok || gap != want {
+		t.Errorf("expected encoder gap %+v, got %+v", want, gap)
+	}
+	if _, ok := ReadEncoderGap(mp3Frames(10)); ok {
+		t.Error("expected no encoder gap without a Xing frame")
+	}
+}
+
+func TestMP3VBRI(t *testing.T) {
+	vbri := mp3Frame()
+	copy(vbri[36:], "VBRI")
+	binary.BigEndian.PutUint32(vbri[36+14:], 500)
+
+	file := append(vbri, mp3Frames(10)...)
+	info, err := Read(file, 501*417, noTail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Duration != frameDuration(500) {
+		t.Errorf("expected duration %s, got %s", frameDuration(500), info.Duration)
+	}
+}
+
+func oggPageBytes(granule int64, serial uint32, payload []byte) []byte {
+	p := make([]byte, oggPageHeaderSize)
+	copy(p, "OggS")
+	binary.LittleEndian.PutUint64(p[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(p[14:], serial)
+	p[26] = 1
+	p = append(p, byte(len(payload)))
+	return append(p, payload...)
+}
+
+func TestOgg(t *testing.T) {
+	id := make([]byte, 30)
+	copy(id, "\x01vorbis")
+	id[11] = 2
+	binary.LittleEndian.PutUint32(id[12:], 44100)
+	head := oggPageBytes(0, 7, id)
+
+	end := append(oggPageBytes(44100*9, 7, []byte{1, 2, 3}), oggPageBytes(44100*10, 7, []byte{1, 2, 3})...)
+	// another stream multiplexed
+	end = append(end, oggPageBytes(5, 8, []byte{1})...)
+
+	info, err := Read(head, 100000, func() ([]byte, error) { return end, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Codec != "vorbis" || info.SampleRate != 44100 || info.Channels != 2 {
+		t.Errorf("unexpected stream properties %+v", info)
+	}
+	if info.Duration != 10*time.Second {
+		t.Errorf("expected duration 10s, got %s", info.Duration)
+	}
+	if info.Bitrate != 80000 {
+		t.Errorf("expected 80 kbps, got %d", info.Bitrate)
+	}
+}
+
+func TestOpus(t *testing.T) {
+	id := make([]byte, 19)
+	copy(id, "OpusHead")
+	id[9] = 1
+	binary.LittleEndian.PutUint16(id[10:], 312)
+	file := append(oggPageBytes(0, 1, id), oggPageBytes(48000*3+312, 1, []byte{1})...)
+
+	info, err := Read(file, int64(len(file)), noTail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Codec != "opus" || info.Channels != 1 || info.Duration != 3*time.Second {
+		t.Errorf("unexpected stream properties %+v", info)
+	}
+}
+
+func TestFLAC(t *testing.T) {
+	b := []byte("fLaC")
+	b = append(b, 0x80, 0, 0, 34)
+	si := make([]byte, 34)
+	// 48 kHz, 2 channels, 24 bits, 480000 samples
+	x := uint64(48000)<<44 | uint64(1)<<41 | uint64(23)<<36 | 480000
+	binary.BigEndian.PutUint64(si[10:], x)
+	b = append(b, si...)
+
+	info, err := Read(b, 1000000, noTail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Codec != "flac" || info.SampleRate != 48000 || info.Channels != 2 || info.Duration != 10*time.Second {
+		t.Errorf("unexpected stream properties %+v", info)
+	}
+	if info.Bitrate != 800000 {
+		t.Errorf("expected 800 kbps, got %d", info.Bitrate)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	wav := append([]byte("RIFF\x00\x00\x00\x00WAVEfmt "), mp3Frames(10)...)
+	m4a := append([]byte("\x00\x00\x00\x20ftypM4A "), mp3Frames(10)...)
+	// a frame header here and there isn't MPEG audio
+	data := append(make([]byte, 1000), mp3Frame()[:4]...)
+	data = append(data, make([]byte, 1000)...)
+	data = append(data, mp3Frame()[:4]...)
+	for name, b := range map[string][]byte{
+		"text": []byte("not audio at all"),
+		"wav":  wav,
+		"m4a":  m4a,
+		"data": data,
+	} {
+		if _, err := Read(b, int64(len(b)), noTail); err != ErrUnknownFormat {
+			t.Errorf("%s: expected ErrUnknownFormat, got %v", name, err)
+		}
+	}
+
+	// frames found after some junk
+	file := append([]byte("junk"), mp3Frames(syncFrames)...)
+	if info, err := Read(file, int64(len(file)), noTail); err != nil || info.Codec != "mp3" {
+		t.Errorf("expected MP3 audio, got %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,259 @@
+package audioinfo
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+const (
+	mpeg25 = 0
+	mpeg2  = 2
+	mpeg1  = 3
+
+	layer3 = 1
+	layer2 = 2
+	layer1 = 3
+)
+
+// kbps, indexed by [MPEG 1 or 2/2.5][layer - 1][bitrate index]
+var mpegBitrates = [2][3][16]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mpegSampleRates = map[int][3]int{
+	mpeg1:  {44100, 48000, 32000},
+	mpeg2:  {22050, 24000, 16000},
+	mpeg25: {11025, 12000, 8000},
+}
+
+// mpegFrame is an MPEG audio frame header.
+type mpegFrame struct {
+	version    int
+	layer      int
+	bitrate    int // kbps
+	sampleRate int
+	channels   int
+	length     int
+	samples    int
+}
+
+func parseMPEGFrame(b []byte) (mpegFrame, bool) {
+	f := mpegFrame{}
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return f, false
+	}
+	f.version = int(b[1]>>3) & 3
+	f.layer = int(b[1]>>1) & 3
+	bitrateIndex := int(b[2] >> 4)
+	rateIndex := int(b[2]>>2) & 3
+	padding := int(b[2]>>1) & 1
+	if f.version == 1 || f.layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return f, false
+	}
+
+	v := 0
+	if f.version != mpeg1 {
+		v = 1
+	}
+	f.bitrate = mpegBitrates[v][3-f.layer][bitrateIndex]
+	f.sampleRate = mpegSampleRates[f.version][rateIndex]
+	f.channels = 2
+	if b[3]>>6 == 3 {
+		f.channels = 1
+	}
+
+	switch f.layer {
+	case layer1:
+		f.samples = 384
+		f.length = (12*f.bitrate*1000/f.sampleRate + padding) * 4
+	case layer2:
+		f.samples = 1152
+		f.length = 144*f.bitrate*1000/f.sampleRate + padding
+	case layer3:
+		f.samples = 1152
+		if f.version != mpeg1 {
+			f.samples = 576
+		}
+		f.length = f.samples/8*f.bitrate*1000/f.sampleRate + padding
+	}
+
+	return f, true
+}
+
+func (f mpegFrame) codec() string {
+	return [4]string{"", "mp3", "mp2", "mp1"}[f.layer]
+}
+
+// sideInfoSize returns the size of the layer III side information that
+// follows the frame header.
+func (f mpegFrame) sideInfoSize() int {
+	switch {
+	case f.version == mpeg1 && f.channels == 2:
+		return 32
+	case f.version == mpeg1, f.channels == 2:
+		return 17
+	default:
+		return 9
+	}
+}
+
+// syncFrames is how many consecutive frames are needed to take data
+// that doesn't start with a frame for MPEG audio.
+const syncFrames = 4
+
+// findMPEGFrame returns the offset of the first frame in b. A frame at the
+// beginning of b must be followed by another one, unless b ends before it.
+// Elsewhere, it must start syncFrames consecutive frames, so other formats
+// aren't taken for MPEG audio.
+func findMPEGFrame(b []byte) (int, mpegFrame, bool) {
+	if f, ok := parseMPEGFrame(b); ok && (f.length+4 > len(b) || mpegFramesFrom(b, f) > 1) {
+		return 0, f, true
+	}
+	for i := 1; i+4 <= len(b); i++ {
+		if f, ok := parseMPEGFrame(b[i:]); ok && mpegFramesFrom(b[i:], f) >= syncFrames {
+			return i, f, true
+		}
+	}
+	return 0, mpegFrame{}, false
+}
+
+// mpegFramesFrom returns how many consecutive frames like f, up to
+// syncFrames, start b.
+func mpegFramesFrom(b []byte, f mpegFrame) int {
+	n, pos := 0, 0
+	for n < syncFrames {
+		g, ok := parseMPEGFrame(b[pos:])
+		if !ok || g.version != f.version || g.layer != f.layer || g.sampleRate != f.sampleRate {
+			break
+		}
+		n++
+		if pos += g.length; pos+4 > len(b) {
+			break
+		}
+	}
+	return n
+}
+
+func readMPEG(b []byte, size int64) (Info, error) {
+	start, f, ok := findMPEGFrame(b[id3v2Size(b):])
+	if !ok {
+		return Info{}, ErrUnknownFormat
+	}
+	start += id3v2Size(b)
+
+	info := Info{Codec: f.codec(), SampleRate: f.sampleRate, Channels: f.channels}
+
+	if f.layer == layer3 {
+		if frames, gap, ok := xingFrames(b[start:], f); ok {
+			info.Duration = samplesDuration(frames*int64(f.samples)-int64(gap.Delay+gap.Padding), f.sampleRate)
+			return info, nil
+		}
+		if frames, ok := vbriFrames(b[start:]); ok {
+			info.Duration = samplesDuration(frames*int64(f.samples), f.sampleRate)
+			return info, nil
+		}
+	}
+
+	// No header with the number of frames, scan the ones available and
+	// estimate the rest from their average bitrate.
+	var samples, bytes, bits int64
+	pos := start
+	for pos+4 <= len(b) {
+		g, ok := parseMPEGFrame(b[pos:])
+		if !ok || pos+g.length > len(b) {
+			break
+		}
+		samples += int64(g.samples)
+		bits += int64(g.bitrate) * 1000 * int64(g.samples)
+		bytes += int64(g.length)
+		pos += g.length
+	}
+	if samples == 0 {
+		return info, nil
+	}
+
+	scanned := samplesDuration(samples, f.sampleRate)
+	info.Bitrate = int(bits / samples)
+	if size <= int64(len(b)) {
+		info.Duration = scanned
+	} else {
+		rate := float64(bytes) / scanned.Seconds()
+		info.Duration = time.Duration(float64(size-int64(start)) / rate * float64(time.Second))
+	}
+
+	return info, nil
+}
+
+// EncoderGap is the silence an MP3 encoder adds to the audio, in samples.
+type EncoderGap struct {
+	// the Xing or Info frame, decoded as silence
+	Header int
+	// at the beginning and the end of the audio, from the LAME extension
+	Delay   int
+	Padding int
+}
+
+// ReadEncoderGap returns the silence added by the encoder to the MP3 audio
+// b starts, after the ID3v2 tag, if its first frame is a Xing or Info frame.
+func ReadEncoderGap(b []byte) (EncoderGap, bool) {
+	start, f, ok := findMPEGFrame(b)
+	if !ok || f.layer != layer3 {
+		return EncoderGap{}, false
+	}
+	_, gap, ok := xingFrames(b[start:], f)
+	return gap, ok
+}
+
+// xingFrames returns the number of frames stored in the Xing or Info header
+// of frame b, and the encoder delay and padding from the LAME extension.
+func xingFrames(b []byte, f mpegFrame) (int64, EncoderGap, bool) {
+	gap := EncoderGap{Header: f.samples}
+	x := 4 + f.sideInfoSize()
+	if len(b) < x+12 {
+		return 0, gap, false
+	}
+	id := string(b[x : x+4])
+	flags := binary.BigEndian.Uint32(b[x+4:])
+	if (id != "Xing" && id != "Info") || flags&1 == 0 {
+		return 0, gap, false
+	}
+	frames := int64(binary.BigEndian.Uint32(b[x+8:]))
+
+	// the LAME extension follows the optional bytes, TOC and quality fields
+	lame := x + 12
+	if flags&2 != 0 {
+		lame += 4
+	}
+	if flags&4 != 0 {
+		lame += 100
+	}
+	if flags&8 != 0 {
+		lame += 4
+	}
+	if len(b) >= lame+24 && string(b[lame:lame+4]) == "LAME" {
+		d := b[lame+21:]
+		gap.Delay = int(d[0])<<4 | int(d[1])>>4
+		gap.Padding = int(d[1]&0xf)<<8 | int(d[2])
+	}
+
+	return frames, gap, true
+}
+
+// vbriFrames returns the number of frames stored in the VBRI header of
+// frame b.
+func vbriFrames(b []byte) (int64, bool) {
+	v := 4 + 32
+	if len(b) < v+18 || string(b[v:v+4]) != "VBRI" {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint32(b[v+14:])), true
+}
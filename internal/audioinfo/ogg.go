@@ -0,0 +1,92 @@
+package audioinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const oggPageHeaderSize = 27
+
+// oggPage is the header of an Ogg page and its payload.
+type oggPage struct {
+	granule int64
+	serial  uint32
+	payload []byte
+}
+
+func parseOggPage(b []byte) (oggPage, bool) {
+	p := oggPage{}
+	if len(b) < oggPageHeaderSize || string(b[:4]) != "OggS" {
+		return p, false
+	}
+	p.granule = int64(binary.LittleEndian.Uint64(b[6:]))
+	p.serial = binary.LittleEndian.Uint32(b[14:])
+
+	segments := int(b[26])
+	if len(b) < oggPageHeaderSize+segments {
+		return p, false
+	}
+	size := 0
+	for _, s := range b[oggPageHeaderSize : oggPageHeaderSize+segments] {
+		size += int(s)
+	}
+	start := oggPageHeaderSize + segments
+	if len(b) < start+size {
+		size = len(b) - start
+	}
+	p.payload = b[start : start+size]
+
+	return p, true
+}
+
+func readOgg(b []byte, tail func() ([]byte, error)) (Info, error) {
+	first, ok := parseOggPage(b)
+	if !ok {
+		return Info{}, ErrUnknownFormat
+	}
+
+	info := Info{}
+	id := first.payload
+	// samples to skip at the beginning of Opus streams
+	var preSkip int64
+	switch {
+	case len(id) >= 28 && string(id[:7]) == "\x01vorbis":
+		info.Codec = "vorbis"
+		info.Channels = int(id[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(id[12:]))
+	case len(id) >= 19 && string(id[:8]) == "OpusHead":
+		info.Codec = "opus"
+		info.Channels = int(id[9])
+		// granule positions are always at 48 kHz
+		info.SampleRate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(id[10:]))
+	default:
+		return info, ErrUnknownFormat
+	}
+
+	end, err := tail()
+	if err != nil {
+		return info, nil
+	}
+	if granule := lastGranule(end, first.serial); granule > 0 {
+		info.Duration = samplesDuration(granule-preSkip, info.SampleRate)
+	}
+
+	return info, nil
+}
+
+// lastGranule returns the granule position of the last page of the stream
+// with serial found in b, or -1.
+func lastGranule(b []byte, serial uint32) int64 {
+	for i := len(b); i > 0; {
+		i = bytes.LastIndex(b[:i], []byte("OggS"))
+		if i < 0 {
+			break
+		}
+		p, ok := parseOggPage(b[i:])
+		if ok && p.serial == serial && p.granule != -1 {
+			return p.granule
+		}
+	}
+	return -1
+}
@@ -0,0 +1,133 @@
+package flac
+
+import "io"
+
+// bitReader reads big-endian bit fields from a byte stream, keeping the
+// CRC-8 and CRC-16 of every byte consumed so frame checksums can be verified.
+type bitReader struct {
+	r     io.ByteReader
+	x     uint64
+	n     uint
+	crc8  uint8
+	crc16 uint16
+}
+
+func newBitReader(r io.ByteReader) *bitReader {
+	return &bitReader{r: r}
+}
+
+func (br *bitReader) readByte() (byte, error) {
+	b, err := br.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	br.crc8 = crc8Table[br.crc8^b]
+	br.crc16 = br.crc16<<8 ^ crc16Table[byte(br.crc16>>8)^b]
+	return b, nil
+}
+
+// resetCRC starts a new checksum computation.
+func (br *bitReader) resetCRC() {
+	br.crc8 = 0
+	br.crc16 = 0
+}
+
+// read returns the next n (<= 57) bits as an unsigned integer.
+func (br *bitReader) read(n uint) (uint64, error) {
+	for br.n < n {
+		b, err := br.readByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		br.x = br.x<<8 | uint64(b)
+		br.n += 8
+	}
+	v := br.x >> (br.n - n) & (1<<n - 1)
+	br.n -= n
+	br.x &= 1<<br.n - 1
+	return v, nil
+}
+
+// readSigned returns the next n bits as a two's complement signed integer.
+func (br *bitReader) readSigned(n uint) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	v, err := br.read(n)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// readUnary counts the zero bits preceding the next one bit.
+func (br *bitReader) readUnary() (uint64, error) {
+	var q uint64
+	for {
+		if br.n == 0 {
+			b, err := br.readByte()
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			br.x = uint64(b)
+			br.n = 8
+		}
+		if br.x == 0 {
+			q += uint64(br.n)
+			br.n = 0
+			continue
+		}
+		for br.x>>(br.n-1)&1 == 0 {
+			q++
+			br.n--
+		}
+		br.n--
+		br.x &= 1<<br.n - 1
+		return q, nil
+	}
+}
+
+// align discards the bits left in the current byte.
+func (br *bitReader) align() {
+	br.n = 0
+	br.x = 0
+}
+
+var crc8Table = makeCRC8Table(0x07)
+var crc16Table = makeCRC16Table(0x8005)
+
+func makeCRC8Table(poly uint8) (t [256]uint8) {
+	for i := range t {
+		c := uint8(i)
+		for j := 0; j < 8; j++ {
+			if c&0x80 != 0 {
+				c = c<<1 ^ poly
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}
+
+func makeCRC16Table(poly uint16) (t [256]uint16) {
+	for i := range t {
+		c := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if c&0x8000 != 0 {
+				c = c<<1 ^ poly
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return t
+}
@@ -0,0 +1,163 @@
+// Package flac implements a FLAC (Free Lossless Audio Codec) stream decoder.
+package flac
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	ErrNoMarker     = errors.New("flac: missing fLaC stream marker")
+	ErrNoStreamInfo = errors.New("flac: first metadata block is not STREAMINFO")
+)
+
+const (
+	blockTypeStreamInfo = 0
+	streamInfoLength    = 34
+)
+
+// StreamInfo holds the properties of the whole stream, stored in the
+// mandatory STREAMINFO metadata block.
+type StreamInfo struct {
+	MinBlockSize  uint16
+	MaxBlockSize  uint16
+	MinFrameSize  uint32
+	MaxFrameSize  uint32
+	SampleRate    uint32
+	Channels      uint8
+	BitsPerSample uint8
+	// TotalSamples is the number of inter-channel samples, 0 if unknown.
+	TotalSamples uint64
+	MD5          [16]byte
+}
+
+// Decoder decodes the audio frames of a FLAC stream.
+type Decoder struct {
+	Info StreamInfo
+
+	br      *bitReader
+	decoded uint64
+}
+
+// ReadStreamInfo reads the stream marker and the STREAMINFO block from r,
+// leaving r positioned at the following metadata block.
+func ReadStreamInfo(r io.Reader) (StreamInfo, bool, error) {
+	info := StreamInfo{}
+
+	var marker [4]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil {
+		return info, false, err
+	}
+	if string(marker[:]) != "fLaC" {
+		return info, false, ErrNoMarker
+	}
+
+	last, typ, length, err := readBlockHeader(r)
+	if err != nil {
+		return info, false, err
+	}
+	if typ != blockTypeStreamInfo || length != streamInfoLength {
+		return info, false, ErrNoStreamInfo
+	}
+
+	var b [streamInfoLength]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return info, false, err
+	}
+	info.MinBlockSize = binary.BigEndian.Uint16(b[0:])
+	info.MaxBlockSize = binary.BigEndian.Uint16(b[2:])
+	info.MinFrameSize = uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6])
+	info.MaxFrameSize = uint32(b[7])<<16 | uint32(b[8])<<8 | uint32(b[9])
+	x := binary.BigEndian.Uint64(b[10:])
+	info.SampleRate = uint32(x >> 44)
+	info.Channels = uint8(x>>41&0x7) + 1
+	info.BitsPerSample = uint8(x>>36&0x1f) + 1
+	info.TotalSamples = x & (1<<36 - 1)
+	copy(info.MD5[:], b[18:])
+
+	if info.SampleRate == 0 {
+		return info, false, errors.New("flac: invalid sample rate 0")
+	}
+
+	return info, last, nil
+}
+
+// NewDecoder reads the stream metadata from r and returns a Decoder ready to
+// decode the first audio frame.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		b := bufio.NewReader(r)
+		r, br = b, b
+	}
+
+	info, last, err := ReadStreamInfo(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip the remaining metadata blocks (seek tables, vorbis comments,
+	// pictures...), tags are read by the indexer.
+	for !last {
+		var length uint32
+		last, _, length, err = readBlockHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, int64(length)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Decoder{Info: info, br: newBitReader(br)}, nil
+}
+
+// SampleRate returns the stream sample rate in Hz.
+func (d *Decoder) SampleRate() int {
+	return int(d.Info.SampleRate)
+}
+
+// Channels returns the number of channels in the stream.
+func (d *Decoder) Channels() int {
+	return int(d.Info.Channels)
+}
+
+// BitsPerSample returns the sample resolution of the stream.
+func (d *Decoder) BitsPerSample() int {
+	return int(d.Info.BitsPerSample)
+}
+
+// Next decodes the next audio frame. io.EOF is returned when the stream has
+// no more frames.
+func (d *Decoder) Next() (*Frame, error) {
+	if d.Info.TotalSamples > 0 && d.decoded >= d.Info.TotalSamples {
+		return nil, io.EOF
+	}
+
+	f, err := d.parseFrame()
+	if err != nil {
+		return nil, err
+	}
+	d.decoded += uint64(f.BlockSize)
+
+	return f, nil
+}
+
+func readBlockHeader(r io.Reader) (bool, uint8, uint32, error) {
+	var h [4]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return false, 0, 0, err
+	}
+	last := h[0]&0x80 != 0
+	typ := h[0] & 0x7f
+	length := uint32(h[1])<<16 | uint32(h[2])<<8 | uint32(h[3])
+	if typ == 127 {
+		return false, 0, 0, fmt.Errorf("flac: invalid metadata block type %d", typ)
+	}
+
+	return last, typ, length, nil
+}
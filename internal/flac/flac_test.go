@@ -0,0 +1,426 @@
+package flac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+// The fixtures are generated by a minimal FLAC encoder so the tests don't
+// depend on external tools or binary files.
+
+type bitWriter struct {
+	buf []byte
+	x   uint64
+	n   uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.x = w.x<<1 | v>>uint(i)&1
+		w.n++
+		if w.n == 8 {
+			w.buf = append(w.buf, byte(w.x))
+			w.x, w.n = 0, 0
+		}
+	}
+}
+
+func (w *bitWriter) writeSigned(v int64, n uint) {
+	w.write(uint64(v)&(1<<n-1), n)
+}
+
+func (w *bitWriter) writeUnary(q uint64) {
+	for ; q > 0; q-- {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+}
+
+func (w *bitWriter) align() {
+	if w.n > 0 {
+		w.write(0, 8-w.n)
+	}
+}
+
+type subframeKind int
+
+const (
+	kindVerbatim subframeKind = iota
+	kindFixed
+	kindLPC
+)
+
+type fixture struct {
+	rate     int
+	bps      int
+	chanCode int // channel assignment, 0-7 independent channels
+	kind     subframeKind
+	// total samples written to STREAMINFO, unknown if false
+	knownLength bool
+	blockSize   int
+	samples     [][]int32
+}
+
+func (f fixture) encode() []byte {
+	w := &bitWriter{}
+	w.buf = append(w.buf, "fLaC"...)
+
+	channels := len(f.samples)
+	total := len(f.samples[0])
+
+	// STREAMINFO
+	w.write(0, 1)
+	w.write(blockTypeStreamInfo, 7)
+	w.write(streamInfoLength, 24)
+	w.write(uint64(f.blockSize), 16)
+	w.write(uint64(f.blockSize), 16)
+	w.write(0, 24)
+	w.write(0, 24)
+	w.write(uint64(f.rate), 20)
+	w.write(uint64(channels-1), 3)
+	w.write(uint64(f.bps-1), 5)
+	if f.knownLength {
+		w.write(uint64(total), 36)
+	} else {
+		w.write(0, 36)
+	}
+	w.write(0, 64)
+	w.write(0, 64)
+
+	// A padding block the decoder has to skip
+	w.write(1, 1)
+	w.write(1, 7)
+	w.write(8, 24)
+	w.write(0, 64)
+
+	for frame, start := 0, 0; start < total; frame, start = frame+1, start+f.blockSize {
+		end := start + f.blockSize
+		if end > total {
+			end = total
+		}
+		block := make([][]int32, channels)
+		for ch := range block {
+			block[ch] = f.samples[ch][start:end]
+		}
+		f.encodeFrame(w, frame, block)
+	}
+
+	return w.buf
+}
+
+func (f fixture) encodeFrame(w *bitWriter, frame int, block [][]int32) {
+	start := len(w.buf)
+	n := len(block[0])
+
+	w.write(0xfff8, 16)
+	w.write(7, 4) // 16 bit block size at the end of the header
+	w.write(0, 4) // sample rate from STREAMINFO
+	w.write(uint64(f.chanCode), 4)
+	w.write(0, 3) // sample size from STREAMINFO
+	w.write(0, 1)
+	w.write(uint64(frame), 8) // frame number, single byte
+	w.write(uint64(n-1), 16)
+	w.write(uint64(checksum8(w.buf[start:])), 8)
+
+	chans := correlate(f.chanCode, block)
+	for ch, s := range chans {
+		bps := uint(f.bps)
+		switch {
+		case f.chanCode == leftSide && ch == 1,
+			f.chanCode == rightSide && ch == 0,
+			f.chanCode == midSide && ch == 1:
+			bps++
+		}
+		f.encodeSubframe(w, s, bps)
+	}
+
+	w.align()
+	w.write(uint64(checksum16(w.buf[start:])), 16)
+}
+
+func (f fixture) encodeSubframe(w *bitWriter, s []int32, bps uint) {
+	constant := true
+	for _, v := range s {
+		if v != s[0] {
+			constant = false
+		}
+	}
+	if constant {
+		w.write(subframeConstant<<1, 8)
+		w.writeSigned(int64(s[0]), bps)
+		return
+	}
+
+	// Samples with a common power of two factor use wasted bits.
+	wasted := uint(0)
+	for ; wasted < 4; wasted++ {
+		ok := true
+		for _, v := range s {
+			if v&(1<<(wasted+1)-1) != 0 {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	if wasted > 0 {
+		shifted := make([]int32, len(s))
+		for i, v := range s {
+			shifted[i] = v >> wasted
+		}
+		s = shifted
+		bps -= wasted
+	}
+	wastedFlag := uint64(0)
+	if wasted > 0 {
+		wastedFlag = 1
+	}
+
+	order := 2
+	if len(s) <= order {
+		f.kind = kindVerbatim
+	}
+
+	switch f.kind {
+	case kindVerbatim:
+		w.write(subframeVerbatim<<1|wastedFlag, 8)
+		if wasted > 0 {
+			w.writeUnary(uint64(wasted - 1))
+		}
+		for _, v := range s {
+			w.writeSigned(int64(v), bps)
+		}
+		return
+	case kindFixed:
+		w.write(uint64(8+order)<<1|wastedFlag, 8)
+	case kindLPC:
+		w.write(uint64(32+order-1)<<1|wastedFlag, 8)
+	}
+	if wasted > 0 {
+		w.writeUnary(uint64(wasted - 1))
+	}
+	for _, v := range s[:order] {
+		w.writeSigned(int64(v), bps)
+	}
+
+	residual := make([]int64, 0, len(s))
+	if f.kind == kindLPC {
+		// Second order predictor with a non trivial shift:
+		// (7*s[i-1] - 3*s[i-2]) >> 2
+		w.write(14, 4) // 15 bit coefficients
+		w.writeSigned(2, 5)
+		w.writeSigned(7, 15)
+		w.writeSigned(-3, 15)
+		for i := order; i < len(s); i++ {
+			pred := (7*int64(s[i-1]) - 3*int64(s[i-2])) >> 2
+			residual = append(residual, int64(s[i])-pred)
+		}
+	} else {
+		for i := order; i < len(s); i++ {
+			residual = append(residual, int64(s[i])-2*int64(s[i-1])+int64(s[i-2]))
+		}
+	}
+
+	// Rice coding, method 0, partition order 0.
+	var sum uint64
+	for _, r := range residual {
+		sum += zigzag(r)
+	}
+	k := uint(0)
+	if len(residual) > 0 {
+		for mean := sum / uint64(len(residual)); mean > 1 && k < 14; mean >>= 1 {
+			k++
+		}
+	}
+	w.write(0, 2)
+	w.write(0, 4)
+	w.write(uint64(k), 4)
+	for _, r := range residual {
+		z := zigzag(r)
+		w.writeUnary(z >> k)
+		w.write(z&(1<<k-1), k)
+	}
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1 ^ v>>63)
+}
+
+func correlate(chanCode int, block [][]int32) [][]int32 {
+	if chanCode < leftSide {
+		return block
+	}
+	l, r := block[0], block[1]
+	a := make([]int32, len(l))
+	b := make([]int32, len(l))
+	for i := range l {
+		switch chanCode {
+		case leftSide:
+			a[i], b[i] = l[i], l[i]-r[i]
+		case rightSide:
+			a[i], b[i] = l[i]-r[i], r[i]
+		case midSide:
+			a[i], b[i] = (l[i]+r[i])>>1, l[i]-r[i]
+		}
+	}
+	return [][]int32{a, b}
+}
+
+func checksum8(b []byte) uint8 {
+	var crc uint8
+	for _, c := range b {
+		crc = crc8Table[crc^c]
+	}
+	return crc
+}
+
+func checksum16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^c]
+	}
+	return crc
+}
+
+func tone(n, channels, bps int) [][]int32 {
+	amp := float64(int64(1)<<(bps-1)-1) * 0.8
+	s := make([][]int32, channels)
+	for ch := range s {
+		s[ch] = make([]int32, n)
+		for i := range s[ch] {
+			v := math.Sin(float64(i)*0.05*float64(ch+1)) * amp
+			// a bit of deterministic noise so residuals aren't trivial
+			v += float64((i*7919+ch*104729)%17-8) * amp / 1000
+			s[ch][i] = int32(v)
+		}
+	}
+	return s
+}
+
+func decodeAll(t *testing.T, data []byte) (*Decoder, [][]int32) {
+	t.Helper()
+
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make([][]int32, d.Channels())
+	for {
+		f, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ch, s := range f.Samples {
+			out[ch] = append(out[ch], s...)
+		}
+	}
+	return d, out
+}
+
+func assertSamples(t *testing.T, want, got [][]int32) {
+	t.Helper()
+
+	if len(want) != len(got) {
+		t.Fatalf("expected %d channels, got %d", len(want), len(got))
+	}
+	for ch := range want {
+		if len(want[ch]) != len(got[ch]) {
+			t.Fatalf("channel %d: expected %d samples, got %d", ch, len(want[ch]), len(got[ch]))
+		}
+		for i := range want[ch] {
+			if want[ch][i] != got[ch][i] {
+				t.Fatalf("channel %d sample %d: expected %d, got %d", ch, i, want[ch][i], got[ch][i])
+			}
+		}
+	}
+}
+
+func TestStreamInfo(t *testing.T) {
+	f := fixture{rate: 44100, bps: 16, chanCode: 1, blockSize: 4096, knownLength: true, samples: tone(1000, 2, 16)}
+
+	info, last, err := ReadStreamInfo(bytes.NewReader(f.encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last {
+		t.Error("STREAMINFO should not be the last metadata block")
+	}
+	if info.SampleRate != 44100 || info.Channels != 2 || info.BitsPerSample != 16 {
+		t.Errorf("unexpected stream info %+v", info)
+	}
+	if info.TotalSamples != 1000 || info.MaxBlockSize != 4096 {
+		t.Errorf("unexpected stream info %+v", info)
+	}
+
+	_, _, err = ReadStreamInfo(bytes.NewReader([]byte("ID3\x03\x00\x00\x00\x00\x00\x00")))
+	if err != ErrNoMarker {
+		t.Errorf("expected ErrNoMarker, got %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := map[string]fixture{
+		"16 bit stereo fixed":     {rate: 44100, bps: 16, chanCode: 1, kind: kindFixed, blockSize: 1152, samples: tone(5000, 2, 16)},
+		"16 bit stereo verbatim":  {rate: 48000, bps: 16, chanCode: 1, kind: kindVerbatim, blockSize: 576, samples: tone(2000, 2, 16)},
+		"24 bit mono lpc":         {rate: 96000, bps: 24, chanCode: 0, kind: kindLPC, blockSize: 4096, samples: tone(9000, 1, 24)},
+		"24 bit stereo mid/side":  {rate: 48000, bps: 24, chanCode: midSide, kind: kindFixed, blockSize: 1024, samples: tone(3000, 2, 24)},
+		"16 bit left/side":        {rate: 44100, bps: 16, chanCode: leftSide, kind: kindLPC, blockSize: 1024, samples: tone(3000, 2, 16)},
+		"16 bit right/side":       {rate: 44100, bps: 16, chanCode: rightSide, kind: kindFixed, blockSize: 1024, samples: tone(3000, 2, 16)},
+		"16 bit 5.1 channels":     {rate: 48000, bps: 16, chanCode: 5, kind: kindFixed, blockSize: 2048, samples: tone(4100, 6, 16)},
+		"unknown length":          {rate: 22050, bps: 16, chanCode: 0, kind: kindFixed, blockSize: 512, samples: tone(1300, 1, 16)},
+		"8 bit mono verbatim":     {rate: 8000, bps: 8, chanCode: 0, kind: kindVerbatim, blockSize: 256, samples: tone(700, 1, 8)},
+		"tiny trailing frame":     {rate: 44100, bps: 16, chanCode: 1, kind: kindFixed, blockSize: 1000, samples: tone(1001, 2, 16)},
+		"short known length file": {rate: 44100, bps: 16, chanCode: 1, kind: kindFixed, knownLength: true, blockSize: 4096, samples: tone(100, 2, 16)},
+	}
+
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, got := decodeAll(t, f.encode())
+			if d.SampleRate() != f.rate {
+				t.Errorf("expected sample rate %d, got %d", f.rate, d.SampleRate())
+			}
+			if d.BitsPerSample() != f.bps {
+				t.Errorf("expected %d bits per sample, got %d", f.bps, d.BitsPerSample())
+			}
+			assertSamples(t, f.samples, got)
+		})
+	}
+}
+
+func TestDecodeConstantAndWastedBits(t *testing.T) {
+	n := 2000
+	samples := [][]int32{make([]int32, n), make([]int32, n)}
+	for i := 0; i < n; i++ {
+		samples[0][i] = 1234
+		// multiples of 8 exercise the wasted bits path
+		samples[1][i] = int32((i%50 - 25) * 8)
+	}
+	f := fixture{rate: 44100, bps: 16, chanCode: 1, kind: kindFixed, blockSize: 1024, samples: samples}
+
+	_, got := decodeAll(t, f.encode())
+	assertSamples(t, samples, got)
+}
+
+func TestDecodeBadCRC(t *testing.T) {
+	f := fixture{rate: 44100, bps: 16, chanCode: 1, kind: kindFixed, blockSize: 1024, samples: tone(1024, 2, 16)}
+	data := f.encode()
+	// corrupt the last byte of the frame payload, before the CRC-16
+	data[len(data)-3] ^= 0x55
+
+	d, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Next()
+	if err == nil {
+		t.Fatal("expected an error decoding a corrupted frame")
+	}
+}
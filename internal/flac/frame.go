@@ -0,0 +1,460 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrBadCRC8  = errors.New("flac: frame header CRC-8 mismatch")
+	ErrBadCRC16 = errors.New("flac: frame CRC-16 mismatch")
+)
+
+// Channel assignments, as stored in the frame header.
+const (
+	leftSide  = 8
+	rightSide = 9
+	midSide   = 10
+)
+
+// Subframe types.
+const (
+	subframeConstant = 0
+	subframeVerbatim = 1
+)
+
+// Frame is a decoded block of audio.
+type Frame struct {
+	BlockSize     int
+	SampleRate    int
+	BitsPerSample int
+	// Samples holds BlockSize samples for every channel, in FLAC
+	// channel order.
+	Samples [][]int32
+}
+
+func (d *Decoder) parseFrame() (*Frame, error) {
+	br := d.br
+	br.align()
+	br.resetCRC()
+
+	// Look for the 14 bit sync code (0b11111111111110), skipping garbage.
+	b, err := br.readByte()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if b != 0xff {
+			b, err = br.readByte()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		br.resetCRC()
+		br.crc8 = crc8Table[0xff]
+		br.crc16 = crc16Table[0xff]
+		b, err = br.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if b&0xfe == 0xf8 {
+			break
+		}
+	}
+
+	h, err := br.read(16)
+	if err != nil {
+		return nil, err
+	}
+	bsCode := h >> 12
+	srCode := h >> 8 & 0xf
+	chanCode := int(h >> 4 & 0xf)
+	bpsCode := h >> 1 & 0x7
+	if h&1 != 0 {
+		return nil, errors.New("flac: reserved frame header bit set")
+	}
+
+	// Frame or sample number, UTF-8 like coded. Only validated.
+	if err := d.skipCodedNumber(); err != nil {
+		return nil, err
+	}
+
+	f := &Frame{}
+	switch {
+	case bsCode == 0:
+		return nil, errors.New("flac: reserved block size")
+	case bsCode == 1:
+		f.BlockSize = 192
+	case bsCode <= 5:
+		f.BlockSize = 576 << (bsCode - 2)
+	case bsCode == 6:
+		v, err := br.read(8)
+		if err != nil {
+			return nil, err
+		}
+		f.BlockSize = int(v) + 1
+	case bsCode == 7:
+		v, err := br.read(16)
+		if err != nil {
+			return nil, err
+		}
+		f.BlockSize = int(v) + 1
+	default:
+		f.BlockSize = 256 << (bsCode - 8)
+	}
+
+	switch srCode {
+	case 0:
+		f.SampleRate = int(d.Info.SampleRate)
+	case 12:
+		v, err := br.read(8)
+		if err != nil {
+			return nil, err
+		}
+		f.SampleRate = int(v) * 1000
+	case 13, 14:
+		v, err := br.read(16)
+		if err != nil {
+			return nil, err
+		}
+		f.SampleRate = int(v)
+		if srCode == 14 {
+			f.SampleRate *= 10
+		}
+	case 15:
+		return nil, errors.New("flac: invalid sample rate code")
+	default:
+		f.SampleRate = sampleRates[srCode]
+	}
+
+	switch bpsCode {
+	case 0:
+		f.BitsPerSample = int(d.Info.BitsPerSample)
+	case 3:
+		return nil, errors.New("flac: reserved sample size")
+	default:
+		f.BitsPerSample = sampleSizes[bpsCode]
+	}
+
+	crc := br.crc8
+	v, err := br.read(8)
+	if err != nil {
+		return nil, err
+	}
+	if uint8(v) != crc {
+		return nil, ErrBadCRC8
+	}
+
+	channels := chanCode + 1
+	if chanCode >= leftSide {
+		if chanCode > midSide {
+			return nil, fmt.Errorf("flac: reserved channel assignment %d", chanCode)
+		}
+		channels = 2
+	}
+
+	f.Samples = make([][]int32, channels)
+	for ch := range f.Samples {
+		bps := f.BitsPerSample
+		switch {
+		case chanCode == leftSide && ch == 1,
+			chanCode == rightSide && ch == 0,
+			chanCode == midSide && ch == 1:
+			// side channels have one extra bit
+			bps++
+		}
+		samples := make([]int32, f.BlockSize)
+		if err := d.parseSubframe(samples, uint(bps)); err != nil {
+			return nil, err
+		}
+		f.Samples[ch] = samples
+	}
+
+	br.align()
+	crc16 := br.crc16
+	v, err = br.read(16)
+	if err != nil {
+		return nil, err
+	}
+	if uint16(v) != crc16 {
+		return nil, ErrBadCRC16
+	}
+
+	decorrelate(chanCode, f.Samples)
+
+	return f, nil
+}
+
+var sampleRates = [...]int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000}
+var sampleSizes = [...]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+func (d *Decoder) skipCodedNumber() error {
+	b, err := d.br.read(8)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for mask := uint64(0x80); b&mask != 0; mask >>= 1 {
+		n++
+	}
+	if n == 1 || n > 7 {
+		return errors.New("flac: invalid coded frame number")
+	}
+	for i := 1; i < n; i++ {
+		c, err := d.br.read(8)
+		if err != nil {
+			return err
+		}
+		if c&0xc0 != 0x80 {
+			return errors.New("flac: invalid coded frame number")
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) parseSubframe(samples []int32, bps uint) error {
+	br := d.br
+
+	h, err := br.read(8)
+	if err != nil {
+		return err
+	}
+	if h&0x80 != 0 {
+		return errors.New("flac: invalid subframe padding")
+	}
+	typ := h >> 1 & 0x3f
+
+	wasted := uint(0)
+	if h&1 != 0 {
+		w, err := br.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = uint(w) + 1
+		if wasted >= bps {
+			return errors.New("flac: invalid wasted bits")
+		}
+		bps -= wasted
+	}
+
+	switch {
+	case typ == subframeConstant:
+		v, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i] = int32(v)
+		}
+	case typ == subframeVerbatim:
+		for i := range samples {
+			v, err := br.readSigned(bps)
+			if err != nil {
+				return err
+			}
+			samples[i] = int32(v)
+		}
+	case typ >= 8 && typ <= 12:
+		if err := d.parseFixed(samples, bps, int(typ-8)); err != nil {
+			return err
+		}
+	case typ >= 32:
+		if err := d.parseLPC(samples, bps, int(typ-31)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("flac: reserved subframe type %d", typ)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+
+	return nil
+}
+
+func (d *Decoder) readWarmup(samples []int32, bps uint, order int) error {
+	if order > len(samples) {
+		return errors.New("flac: predictor order larger than block size")
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = int32(v)
+	}
+	return nil
+}
+
+func (d *Decoder) parseFixed(samples []int32, bps uint, order int) error {
+	if err := d.readWarmup(samples, bps, order); err != nil {
+		return err
+	}
+	if err := d.parseResidual(samples, order); err != nil {
+		return err
+	}
+
+	s := samples
+	switch order {
+	case 1:
+		for i := 1; i < len(s); i++ {
+			s[i] += s[i-1]
+		}
+	case 2:
+		for i := 2; i < len(s); i++ {
+			s[i] += 2*s[i-1] - s[i-2]
+		}
+	case 3:
+		for i := 3; i < len(s); i++ {
+			s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+		}
+	case 4:
+		for i := 4; i < len(s); i++ {
+			s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) parseLPC(samples []int32, bps uint, order int) error {
+	br := d.br
+	if err := d.readWarmup(samples, bps, order); err != nil {
+		return err
+	}
+
+	p, err := br.read(4)
+	if err != nil {
+		return err
+	}
+	if p == 0xf {
+		return errors.New("flac: invalid LPC coefficient precision")
+	}
+	precision := uint(p) + 1
+
+	shift, err := br.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return errors.New("flac: negative LPC shift")
+	}
+
+	coeffs := make([]int64, order)
+	for i := range coeffs {
+		c, err := br.readSigned(precision)
+		if err != nil {
+			return err
+		}
+		coeffs[i] = c
+	}
+
+	if err := d.parseResidual(samples, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += c * int64(samples[i-j-1])
+		}
+		samples[i] += int32(sum >> uint(shift))
+	}
+	return nil
+}
+
+// parseResidual decodes the Rice coded residual into samples[order:].
+func (d *Decoder) parseResidual(samples []int32, order int) error {
+	br := d.br
+
+	method, err := br.read(2)
+	if err != nil {
+		return err
+	}
+	var paramBits uint
+	switch method {
+	case 0:
+		paramBits = 4
+	case 1:
+		paramBits = 5
+	default:
+		return fmt.Errorf("flac: reserved residual coding method %d", method)
+	}
+	escape := uint64(1)<<paramBits - 1
+
+	po, err := br.read(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << po
+	if len(samples)%partitions != 0 || len(samples)>>po < order {
+		return errors.New("flac: invalid residual partition order")
+	}
+	psize := len(samples) >> po
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		n := psize
+		if p == 0 {
+			n -= order
+		}
+
+		k, err := br.read(paramBits)
+		if err != nil {
+			return err
+		}
+
+		if k == escape {
+			bits, err := br.read(5)
+			if err != nil {
+				return err
+			}
+			for j := 0; j < n; j++ {
+				v, err := br.readSigned(uint(bits))
+				if err != nil {
+					return err
+				}
+				samples[i] = int32(v)
+				i++
+			}
+			continue
+		}
+
+		for j := 0; j < n; j++ {
+			q, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+			r, err := br.read(uint(k))
+			if err != nil {
+				return err
+			}
+			v := q<<k | r
+			samples[i] = int32(v>>1) ^ -int32(v&1)
+			i++
+		}
+	}
+	return nil
+}
+
+func decorrelate(chanCode int, s [][]int32) {
+	switch chanCode {
+	case leftSide:
+		for i, side := range s[1] {
+			s[1][i] = s[0][i] - side
+		}
+	case rightSide:
+		for i, side := range s[0] {
+			s[0][i] = side + s[1][i]
+		}
+	case midSide:
+		for i, side := range s[1] {
+			mid := s[0][i]<<1 | side&1
+			s[0][i] = (mid + side) >> 1
+			s[1][i] = (mid - side) >> 1
+		}
+	}
+}
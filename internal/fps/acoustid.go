@@ -0,0 +1,87 @@
+package fps
+
+import (
+	"context"
+
+	"github.com/rubiojr/rplay/internal/acoustid"
+)
+
+// Options change how matches are chosen.
+type Options struct {
+	// lowest confidence of the matches used, from 0 to 1
+	MinConfidence float64
+	// if set, picks the match for a song from the best candidates, nil
+	// to skip the song (ErrSkipped). Picks are cached like other matches.
+	Choose func(id string, candidates []Candidate) *Candidate
+	// calculates the fingerprint of a file, acoustid.NewFingerprint if
+	// not set
+	Fingerprint func(path string) (acoustid.Fingerprint, error)
+}
+
+// choiceCandidates is the number of candidates to choose from.
+const choiceCandidates = 5
+
+// AcoustIDProvider fingerprints songs and looks them up in AcoustID.
+type AcoustIDProvider struct {
+	client *acoustid.Client
+	opts   Options
+}
+
+func NewAcoustIDProvider(client *acoustid.Client, opts Options) *AcoustIDProvider {
+	if opts.Fingerprint == nil {
+		opts.Fingerprint = acoustid.NewFingerprint
+	}
+	return &AcoustIDProvider{client: client, opts: opts}
+}
+
+func (p *AcoustIDProvider) Name() string {
+	return ProviderAcoustID
+}
+
+func (p *AcoustIDProvider) Lookup(ctx context.Context, song *Song, found *Metadata) (*Metadata, error) {
+	path, err := song.File(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := p.opts.Fingerprint(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Lookup(ctx, fp)
+	if err != nil {
+		return nil, err
+	}
+
+	// returned when not found too, to be cached
+	lookup := &Metadata{FileID: song.ID, Fingerprint: fp.String(), Duration: fp.Duration()}
+	candidates := Candidates(resp, fp.Duration())
+	if len(candidates) == 0 {
+		return lookup, ErrMetadataNotFound
+	}
+
+	best := &candidates[0]
+	chosen := false
+	if p.opts.Choose != nil {
+		if len(candidates) > choiceCandidates {
+			candidates = candidates[:choiceCandidates]
+		}
+		if best = p.opts.Choose(song.ID, candidates); best == nil {
+			return nil, ErrSkipped
+		}
+		chosen = true
+	} else if best.Confidence < p.opts.MinConfidence {
+		return nil, ErrLowConfidence
+	}
+
+	m := lookup
+	m.Artist = best.Artist
+	m.Title = best.Title
+	m.Album = best.Album
+	m.RecordingID = best.RecordingID
+	m.ReleaseGroupID = best.ReleaseGroupID
+	m.Confidence = best.Confidence
+	m.Score = best.Score
+	m.Chosen = chosen
+	return m, nil
+}
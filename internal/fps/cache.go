@@ -0,0 +1,186 @@
+package fps
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm"
+	"github.com/asdine/storm/q"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTimeout is how long to wait for another rplay using the cache.
+const openTimeout = 10 * time.Second
+
+// Cache keeps the metadata found by remote providers in a storm database,
+// and the songs they didn't find for NegativeTTL.
+type Cache struct {
+	dbPath string
+	// how long songs not found are cached, 0 to not cache them
+	NegativeTTL time.Duration
+
+	// the database is opened once while it's used, it can't be opened
+	// again until closed
+	mu    sync.Mutex
+	db    *storm.DB
+	users int
+}
+
+func NewCache(dbPath string) *Cache {
+	return &Cache{dbPath: dbPath, NegativeTTL: DefaultNegativeTTL}
+}
+
+func (c *Cache) Name() string {
+	return ProviderCache
+}
+
+func (c *Cache) Lookup(ctx context.Context, song *Song, found *Metadata) (*Metadata, error) {
+	return c.Cached(song.ID)
+}
+
+// open returns the database, opening it if it's not in use. Every call
+// needs a call to close.
+func (c *Cache) open() (*storm.DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		db, err := storm.Open(c.dbPath, storm.BoltOptions(0600, &bolt.Options{Timeout: openTimeout}))
+		if err != nil {
+			return nil, err
+		}
+		c.db = db
+	}
+	c.users++
+	return c.db, nil
+}
+
+// close closes the database once no one uses it.
+func (c *Cache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.users--; c.users > 0 {
+		return nil
+	}
+	err := c.db.Close()
+	c.db = nil
+	return err
+}
+
+// Cached returns the metadata stored for a song. Songs not found recently
+// return ErrCachedNotFound.
+func (c *Cache) Cached(id string) (*Metadata, error) {
+	meta, err := c.Entry(id)
+	if err != nil {
+		return nil, err
+	}
+	if meta.NotFound {
+		if time.Since(meta.Updated) < c.NegativeTTL {
+			return nil, ErrCachedNotFound
+		}
+		return nil, ErrMetadataNotFound
+	}
+
+	meta.Cached = true
+	if meta.Sources == nil {
+		// cached before there were other providers
+		meta.Sources = map[string]string{}
+		for _, f := range Fields {
+			if *meta.Field(f) != "" {
+				meta.Sources[f] = ProviderAcoustID
+			}
+		}
+	}
+	return meta, nil
+}
+
+// Entry returns what's stored for a song, found or not.
+func (c *Cache) Entry(id string) (*Metadata, error) {
+	db, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	meta := &Metadata{}
+	err = db.One("FileID", id, meta)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, ErrMetadataNotFound
+	}
+	return meta, err
+}
+
+// Entries returns what's stored for every song.
+func (c *Cache) Entries() ([]*Metadata, error) {
+	db, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	list := []*Metadata{}
+	return list, db.All(&list)
+}
+
+// Save stores the metadata of songs, replacing what was stored.
+func (c *Cache) Save(list ...*Metadata) error {
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	for _, m := range list {
+		if m.Updated.IsZero() {
+			m.Updated = time.Now()
+		}
+		if err := db.Save(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveNotFound records that the remote providers didn't find a song. lookup
+// has the AcoustID fingerprint, if any.
+func (c *Cache) SaveNotFound(id string, lookup *Metadata) error {
+	m := &Metadata{FileID: id, NotFound: true}
+	if lookup != nil {
+		m.Fingerprint = lookup.Fingerprint
+		m.Duration = lookup.Duration
+	}
+	return c.Save(m)
+}
+
+// Delete removes what's stored for a song.
+func (c *Cache) Delete(id string) error {
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	err = db.DeleteStruct(&Metadata{FileID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return ErrMetadataNotFound
+	}
+	return err
+}
+
+// PurgeNotFound removes the songs not found, so they're looked up again.
+// Returns the number of songs removed.
+func (c *Cache) PurgeNotFound() (int, error) {
+	db, err := c.open()
+	if err != nil {
+		return 0, err
+	}
+	defer c.close()
+
+	query := db.Select(q.Eq("NotFound", true))
+	n, err := query.Count(&Metadata{})
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return n, query.Delete(&Metadata{})
+}
@@ -0,0 +1,116 @@
+package fps
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/rubiojr/rplay/internal/acoustid"
+)
+
+// Candidate is a recording and release that may match a song.
+type Candidate struct {
+	Artist string
+	Title  string
+	Album  string
+
+	RecordingID      string
+	ReleaseGroupID   string
+	ReleaseGroupType string
+	SecondaryTypes   []string
+	// recording length in seconds, 0 if unknown
+	Duration float64
+	// AcoustID score of the fingerprint match
+	Score float64
+	// from 0 to 1, the score weighed by how well the duration and
+	// release match
+	Confidence float64
+}
+
+// Candidates returns the recordings matching a song, with each release
+// group they're in, best matches first. duration is the length of the song
+// in seconds.
+func Candidates(resp *acoustid.AcoustIDResponse, duration int) []Candidate {
+	list := []Candidate{}
+	seen := map[string]bool{}
+	for _, result := range resp.Results {
+		for _, rec := range result.Recordings {
+			c := Candidate{
+				Title:       rec.Title,
+				RecordingID: rec.ID,
+				Duration:    rec.Duration,
+				Score:       result.Score,
+			}
+			if len(rec.Artists) > 0 {
+				names := []string{}
+				for _, a := range rec.Artists {
+					names = append(names, a.Name)
+				}
+				c.Artist = strings.Join(names, ", ")
+			}
+
+			add := func(c Candidate) {
+				c.Confidence = c.Score * durationMatch(c.Duration, duration) * releaseMatch(&c)
+				key := c.Artist + "\x00" + c.Title + "\x00" + c.Album
+				if seen[key] {
+					return
+				}
+				seen[key] = true
+				list = append(list, c)
+			}
+			if len(rec.ReleaseGroups) == 0 {
+				add(c)
+			}
+			for _, rg := range rec.ReleaseGroups {
+				c := c
+				c.Album = rg.Title
+				c.ReleaseGroupID = rg.ID
+				c.ReleaseGroupType = rg.Type
+				c.SecondaryTypes = rg.SecondaryTypes
+				add(c)
+			}
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Confidence > list[j].Confidence
+	})
+	return list
+}
+
+// durationMatch is 1 for recordings as long as the song, lower the more
+// they differ, down to 0.5.
+func durationMatch(recording float64, song int) float64 {
+	if recording == 0 || song == 0 {
+		// can't tell
+		return 0.9
+	}
+	diff := math.Abs(recording - float64(song))
+	if diff <= 3 {
+		return 1
+	}
+	return 1 - math.Min(diff-3, 30)/60
+}
+
+// releaseMatch prefers studio albums, then singles and EPs, over
+// compilations, live albums and other releases.
+func releaseMatch(c *Candidate) float64 {
+	m := 0.85
+	switch c.ReleaseGroupType {
+	case "Album":
+		m = 1
+	case "Single", "EP":
+		m = 0.95
+	}
+	for _, t := range c.SecondaryTypes {
+		switch t {
+		case "Compilation":
+			m = math.Min(m, 0.8)
+		case "Live":
+			m = math.Min(m, 0.9)
+		default:
+			m = math.Min(m, 0.85)
+		}
+	}
+	return m
+}
@@ -0,0 +1,67 @@
+package fps
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rubiojr/rplay/internal/acoustid"
+)
+
+const lookupResponse = `{
+  "status": "ok",
+  "results": [{
+    "score": 0.6,
+    "recordings": [{
+      "id": "wrong",
+      "title": "Other Song",
+      "duration": 180,
+      "artists": [{"name": "Someone"}],
+      "releasegroups": [{"title": "Other Album", "type": "Album"}]
+    }]
+  }, {
+    "score": 0.95,
+    "recordings": [{
+      "id": "live",
+      "title": "Song",
+      "duration": 260,
+      "artists": [{"name": "Artist"}],
+      "releasegroups": [{"title": "Live at Home", "type": "Album", "secondarytypes": ["Live"]}]
+    }, {
+      "id": "studio",
+      "title": "Song",
+      "duration": 213,
+      "artists": [{"name": "Artist"}, {"name": "Guest"}],
+      "releasegroups": [
+        {"title": "Greatest Hits", "type": "Album", "secondarytypes": ["Compilation"]},
+        {"title": "Song", "type": "Single"},
+        {"title": "Album", "type": "Album"}
+      ]
+    }]
+  }]
+}`
+
+func TestCandidates(t *testing.T) {
+	resp := &acoustid.AcoustIDResponse{}
+	if err := json.Unmarshal([]byte(lookupResponse), resp); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := Candidates(resp, 214)
+	want := []string{"Album", "Song", "Greatest Hits", "Live at Home", "Other Album"}
+	if len(candidates) != len(want) {
+		t.Fatalf("expected %d candidates, got %d", len(want), len(candidates))
+	}
+	for i, c := range candidates {
+		if c.Album != want[i] {
+			t.Errorf("candidate %d: expected %s, got %s (%.2f)", i, want[i], c.Album, c.Confidence)
+		}
+	}
+
+	best := candidates[0]
+	if best.Artist != "Artist, Guest" || best.RecordingID != "studio" || best.Confidence != 0.95 {
+		t.Errorf("unexpected best candidate %+v", best)
+	}
+	if candidates[4].Confidence >= DefaultMinConfidence {
+		t.Errorf("expected a low confidence for the wrong recording, got %.2f", candidates[4].Confidence)
+	}
+}
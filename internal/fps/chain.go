@@ -0,0 +1,232 @@
+package fps
+
+import (
+	"context"
+	"errors"
+)
+
+// remoteProviders are the providers whose results are cached.
+var remoteProviders = map[string]bool{
+	ProviderAcoustID:    true,
+	ProviderMusicBrainz: true,
+}
+
+// Chain asks providers for the metadata of songs in order. Each field
+// gets the value of the first provider that has one, so later providers
+// are only asked while fields are missing, or if they extend what was
+// found.
+type Chain struct {
+	providers []Provider
+	// stores what remote providers find, if it's one of the providers
+	cache *Cache
+}
+
+func NewChain(providers ...Provider) *Chain {
+	c := &Chain{providers: providers}
+	for _, p := range providers {
+		if cache, ok := p.(*Cache); ok {
+			c.cache = cache
+		}
+	}
+	return c
+}
+
+// Providers returns the names of the providers, in order.
+func (c *Chain) Providers() []string {
+	names := []string{}
+	for _, p := range c.providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Without returns a chain without the named providers.
+func (c *Chain) Without(names ...string) *Chain {
+	skip := map[string]bool{}
+	for _, n := range names {
+		skip[n] = true
+	}
+	providers := []Provider{}
+	for _, p := range c.providers {
+		if !skip[p.Name()] {
+			providers = append(providers, p)
+		}
+	}
+	return NewChain(providers...)
+}
+
+// Fingerprint returns the metadata found by the providers. Errors of a
+// provider are returned when no fields are found, or when it may have
+// found the ones missing. Songs the remote providers don't find are cached
+// too, and not looked up again for the cache NegativeTTL.
+func (c *Chain) Fingerprint(ctx context.Context, song *Song) (*Metadata, error) {
+	if c.cache != nil {
+		// kept open for the whole lookup
+		if _, err := c.cache.open(); err == nil {
+			defer c.cache.close()
+		}
+	}
+
+	found := &Metadata{FileID: song.ID, Sources: map[string]string{}}
+	var notFound, failed error
+	// found something to cache
+	fresh := false
+	// what the cache has for the song
+	cached, cachedNotFound := false, false
+	// remote providers that didn't find the song, and what they looked up
+	missed, remoteFailed, skipped := false, false, false
+	var lookup *Metadata
+	for _, p := range c.providers {
+		remote := remoteProviders[p.Name()]
+		if found.complete() && !extends(p, found) || remote && cachedNotFound {
+			continue
+		}
+		m, err := p.Lookup(ctx, song, found)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		switch {
+		case errors.Is(err, ErrMetadataNotFound):
+			if notFound == nil || errors.Is(err, ErrLowConfidence) {
+				notFound = err
+			}
+			cachedNotFound = cachedNotFound || errors.Is(err, ErrCachedNotFound)
+			if remote && !errors.Is(err, ErrLowConfidence) {
+				missed = true
+				if m != nil && lookup == nil {
+					lookup = m
+				}
+			}
+			continue
+		case errors.Is(err, ErrSkipped):
+			skipped = true
+			continue
+		case err != nil:
+			if failed == nil {
+				failed = err
+			}
+			remoteFailed = remoteFailed || remote
+			continue
+		}
+		cached = cached || p.Name() == ProviderCache
+		if found.merge(m, p.Name()) && remote {
+			fresh = true
+		}
+	}
+
+	if c.cache != nil && c.cache.NegativeTTL > 0 && missed && !fresh && !remoteFailed && !cached && !skipped {
+		if err := c.cache.SaveNotFound(song.ID, lookup); err != nil {
+			return nil, err
+		}
+	}
+	if failed != nil && !found.complete() {
+		return nil, failed
+	}
+	if len(found.Sources) == 0 {
+		if skipped {
+			return nil, ErrSkipped
+		}
+		if notFound == nil {
+			notFound = ErrMetadataNotFound
+		}
+		return nil, notFound
+	}
+
+	if c.cache != nil && fresh {
+		if err := c.save(found); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// merge adds the fields missing from m found by a provider. Returns true if
+// any field was added.
+func (m *Metadata) merge(from *Metadata, provider string) bool {
+	added := false
+	for _, f := range Fields {
+		v := m.Field(f)
+		if *v != "" || *from.Field(f) == "" {
+			continue
+		}
+		*v = *from.Field(f)
+		source := from.Source(f)
+		if source == "" {
+			source = provider
+		}
+		m.Sources[f] = source
+		if provider == ProviderCache {
+			m.Cached = true
+		}
+		added = true
+	}
+	if m.RecordingID == "" && from.RecordingID != "" {
+		m.RecordingID = from.RecordingID
+		m.ReleaseGroupID = from.ReleaseGroupID
+		m.Confidence = from.Confidence
+		m.Chosen = from.Chosen
+		m.Fingerprint = from.Fingerprint
+		m.Duration = from.Duration
+		m.Score = from.Score
+	}
+	if m.ReleaseID == "" && from.ReleaseID != "" {
+		m.copyRelease(from)
+		if provider == ProviderCache {
+			m.Cached = true
+		}
+		added = true
+	}
+	return added
+}
+
+// copyRelease copies the release details.
+func (m *Metadata) copyRelease(from *Metadata) {
+	m.ReleaseID = from.ReleaseID
+	if from.ReleaseGroupID != "" {
+		m.ReleaseGroupID = from.ReleaseGroupID
+	}
+	m.ArtistIDs = from.ArtistIDs
+	m.AlbumArtist = from.AlbumArtist
+	m.TrackNumber = from.TrackNumber
+	m.ReleaseDate = from.ReleaseDate
+	m.Label = from.Label
+}
+
+// extends is true if p is an Extender with details to add.
+func extends(p Provider, found *Metadata) bool {
+	e, ok := p.(Extender)
+	return ok && e.Extends(found)
+}
+
+// save caches the fields found by remote providers.
+func (c *Chain) save(m *Metadata) error {
+	remote := &Metadata{
+		FileID:      m.FileID,
+		RecordingID: m.RecordingID,
+		Confidence:  m.Confidence,
+		Chosen:      m.Chosen,
+		Fingerprint: m.Fingerprint,
+		Duration:    m.Duration,
+		Score:       m.Score,
+		Sources:     map[string]string{},
+	}
+	for _, f := range Fields {
+		if source := m.Source(f); remoteProviders[source] {
+			*remote.Field(f) = *m.Field(f)
+			remote.Sources[f] = source
+		}
+	}
+	remote.copyRelease(m)
+	if len(remote.Sources) == 0 && remote.ReleaseID == "" {
+		return nil
+	}
+	return c.cache.Save(remote)
+}
+
+// Cached returns the metadata in the cache.
+func (c *Chain) Cached(id string) (*Metadata, error) {
+	if c.cache == nil {
+		return nil, ErrMetadataNotFound
+	}
+	return c.cache.Cached(id)
+}
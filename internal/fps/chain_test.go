@@ -0,0 +1,298 @@
+package fps
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rubiojr/rplay/internal/acoustid"
+	"github.com/rubiojr/rplay/internal/musicbrainz"
+)
+
+type fakeProvider struct {
+	name  string
+	m     *Metadata
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) Lookup(ctx context.Context, song *Song, found *Metadata) (*Metadata, error) {
+	p.calls++
+	return p.m, p.err
+}
+
+func TestChain(t *testing.T) {
+	song := &Song{ID: "song", Path: "/music/Artist/Album/01 - Song.mp3", Tags: Metadata{Artist: "Tagged"}}
+	path := PathProvider{Infer: func(p string) map[string]string {
+		if p != song.Path {
+			t.Errorf("unexpected path %s", p)
+		}
+		return map[string]string{"artist": "Artist", "title": "Song"}
+	}}
+	remote := &fakeProvider{name: ProviderAcoustID, m: &Metadata{Title: "Other", Album: "Album"}}
+
+	m, err := NewChain(TagsProvider{}, path, remote).Fingerprint(context.Background(), song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]string{
+		"artist": {"Tagged", ProviderTags},
+		"title":  {"Song", ProviderPath},
+		"album":  {"Album", ProviderAcoustID},
+	}
+	for f, w := range want {
+		if *m.Field(f) != w[0] || m.Source(f) != w[1] {
+			t.Errorf("%s: expected %s from %s, got %s from %s", f, w[0], w[1], *m.Field(f), m.Source(f))
+		}
+	}
+
+	// complete songs aren't looked up any further
+	song.Tags = Metadata{Artist: "A", Title: "T", Album: "B"}
+	remote.calls = 0
+	NewChain(TagsProvider{}, remote).Fingerprint(context.Background(), song)
+	if remote.calls != 0 {
+		t.Error("the remote provider shouldn't be called")
+	}
+
+	chain := NewChain(TagsProvider{}, path, remote).Without(ProviderTags, ProviderPath)
+	if names := chain.Providers(); len(names) != 1 || names[0] != ProviderAcoustID {
+		t.Errorf("unexpected providers %v", names)
+	}
+}
+
+func TestChainErrors(t *testing.T) {
+	song := &Song{ID: "song", Tags: Metadata{Artist: "Artist"}}
+	failing := &fakeProvider{name: ProviderAcoustID, err: errors.New("boom")}
+	if _, err := NewChain(TagsProvider{}, failing).Fingerprint(context.Background(), song); err != failing.err {
+		t.Errorf("expected the provider error, got %v", err)
+	}
+
+	low := &fakeProvider{name: ProviderAcoustID, err: ErrLowConfidence}
+	none := &fakeProvider{name: "other", err: ErrMetadataNotFound}
+	song.Tags = Metadata{}
+	if _, err := NewChain(none, low).Fingerprint(context.Background(), song); err != ErrLowConfidence {
+		t.Errorf("expected ErrLowConfidence, got %v", err)
+	}
+	if _, err := NewChain().Fingerprint(context.Background(), song); err != ErrMetadataNotFound {
+		t.Errorf("expected ErrMetadataNotFound, got %v", err)
+	}
+}
+
+func TestChainCache(t *testing.T) {
+	cache := NewCache(filepath.Join(t.TempDir(), "acoustid.db"))
+	song := &Song{ID: "song", Tags: Metadata{Artist: "Tagged"}}
+	remote := &fakeProvider{name: ProviderAcoustID, m: &Metadata{Artist: "Artist", Title: "Song", Album: "Album", RecordingID: "rec"}}
+
+	chain := NewChain(cache, TagsProvider{}, remote)
+	if _, err := chain.Fingerprint(context.Background(), song); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := chain.Cached("song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Artist != "" || cached.Title != "Song" || cached.RecordingID != "rec" {
+		t.Errorf("only what the remote provider found should be cached: %+v", cached)
+	}
+
+	remote.calls = 0
+	m, err := chain.Fingerprint(context.Background(), song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote.calls != 0 {
+		t.Error("cached songs shouldn't be looked up again")
+	}
+	if !m.Cached || m.Title != "Song" || m.Source("title") != ProviderAcoustID || m.Artist != "Tagged" {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+
+	if _, err := chain.Cached("other"); err != ErrMetadataNotFound {
+		t.Errorf("expected ErrMetadataNotFound, got %v", err)
+	}
+}
+
+func TestAcoustIDProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(lookupResponse))
+	}))
+	defer srv.Close()
+	client := acoustid.NewClient("key")
+	client.BaseURL = srv.URL
+	client.Limiter = nil
+
+	fingerprinted := ""
+	opts := Options{Fingerprint: func(path string) (acoustid.Fingerprint, error) {
+		fingerprinted = path
+		return acoustid.Fingerprint{}, nil
+	}}
+	song := &Song{ID: "song", File: func(context.Context) (string, error) { return "/tmp/song.mp3", nil }}
+
+	m, err := NewAcoustIDProvider(client, opts).Lookup(context.Background(), song, &Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprinted != "/tmp/song.mp3" {
+		t.Errorf("unexpected file fingerprinted %q", fingerprinted)
+	}
+	if m.Album != "Album" || m.Artist != "Artist, Guest" || m.RecordingID != "studio" {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+
+	opts.MinConfidence = 0.9
+	if _, err := NewAcoustIDProvider(client, opts).Lookup(context.Background(), song, &Metadata{}); err != ErrLowConfidence {
+		t.Errorf("expected ErrLowConfidence, got %v", err)
+	}
+}
+
+func TestMusicBrainzProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/recording/rec":
+			w.Write([]byte(recordingResponse))
+		case "/release/official":
+			w.Write([]byte(`{"id": "official", "artist-credit": [{"name": "Various Artists"}], "label-info": [{"label": {"name": "Label"}}]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client := musicbrainz.NewClient("rplay-test")
+	client.BaseURL = srv.URL
+	client.Limiter = nil
+
+	cache := NewCache(filepath.Join(t.TempDir(), "acoustid.db"))
+	song := &Song{ID: "song", Tags: Metadata{Title: "Song"}}
+	remote := &fakeProvider{name: ProviderAcoustID, m: &Metadata{Artist: "Artist", Album: "Album", RecordingID: "rec", ReleaseGroupID: "rg"}}
+	chain := NewChain(cache, TagsProvider{}, remote, NewMusicBrainzProvider(client))
+
+	m, err := chain.Fingerprint(context.Background(), song)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ReleaseID != "official" || m.TrackNumber != 4 || m.Year() != 1999 || m.Label != "Label" || m.AlbumArtist != "Various Artists" {
+		t.Errorf("unexpected release details %+v", m)
+	}
+	if len(m.ArtistIDs) != 1 || m.ArtistIDs[0] != "a1" || m.Source("artist") != ProviderAcoustID {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+	cached, err := chain.Cached("song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.ReleaseID != "official" || cached.Label != "Label" {
+		t.Errorf("release details not cached: %+v", cached)
+	}
+
+	// songs with complete tags are only extended once a recording is known
+	song.Tags = Metadata{Artist: "A", Title: "T", Album: "B"}
+	m, err = NewChain(TagsProvider{}, NewMusicBrainzProvider(client)).Fingerprint(context.Background(), song)
+	if err != nil || m.ReleaseID != "" {
+		t.Errorf("unexpected lookup %+v, %v", m, err)
+	}
+}
+
+const recordingResponse = `{
+  "id": "rec",
+  "title": "Song",
+  "artist-credit": [{"name": "Artist", "artist": {"id": "a1", "name": "Artist"}}],
+  "releases": [{
+    "id": "bootleg",
+    "title": "Album",
+    "status": "Bootleg",
+    "date": "1998",
+    "release-group": {"id": "rg"}
+  }, {
+    "id": "compilation",
+    "title": "Greatest Hits",
+    "status": "Official",
+    "date": "1990",
+    "release-group": {"id": "hits"}
+  }, {
+    "id": "reissue",
+    "title": "Album",
+    "status": "Official",
+    "date": "2009-10-05",
+    "release-group": {"id": "rg"}
+  }, {
+    "id": "official",
+    "title": "Album",
+    "status": "Official",
+    "date": "1999-03-01",
+    "release-group": {"id": "rg"},
+    "media": [{"position": 1, "tracks": [{"number": "4", "position": 4}]}]
+  }]
+}`
+
+func TestChainNotFound(t *testing.T) {
+	cache := NewCache(filepath.Join(t.TempDir(), "acoustid.db"))
+	song := &Song{ID: "song", Tags: Metadata{Artist: "Tagged"}}
+	remote := &fakeProvider{name: ProviderAcoustID, m: &Metadata{Fingerprint: "AQAA", Duration: 213}, err: ErrMetadataNotFound}
+	chain := NewChain(cache, TagsProvider{}, remote)
+
+	m, err := chain.Fingerprint(context.Background(), song)
+	if err != nil || m.Artist != "Tagged" {
+		t.Fatalf("unexpected lookup %+v, %v", m, err)
+	}
+	entry, err := cache.Entry("song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.NotFound || entry.Fingerprint != "AQAA" || entry.Duration != 213 || entry.Artist != "" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	remote.calls = 0
+	song.Tags = Metadata{}
+	if _, err := chain.Fingerprint(context.Background(), song); err != ErrCachedNotFound {
+		t.Errorf("expected ErrCachedNotFound, got %v", err)
+	}
+	if remote.calls != 0 {
+		t.Error("songs not found shouldn't be looked up again")
+	}
+
+	// expired
+	cache.NegativeTTL = time.Nanosecond
+	chain.Fingerprint(context.Background(), song)
+	if remote.calls != 1 {
+		t.Error("expected the song to be looked up again")
+	}
+
+	// low confidence matches may be used later
+	cache.Delete("song")
+	remote.err = ErrLowConfidence
+	chain.Fingerprint(context.Background(), song)
+	if _, err := cache.Entry("song"); err != ErrMetadataNotFound {
+		t.Errorf("low confidence matches shouldn't be cached: %v", err)
+	}
+
+	// neither are songs the user skipped
+	remote.err = ErrSkipped
+	if _, err := chain.Fingerprint(context.Background(), song); err != ErrSkipped {
+		t.Errorf("expected ErrSkipped, got %v", err)
+	}
+	if _, err := cache.Entry("song"); err != ErrMetadataNotFound {
+		t.Errorf("skipped songs shouldn't be cached: %v", err)
+	}
+
+	remote.err = ErrMetadataNotFound
+	cache.NegativeTTL = DefaultNegativeTTL
+	chain.Fingerprint(context.Background(), &Song{ID: "other"})
+	cache.Save(&Metadata{FileID: "found", Title: "Song"})
+	if n, err := cache.PurgeNotFound(); err != nil || n != 1 {
+		t.Errorf("expected 1 song purged, got %d, %v", n, err)
+	}
+	entries, err := cache.Entries()
+	if err != nil || len(entries) != 1 || entries[0].FileID != "found" {
+		t.Errorf("unexpected entries %+v, %v", entries, err)
+	}
+}
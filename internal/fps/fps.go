@@ -1,20 +1,78 @@
 package fps
 
 import (
+	"context"
 	"errors"
-
-	"github.com/asdine/storm"
-	"github.com/rubiojr/rplay/internal/acoustid"
+	"fmt"
+	"strconv"
+	"time"
 )
 
 var ErrMetadataNotFound = errors.New("metadata not found")
 
+// ErrLowConfidence is returned when no match is good enough, it's also an
+// ErrMetadataNotFound.
+var ErrLowConfidence = fmt.Errorf("%w: no confident match", ErrMetadataNotFound)
+
+// ErrCachedNotFound is returned for songs the remote providers didn't find
+// recently, it's also an ErrMetadataNotFound.
+var ErrCachedNotFound = fmt.Errorf("%w: not found before", ErrMetadataNotFound)
+
+// ErrSkipped is returned when the user doesn't choose a match for a song.
+// It isn't an ErrMetadataNotFound, the song isn't cached as not found.
+var ErrSkipped = errors.New("skipped")
+
+// DefaultMinConfidence is the lowest confidence of the matches used.
+const DefaultMinConfidence = 0.5
+
+// DefaultNegativeTTL is how long songs not found online are cached.
+const DefaultNegativeTTL = 7 * 24 * time.Hour
+
+// Names of the providers.
+const (
+	ProviderUser        = "user"
+	ProviderCache       = "cache"
+	ProviderTags        = "tags"
+	ProviderPath        = "path"
+	ProviderAcoustID    = "acoustid"
+	ProviderMusicBrainz = "musicbrainz"
+)
+
+// Fingerprinter finds the metadata of songs.
 type Fingerprinter interface {
-	Fingerprint(id, path string) (*Metadata, error)
+	Fingerprint(ctx context.Context, song *Song) (*Metadata, error)
+	// Cached returns the metadata found before for a song, without
+	// fingerprinting it.
+	Cached(id string) (*Metadata, error)
 }
 
-type AcoustIDFingerprinter struct {
-	dbPath string
+// Provider is a source of song metadata.
+type Provider interface {
+	Name() string
+	// Lookup returns the metadata of a song, ErrMetadataNotFound if it has
+	// none. found is what the providers before it found.
+	Lookup(ctx context.Context, song *Song, found *Metadata) (*Metadata, error)
+}
+
+// Extender is a provider adding details to what the providers before it
+// found, so it's asked even when no fields are missing.
+type Extender interface {
+	Provider
+	// Extends is true if the provider has details to add.
+	Extends(found *Metadata) bool
+}
+
+// Song is a song whose metadata is looked up.
+type Song struct {
+	ID string
+	// path of the song in the backup
+	Path string
+	// metadata read from the song tags
+	Tags Metadata
+	// metadata set by the user
+	Overrides Metadata
+	// returns a local copy of the song
+	File func(ctx context.Context) (string, error)
 }
 
 type Metadata struct {
@@ -23,78 +81,73 @@ type Metadata struct {
 	Album  string `json:"album"`
 	Artist string `json:"artist"`
 	Cached bool   `json:"cached"`
-}
 
-func New(dbPath string) Fingerprinter {
-	return &AcoustIDFingerprinter{dbPath: dbPath}
+	RecordingID string  `json:"recording_id"`
+	Confidence  float64 `json:"confidence"`
+	// picked by the user
+	Chosen bool `json:"chosen"`
+
+	// release details, from MusicBrainz
+	ReleaseID      string   `json:"release_id"`
+	ReleaseGroupID string   `json:"releasegroup_id"`
+	ArtistIDs      []string `json:"artist_ids"`
+	AlbumArtist    string   `json:"album_artist"`
+	TrackNumber    int      `json:"track_number"`
+	ReleaseDate    string   `json:"release_date"`
+	Label          string   `json:"label"`
+
+	// provider of each field
+	Sources map[string]string `json:"sources"`
+
+	// AcoustID lookup: the compressed fingerprint, the song length in
+	// seconds and the score of the match
+	Fingerprint string  `json:"fingerprint,omitempty"`
+	Duration    int     `json:"duration,omitempty"`
+	Score       float64 `json:"score,omitempty"`
+
+	// the remote providers didn't find the song
+	NotFound bool `json:"not_found,omitempty"`
+	// when it was cached
+	Updated time.Time `json:"updated"`
 }
 
-func (f *AcoustIDFingerprinter) Fingerprint(id, path string) (*Metadata, error) {
-	var meta *Metadata
-	if meta, err := f.metadataFromDB(id); err == nil {
-		meta.Cached = true
-		return meta, nil
-	}
-
-	fp, err := acoustid.NewFingerprint(path)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := acoustid.MakeAcoustIDRequest(fp)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(resp.Results) == 0 {
-		return nil, ErrMetadataNotFound
-	}
-
-	result := resp.Results[0]
-
-	if len(result.Recordings) == 0 {
-		return nil, ErrMetadataNotFound
-	}
-
-	rec := result.Recordings[0]
-
-	meta = &Metadata{}
-	meta.FileID = id
-	meta.Cached = false
-	if len(rec.Artists) > 0 {
-		meta.Artist = rec.Artists[0].Name
-	}
-	if len(rec.ReleaseGroups) > 0 {
-		meta.Album = rec.ReleaseGroups[0].Title
-	}
-	meta.Title = rec.Title
-
-	db, err := storm.Open(f.dbPath)
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	err = db.Save(meta)
-	if err != nil {
-		panic(err)
+// Fields are the song fields looked up.
+var Fields = []string{"artist", "title", "album"}
+
+// Field returns a pointer to a metadata field, nil if there's no such
+// field.
+func (m *Metadata) Field(name string) *string {
+	switch name {
+	case "artist":
+		return &m.Artist
+	case "title":
+		return &m.Title
+	case "album":
+		return &m.Album
 	}
+	return nil
+}
 
-	return meta, nil
+// Source returns the provider of a field.
+func (m *Metadata) Source(field string) string {
+	return m.Sources[field]
 }
 
-func (f *AcoustIDFingerprinter) metadataFromDB(id string) (*Metadata, error) {
-	db, err := storm.Open(f.dbPath)
-	if err != nil {
-		return nil, err
+// Year returns the year of the release date, 0 if unknown.
+func (m *Metadata) Year() int {
+	if len(m.ReleaseDate) < 4 {
+		return 0
 	}
-	defer db.Close()
+	y, _ := strconv.Atoi(m.ReleaseDate[:4])
+	return y
+}
 
-	meta := &Metadata{}
-	err = db.One("FileID", id, meta)
-	if err != nil {
-		return nil, err
+// complete is true when every field has a value.
+func (m *Metadata) complete() bool {
+	for _, f := range Fields {
+		if *m.Field(f) == "" {
+			return false
+		}
 	}
-
-	return meta, nil
+	return true
 }
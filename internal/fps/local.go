@@ -0,0 +1,48 @@
+package fps
+
+import "context"
+
+// UserProvider returns the metadata set by the user.
+type UserProvider struct{}
+
+func (UserProvider) Name() string {
+	return ProviderUser
+}
+
+func (UserProvider) Lookup(ctx context.Context, song *Song, found *Metadata) (*Metadata, error) {
+	m := song.Overrides
+	m.Sources = nil
+	return &m, nil
+}
+
+// TagsProvider returns the metadata read from the song tags.
+type TagsProvider struct{}
+
+func (TagsProvider) Name() string {
+	return ProviderTags
+}
+
+func (TagsProvider) Lookup(ctx context.Context, song *Song, found *Metadata) (*Metadata, error) {
+	m := song.Tags
+	m.Sources = nil
+	return &m, nil
+}
+
+// PathProvider infers the metadata of songs from their path.
+type PathProvider struct {
+	// returns the fields found in a path
+	Infer func(path string) map[string]string
+}
+
+func (PathProvider) Name() string {
+	return ProviderPath
+}
+
+func (p PathProvider) Lookup(ctx context.Context, song *Song, found *Metadata) (*Metadata, error) {
+	m := &Metadata{FileID: song.ID}
+	fields := p.Infer(song.Path)
+	for _, f := range Fields {
+		*m.Field(f) = fields[f]
+	}
+	return m, nil
+}
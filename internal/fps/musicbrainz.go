@@ -0,0 +1,121 @@
+package fps
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/rubiojr/rplay/internal/musicbrainz"
+)
+
+// MusicBrainzProvider looks up the release details of the recordings found
+// by AcoustID in MusicBrainz.
+type MusicBrainzProvider struct {
+	client *musicbrainz.Client
+}
+
+func NewMusicBrainzProvider(client *musicbrainz.Client) *MusicBrainzProvider {
+	return &MusicBrainzProvider{client: client}
+}
+
+func (p *MusicBrainzProvider) Name() string {
+	return ProviderMusicBrainz
+}
+
+func (p *MusicBrainzProvider) Extends(found *Metadata) bool {
+	return found.RecordingID != "" && found.ReleaseID == ""
+}
+
+func (p *MusicBrainzProvider) Lookup(ctx context.Context, song *Song, found *Metadata) (*Metadata, error) {
+	if found.RecordingID == "" {
+		return nil, ErrMetadataNotFound
+	}
+	rec, err := p.client.Recording(ctx, found.RecordingID)
+	if errors.Is(err, musicbrainz.ErrNotFound) {
+		return nil, ErrMetadataNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	release := chooseRelease(rec.Releases, found)
+	if release == nil {
+		return nil, ErrMetadataNotFound
+	}
+	// recordings only list the releases, without labels and credits
+	details, err := p.client.Release(ctx, release.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{
+		FileID:      song.ID,
+		Artist:      musicbrainz.Artist(rec.ArtistCredit),
+		Title:       rec.Title,
+		Album:       release.Title,
+		ReleaseID:   release.ID,
+		AlbumArtist: musicbrainz.Artist(details.ArtistCredit),
+		TrackNumber: trackNumber(release),
+		ReleaseDate: release.Date,
+	}
+	if release.ReleaseGroup != nil {
+		m.ReleaseGroupID = release.ReleaseGroup.ID
+	}
+	for _, c := range rec.ArtistCredit {
+		m.ArtistIDs = append(m.ArtistIDs, c.Artist.ID)
+	}
+	for _, l := range details.LabelInfo {
+		if l.Label != nil {
+			m.Label = l.Label.Name
+			break
+		}
+	}
+	return m, nil
+}
+
+// chooseRelease returns the release of the release group found, the album
+// if no release group was, preferring official and earlier releases.
+func chooseRelease(releases []musicbrainz.Release, found *Metadata) *musicbrainz.Release {
+	var best *musicbrainz.Release
+	rank := func(r *musicbrainz.Release) int {
+		n := 0
+		switch {
+		case found.ReleaseGroupID != "" && r.ReleaseGroup != nil && r.ReleaseGroup.ID == found.ReleaseGroupID:
+			n += 4
+		case found.ReleaseGroupID == "" && found.Album != "" && r.Title == found.Album:
+			n += 4
+		}
+		if r.Status == "Official" {
+			n += 2
+		}
+		if r.Date != "" {
+			n++
+		}
+		return n
+	}
+	for i := range releases {
+		r := &releases[i]
+		if best == nil {
+			best = r
+			continue
+		}
+		rr, rb := rank(r), rank(best)
+		if rr > rb || rr == rb && r.Date != "" && r.Date < best.Date {
+			best = r
+		}
+	}
+	return best
+}
+
+// trackNumber returns the number of the recording track in a release, 0 if
+// unknown.
+func trackNumber(r *musicbrainz.Release) int {
+	for _, medium := range r.Media {
+		for _, t := range medium.Tracks {
+			if n, err := strconv.Atoi(t.Number); err == nil {
+				return n
+			}
+			return t.Position
+		}
+	}
+	return 0
+}
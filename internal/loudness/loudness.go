@@ -0,0 +1,178 @@
+// Package loudness measures the integrated loudness of audio as described
+// in EBU R128 and ITU-R BS.1770.
+package loudness
+
+import (
+	"math"
+)
+
+const (
+	// gating blocks are 400 ms long and overlap by 75%
+	blockSubdivisions = 4
+	absoluteGate      = -70.0
+	relativeGate      = -10.0
+)
+
+// biquad is a second order IIR filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the K-weighting pre-filter and RLB high-pass filter
+// for rate, computed as in libebur128 so any sample rate is supported.
+func kWeighting(rate int) (biquad, biquad) {
+	fs := float64(rate)
+
+	f0 := 1681.974450955533
+	g := 3.999843853973347
+	q := 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	return shelf, highPass
+}
+
+// Meter accumulates audio and measures its loudness.
+type Meter struct {
+	channels int
+	filters  [][2]biquad
+	// frames in a 100 ms sub-block
+	subBlockLen int
+	// energy of the current sub-block and the last complete ones
+	sum       float64
+	frames    int
+	subBlocks []float64
+	blocks    []float64
+	peak      float64
+}
+
+// NewMeter returns a meter for interleaved audio with channels channels
+// sampled at rate. Surround channels are not weighted differently.
+func NewMeter(rate, channels int) *Meter {
+	m := &Meter{
+		channels:    channels,
+		filters:     make([][2]biquad, channels),
+		subBlockLen: rate / 10,
+	}
+	for i := range m.filters {
+		shelf, highPass := kWeighting(rate)
+		m.filters[i] = [2]biquad{shelf, highPass}
+	}
+	return m
+}
+
+// Write adds interleaved samples in the [-1, 1] range to the measurement.
+func (m *Meter) Write(samples []float64) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for ch := 0; ch < m.channels; ch++ {
+			x := samples[i+ch]
+			if a := math.Abs(x); a > m.peak {
+				m.peak = a
+			}
+			f := &m.filters[ch]
+			y := f[1].process(f[0].process(x))
+			m.sum += y * y
+		}
+		m.frames++
+		if m.frames == m.subBlockLen {
+			m.endSubBlock()
+		}
+	}
+}
+
+func (m *Meter) endSubBlock() {
+	m.subBlocks = append(m.subBlocks, m.sum)
+	m.sum = 0
+	m.frames = 0
+	if len(m.subBlocks) < blockSubdivisions {
+		return
+	}
+
+	energy := 0.0
+	for _, e := range m.subBlocks {
+		energy += e
+	}
+	m.blocks = append(m.blocks, energy/float64(blockSubdivisions*m.subBlockLen))
+	m.subBlocks = m.subBlocks[1:]
+}
+
+// Blocks returns the mean square energy of every gating block measured so
+// far. Blocks from several meters can be combined with Integrated to
+// measure a whole album.
+func (m *Meter) Blocks() []float64 {
+	return m.blocks
+}
+
+// Integrated returns the integrated loudness in LUFS, or -Inf if the audio
+// is too short or silent.
+func (m *Meter) Integrated() float64 {
+	return Integrated(m.blocks)
+}
+
+// Peak returns the highest absolute sample value.
+func (m *Meter) Peak() float64 {
+	return m.peak
+}
+
+// Integrated returns the gated loudness in LUFS of blocks.
+func Integrated(blocks []float64) float64 {
+	gated := gate(blocks, absoluteGate)
+	if len(gated) == 0 {
+		return math.Inf(-1)
+	}
+	return energyLoudness(mean(gate(gated, energyLoudness(mean(gated))+relativeGate)))
+}
+
+func gate(blocks []float64, threshold float64) []float64 {
+	gated := []float64{}
+	for _, e := range blocks {
+		if energyLoudness(e) > threshold {
+			gated = append(gated, e)
+		}
+	}
+	return gated
+}
+
+func mean(blocks []float64) float64 {
+	if len(blocks) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, e := range blocks {
+		sum += e
+	}
+	return sum / float64(len(blocks))
+}
+
+func energyLoudness(e float64) float64 {
+	return -0.691 + 10*math.Log10(e)
+}
@@ -0,0 +1,68 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+)
+
+func sine(rate, channels int, seconds, freq, dbfs float64) []float64 {
+	amp := math.Pow(10, dbfs/20)
+	frames := int(seconds * float64(rate))
+	samples := make([]float64, 0, frames*channels)
+	for i := 0; i < frames; i++ {
+		v := amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate))
+		for ch := 0; ch < channels; ch++ {
+			samples = append(samples, v)
+		}
+	}
+	return samples
+}
+
+// EBU Tech 3341, test case 1: a 1 kHz stereo sine at -23 dBFS reads -23 LUFS.
+func TestIntegrated(t *testing.T) {
+	for _, rate := range []int{44100, 48000} {
+		m := NewMeter(rate, 2)
+		m.Write(sine(rate, 2, 20, 1000, -23))
+
+		if l := m.Integrated(); math.Abs(l+23) > 0.1 {
+			t.Errorf("%d Hz: expected -23 LUFS, got %.2f", rate, l)
+		}
+		if p := m.Peak(); math.Abs(p-math.Pow(10, -23.0/20)) > 0.001 {
+			t.Errorf("%d Hz: unexpected peak %f", rate, p)
+		}
+	}
+}
+
+// EBU Tech 3341, test case 3: quiet parts below the relative gate are
+// ignored.
+func TestIntegratedRelativeGate(t *testing.T) {
+	m := NewMeter(48000, 2)
+	m.Write(sine(48000, 2, 10, 1000, -36))
+	m.Write(sine(48000, 2, 60, 1000, -23))
+	m.Write(sine(48000, 2, 10, 1000, -36))
+
+	if l := m.Integrated(); math.Abs(l+23) > 0.1 {
+		t.Errorf("expected -23 LUFS, got %.2f", l)
+	}
+}
+
+func TestIntegratedSilence(t *testing.T) {
+	m := NewMeter(44100, 2)
+	m.Write(make([]float64, 44100*2*5))
+
+	if l := m.Integrated(); !math.IsInf(l, -1) {
+		t.Errorf("expected silence to have no loudness, got %.2f", l)
+	}
+}
+
+func TestIntegratedAlbum(t *testing.T) {
+	loud := NewMeter(44100, 2)
+	loud.Write(sine(44100, 2, 10, 1000, -20))
+	quiet := NewMeter(44100, 2)
+	quiet.Write(sine(44100, 2, 10, 1000, -26))
+
+	album := Integrated(append(append([]float64{}, loud.Blocks()...), quiet.Blocks()...))
+	if album >= loud.Integrated() || album <= quiet.Integrated() {
+		t.Errorf("album loudness %.2f should be between its tracks", album)
+	}
+}
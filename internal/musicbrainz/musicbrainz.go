@@ -0,0 +1,190 @@
+// Package musicbrainz is a client for the MusicBrainz web service.
+package musicbrainz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rubiojr/rplay/internal/webclient"
+)
+
+// DefaultBaseURL is the MusicBrainz web service.
+const DefaultBaseURL = "https://musicbrainz.org/ws/2"
+
+// MusicBrainz allows a request per second on average.
+const (
+	DefaultRate  = 1
+	DefaultBurst = 1
+)
+
+var ErrNotFound = errors.New("musicbrainz: not found")
+
+// APIError is an error returned by the web service.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("musicbrainz: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// Temporary returns true if the request may succeed later. MusicBrainz
+// answers 503 to clients making too many requests.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+type ArtistCredit struct {
+	Name       string `json:"name"`
+	JoinPhrase string `json:"joinphrase"`
+	Artist     struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"artist"`
+}
+
+type ReleaseGroup struct {
+	ID             string   `json:"id"`
+	Title          string   `json:"title"`
+	PrimaryType    string   `json:"primary-type"`
+	SecondaryTypes []string `json:"secondary-types"`
+}
+
+type Track struct {
+	ID       string `json:"id"`
+	Number   string `json:"number"`
+	Position int    `json:"position"`
+	Title    string `json:"title"`
+}
+
+type Medium struct {
+	Position int     `json:"position"`
+	Format   string  `json:"format"`
+	Tracks   []Track `json:"tracks"`
+}
+
+type LabelInfo struct {
+	CatalogNumber string `json:"catalog-number"`
+	Label         *struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"label"`
+}
+
+type Release struct {
+	ID           string         `json:"id"`
+	Title        string         `json:"title"`
+	Status       string         `json:"status"`
+	Date         string         `json:"date"`
+	Country      string         `json:"country"`
+	ArtistCredit []ArtistCredit `json:"artist-credit"`
+	ReleaseGroup *ReleaseGroup  `json:"release-group"`
+	// only the media and track of the recording looked up, in recordings
+	Media     []Medium    `json:"media"`
+	LabelInfo []LabelInfo `json:"label-info"`
+}
+
+type Recording struct {
+	ID           string         `json:"id"`
+	Title        string         `json:"title"`
+	Length       int            `json:"length"`
+	ArtistCredit []ArtistCredit `json:"artist-credit"`
+	Releases     []Release      `json:"releases"`
+}
+
+// Artist returns the credited artists as printed on releases.
+func Artist(credits []ArtistCredit) string {
+	s := ""
+	for _, c := range credits {
+		s += c.Name + c.JoinPhrase
+	}
+	return s
+}
+
+// Client looks up recordings and releases in the MusicBrainz web service.
+type Client struct {
+	// web service URL, without a trailing slash
+	BaseURL string
+	// identifies the application, as MusicBrainz asks
+	UserAgent string
+	webclient.Client
+}
+
+// NewClient returns a client for the MusicBrainz web service, limited to
+// the requests per second allowed.
+func NewClient(userAgent string) *Client {
+	return &Client{
+		BaseURL:   DefaultBaseURL,
+		UserAgent: userAgent,
+		Client: webclient.Client{
+			Timeout:    10 * time.Second,
+			MaxRetries: 3,
+			Backoff:    time.Second,
+			MaxBackoff: 10 * time.Second,
+			Limiter:    webclient.NewRateLimiter(DefaultRate, DefaultBurst),
+			HTTPClient: http.DefaultClient,
+		},
+	}
+}
+
+// Recording returns a recording with the releases it's in, and its track
+// in each of them.
+func (c *Client) Recording(ctx context.Context, id string) (*Recording, error) {
+	r := &Recording{}
+	err := c.do(ctx, "/recording/"+url.PathEscape(id), "artist-credits releases release-groups media", r)
+	return r, err
+}
+
+// Release returns a release with its labels.
+func (c *Client) Release(ctx context.Context, id string) (*Release, error) {
+	r := &Release{}
+	err := c.do(ctx, "/release/"+url.PathEscape(id), "artist-credits labels release-groups", r)
+	return r, err
+}
+
+// do gets an entity, retrying temporary errors, and decodes it into v.
+func (c *Client) do(ctx context.Context, path, inc string, v interface{}) error {
+	values := url.Values{}
+	values.Set("inc", inc)
+	values.Set("fmt", "json")
+	u := c.BaseURL + path + "?" + values.Encode()
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if c.UserAgent != "" {
+			req.Header.Set("User-Agent", c.UserAgent)
+		}
+		return req, nil
+	}
+	return c.Client.Do(ctx, newRequest, func(resp *webclient.Response) error {
+		return decode(resp, v)
+	})
+}
+
+// decode decodes an entity into v, returning the error the response has.
+func decode(resp *webclient.Response, v interface{}) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(resp.Body, &e) == nil && e.Error != "" {
+			apiErr.Message = e.Error
+		}
+		return apiErr
+	}
+	return json.Unmarshal(resp.Body, v)
+}
@@ -0,0 +1,125 @@
+package musicbrainz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const recordingResponse = `{
+  "id": "rec",
+  "title": "Song",
+  "length": 213000,
+  "artist-credit": [
+    {"name": "Artist", "joinphrase": " feat. ", "artist": {"id": "a1", "name": "Artist"}},
+    {"name": "Guest", "joinphrase": "", "artist": {"id": "a2", "name": "Guest"}}
+  ],
+  "releases": [{
+    "id": "rel",
+    "title": "Album",
+    "status": "Official",
+    "date": "1999-03-01",
+    "release-group": {"id": "rg", "title": "Album", "primary-type": "Album", "secondary-types": []},
+    "media": [{"position": 1, "format": "CD", "tracks": [{"id": "t", "number": "4", "position": 4, "title": "Song"}]}]
+  }]
+}`
+
+const releaseResponse = `{
+  "id": "rel",
+  "title": "Album",
+  "status": "Official",
+  "date": "1999-03-01",
+  "artist-credit": [{"name": "Artist", "joinphrase": "", "artist": {"id": "a1", "name": "Artist"}}],
+  "label-info": [{"catalog-number": "LBL 1", "label": {"id": "l", "name": "Label"}}]
+}`
+
+func testClient(url string) *Client {
+	c := NewClient("rplay-test")
+	c.BaseURL = url
+	c.Backoff = time.Millisecond
+	c.MaxBackoff = 5 * time.Millisecond
+	c.Limiter = nil
+	return c
+}
+
+func TestRecording(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/recording/rec" || r.URL.Query().Get("fmt") != "json" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if !strings.Contains(r.URL.Query().Get("inc"), "releases") {
+			t.Errorf("releases not included: %s", r.URL)
+		}
+		if r.UserAgent() != "rplay-test" {
+			t.Errorf("unexpected user agent %q", r.UserAgent())
+		}
+		w.Write([]byte(recordingResponse))
+	}))
+	defer srv.Close()
+
+	rec, err := testClient(srv.URL).Recording(context.Background(), "rec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Artist(rec.ArtistCredit) != "Artist feat. Guest" {
+		t.Errorf("unexpected artist %q", Artist(rec.ArtistCredit))
+	}
+	if len(rec.Releases) != 1 || rec.Releases[0].ReleaseGroup.ID != "rg" || rec.Releases[0].Media[0].Tracks[0].Number != "4" {
+		t.Errorf("unexpected releases %+v", rec.Releases)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error": "Your requests are exceeding the allowable rate limit."}`))
+			return
+		}
+		if r.URL.Path != "/release/rel" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(releaseResponse))
+	}))
+	defer srv.Close()
+
+	rel, err := testClient(srv.URL).Release(context.Background(), "rel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 requests, got %d", calls)
+	}
+	if len(rel.LabelInfo) != 1 || rel.LabelInfo[0].Label.Name != "Label" {
+		t.Errorf("unexpected labels %+v", rel.LabelInfo)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/recording/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "Not Found"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "Invalid mbid."}`))
+		}
+	}))
+	defer srv.Close()
+	c := testClient(srv.URL)
+
+	if _, err := c.Recording(context.Background(), "missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	_, err := c.Recording(context.Background(), "bad")
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "Invalid mbid." {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Package webclient makes requests to web services, limiting how many are
+// made and retrying the ones failing temporarily.
+package webclient
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Temporary is implemented by errors of requests that may succeed later.
+type Temporary interface {
+	Temporary() bool
+}
+
+// Response is a response read whole.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Client makes requests with an exponential backoff between retries.
+type Client struct {
+	// time limit for each request, 0 for none
+	Timeout time.Duration
+	// retries after a failed request, with an exponential backoff
+	MaxRetries int
+	// delay before the first retry, doubled after each one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// limits the requests made, nil for no limit
+	Limiter *RateLimiter
+
+	HTTPClient *http.Client
+}
+
+// Do sends the request made by newRequest, once for every attempt, and
+// passes the response to decode. Requests that can't be sent and decode
+// errors that are Temporary are retried.
+func (c *Client) Do(ctx context.Context, newRequest func() (*http.Request, error), decode func(*Response) error) error {
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		resp, err := c.send(ctx, newRequest)
+		if err == nil {
+			if err = decode(resp); !temporary(err) {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= c.MaxRetries {
+			return err
+		}
+
+		wait := jitter(backoff)
+		if resp != nil {
+			if d := retryAfter(resp.Header); d > wait {
+				wait = d
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		if backoff *= 2; c.MaxBackoff > 0 && backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+}
+
+// send makes a single request and reads its response.
+func (c *Client) send(ctx context.Context, newRequest func() (*http.Request, error)) (*Response, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: response.StatusCode, Header: response.Header, Body: body}, nil
+}
+
+func temporary(err error) bool {
+	t, ok := err.(Temporary)
+	return ok && t.Temporary()
+}
+
+// retryAfter returns the delay asked by the web service before retrying,
+// if any.
+func retryAfter(h http.Header) time.Duration {
+	secs, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// jitter returns a random delay between d/2 and d, so clients retrying at
+// the same time spread their requests.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,88 @@
+package webclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type statusError int
+
+func (e statusError) Error() string {
+	return http.StatusText(int(e))
+}
+
+func (e statusError) Temporary() bool {
+	return e >= 500
+}
+
+func TestDo(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Write([]byte("ok"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{MaxRetries: 3, Backoff: time.Millisecond}
+	newRequest := func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, srv.URL, nil)
+	}
+	body := ""
+	decode := func(resp *Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return statusError(resp.StatusCode)
+		}
+		body = string(resp.Body)
+		return nil
+	}
+
+	if err := c.Do(context.Background(), newRequest, decode); err != nil || body != "ok" {
+		t.Fatalf("unexpected response %q, %v", body, err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 requests, got %d", calls)
+	}
+
+	// errors that aren't temporary aren't retried
+	err := c.Do(context.Background(), newRequest, decode)
+	if !errors.Is(err, statusError(http.StatusBadRequest)) || calls != 3 {
+		t.Errorf("unexpected error %v after %d requests", err, calls)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(3, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("request %d: expected no wait, got %v", i, d)
+		}
+	}
+	if d := l.reserve(); d != time.Second/3 {
+		t.Errorf("expected to wait %v, got %v", time.Second/3, d)
+	}
+	if d := l.reserve(); d != 2*time.Second/3 {
+		t.Errorf("expected to wait %v, got %v", 2*time.Second/3, d)
+	}
+
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("request %d after a pause: expected no wait, got %v", i, d)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Songs are identified by their contents, the hash of the blobs in the
+// repository (see nodeFileID), and indexed once. The same song backed up
+// from several hosts or paths has a location for each one of them.
+type songLocation struct {
+	Repository string    `json:"repository"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+	Snapshot   string    `json:"snapshot"`
+	Time       time.Time `json:"time"`
+}
+
+// locationStore keeps the locations of the songs indexed, keyed by song ID,
+// host and path. Only the latest snapshot with a location is kept.
+type locationStore struct {
+	db *leveldb.DB
+}
+
+// idLength is the length of a song ID, a SHA-256 hash.
+const idLength = 32
+
+func locationsPath() string {
+	return filepath.Join(filepath.Dir(indexPath), "locations")
+}
+
+func openLocations() (*locationStore, error) {
+	db, err := leveldb.OpenFile(locationsPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &locationStore{db: db}, nil
+}
+
+func (s *locationStore) close() error {
+	return s.db.Close()
+}
+
+func locationKey(songID []byte, l *songLocation) []byte {
+	key := append([]byte{}, songID...)
+	key = append(key, l.Host...)
+	key = append(key, 0)
+	return append(key, l.Path...)
+}
+
+// add records a song location, unless a newer snapshot has it already.
+func (s *locationStore) add(songID []byte, l *songLocation) error {
+	key := locationKey(songID, l)
+	if v, err := s.db.Get(key, nil); err == nil {
+		old := songLocation{}
+		if json.Unmarshal(v, &old) == nil && old.Time.After(l.Time) {
+			return nil
+		}
+	}
+
+	v, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(key, v, nil)
+}
+
+// locations returns the locations of a song in repository.
+func (s *locationStore) locations(songID string, repository string) ([]*songLocation, error) {
+	id, err := hex.DecodeString(songID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*songLocation{}
+	iter := s.db.NewIterator(util.BytesPrefix(id), nil)
+	defer iter.Release()
+	for iter.Next() {
+		l := &songLocation{}
+		if err := json.Unmarshal(iter.Value(), l); err != nil {
+			return nil, err
+		}
+		if l.Repository == repository {
+			list = append(list, l)
+		}
+	}
+	sortLocations(list)
+
+	return list, iter.Error()
+}
+
+// duplicates returns the songs in repository found in more than one
+// location, by song ID.
+func (s *locationStore) duplicates(repository string) (map[string][]*songLocation, error) {
+	dupes := map[string][]*songLocation{}
+
+	var songID []byte
+	list := []*songLocation{}
+	flush := func() {
+		if len(list) > 1 {
+			sortLocations(list)
+			dupes[hex.EncodeToString(songID)] = list
+		}
+		list = []*songLocation{}
+	}
+
+	iter := s.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) < idLength {
+			continue
+		}
+		if id := key[:idLength]; !bytes.Equal(id, songID) {
+			flush()
+			songID = append([]byte{}, id...)
+		}
+		l := &songLocation{}
+		if err := json.Unmarshal(iter.Value(), l); err != nil {
+			return nil, err
+		}
+		if l.Repository == repository {
+			list = append(list, l)
+		}
+	}
+	flush()
+
+	return dupes, iter.Error()
+}
+
+func sortLocations(list []*songLocation) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Host != list[j].Host {
+			return list[i].Host < list[j].Host
+		}
+		return list[i].Path < list[j].Path
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocationStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(p string) { indexPath = p }(indexPath)
+	indexPath = filepath.Join(dir, "rplay.bluge")
+
+	s, err := openLocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	song1 := bytes.Repeat([]byte{1}, idLength)
+	song2 := bytes.Repeat([]byte{2}, idLength)
+	older := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	locations := []struct {
+		id []byte
+		l  songLocation
+	}{
+		{song1, songLocation{Repository: "r1", Host: "laptop", Path: "/music/a.mp3", Snapshot: "new", Time: newer}},
+		{song1, songLocation{Repository: "r1", Host: "laptop", Path: "/music/a.mp3", Snapshot: "old", Time: older}},
+		{song1, songLocation{Repository: "r1", Host: "desktop", Path: "/music/a.mp3", Time: older}},
+		{song2, songLocation{Repository: "r1", Host: "desktop", Path: "/music/b.mp3", Time: older}},
+		{song2, songLocation{Repository: "r2", Host: "desktop", Path: "/old/b.mp3", Time: older}},
+	}
+	for _, l := range locations {
+		l := l
+		if err := s.add(l.id, &l.l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dupes, err := s.duplicates("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dupes) != 1 {
+		t.Fatalf("expected 1 duplicate, got %d", len(dupes))
+	}
+	list := dupes[hex.EncodeToString(song1)]
+	if len(list) != 2 {
+		t.Fatalf("expected 2 locations, got %d", len(list))
+	}
+	if list[0].Host != "desktop" || list[1].Host != "laptop" {
+		t.Errorf("unexpected location order: %s, %s", list[0].Host, list[1].Host)
+	}
+	if list[1].Snapshot != "new" {
+		t.Errorf("expected the latest snapshot, got %s", list[1].Snapshot)
+	}
+
+	list, err = s.locations(hex.EncodeToString(song2), "r2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Path != "/old/b.mp3" {
+		t.Errorf("unexpected locations %+v", list)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/blugelabs/bluge"
 	gap "github.com/muesli/go-app-paths"
 	"github.com/rubiojr/rapi"
+	"github.com/rubiojr/rplay/internal/acoustid"
+	"github.com/rubiojr/rplay/internal/musicbrainz"
 	"github.com/urfave/cli/v2"
 )
 
@@ -75,6 +77,44 @@ func main() {
 				Destination: &indexPath,
 				Value:       defaultIndexPath(),
 			},
+			&cli.StringFlag{
+				Name:        "config",
+				EnvVars:     []string{"RPLAY_CONFIG"},
+				Usage:       "Configuration file",
+				Required:    false,
+				Destination: &configPath,
+				Value:       defaultConfigPath(),
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Aliases:     []string{"o"},
+				Usage:       outputHelp,
+				Required:    false,
+				Destination: &outputName,
+				Value:       "device",
+			},
+			&cli.StringFlag{
+				Name:        "acoustid-key",
+				EnvVars:     []string{"ACOUSTID_API_KEY"},
+				Usage:       "AcoustID API key, used to fetch metadata",
+				Required:    false,
+				Destination: &acoustIDKey,
+				DefaultText: " ",
+			},
+			&cli.StringFlag{
+				Name:        "acoustid-url",
+				EnvVars:     []string{"ACOUSTID_URL"},
+				Usage:       "AcoustID web service `URL` (default: " + acoustid.DefaultBaseURL + ")",
+				Required:    false,
+				Destination: &acoustIDURL,
+			},
+			&cli.StringFlag{
+				Name:        "musicbrainz-url",
+				EnvVars:     []string{"MUSICBRAINZ_URL"},
+				Usage:       "MusicBrainz web service `URL` (default: " + musicbrainz.DefaultBaseURL + ")",
+				Required:    false,
+				Destination: &musicBrainzURL,
+			},
 			&cli.BoolFlag{
 				Name:     "debug",
 				Aliases:  []string{"d"},
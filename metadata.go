@@ -0,0 +1,197 @@
+package main
+
+import (
+	"github.com/rubiojr/rplay/internal/fps"
+)
+
+// Where the value of a song field comes from. Fields without a source come
+// from the song tags.
+const (
+	sourceTags        = "tags"
+	sourceAcoustID    = "acoustid"
+	sourceMusicBrainz = "musicbrainz"
+)
+
+// Fields with the MusicBrainz identifiers of a song.
+const (
+	fieldRecordingID    = "musicbrainz_recording_id"
+	fieldReleaseID      = "musicbrainz_release_id"
+	fieldReleaseGroupID = "musicbrainz_releasegroup_id"
+	fieldArtistID       = "musicbrainz_artist_id"
+)
+
+// originalField is the field keeping the value read from the song tags
+// when field is set from another source.
+func originalField(field string) string {
+	return "original_" + field
+}
+
+// sourceField is the field recording where the value of field comes from.
+func sourceField(field string) string {
+	return field + "_source"
+}
+
+// fieldSource returns where the value of a song field comes from.
+func fieldSource(d *storedDocument, field string) string {
+	if s := d.text(sourceField(field)); s != "" {
+		return s
+	}
+	return sourceTags
+}
+
+// keepOriginal copies the value of a field read from the song tags to its
+// original field, before it's changed.
+func keepOriginal(d *storedDocument, field string) {
+	if _, ok := d.fields[originalField(field)]; ok || fieldSource(d, field) != sourceTags {
+		return
+	}
+	if v, ok := d.fields[field]; ok {
+		d.fields[originalField(field)] = v
+	} else {
+		d.setText(originalField(field), "")
+	}
+}
+
+// setField sets a song field from source, keeping the value read from the
+// song tags. Fields with a value are only changed when overriding, or when
+// the value was inferred from the song path. Values set by the user are
+// never changed. Returns true if the song changed.
+func setField(d *storedDocument, field, value, source string, override bool) bool {
+	current := d.text(field)
+	if value == "" || value == current || fieldSource(d, field) == sourceUser {
+		return false
+	}
+	if current != "" && !override && fieldSource(d, field) != sourcePath {
+		return false
+	}
+
+	keepOriginal(d, field)
+	d.setText(field, value)
+	d.setText(sourceField(field), source)
+	return true
+}
+
+// setFingerprintMetadata sets the song fields found by the metadata
+// providers. Values read from the song tags are in the index already.
+func setFingerprintMetadata(d *storedDocument, m *fps.Metadata, override bool) bool {
+	changed := false
+	for _, field := range fps.Fields {
+		source := m.Source(field)
+		if source == "" {
+			// cached before sources were recorded
+			source = sourceAcoustID
+		}
+		if source == sourceTags || source == sourceUser {
+			continue
+		}
+		if setField(d, field, *m.Field(field), source, override) {
+			changed = true
+		}
+	}
+	if m.ReleaseID != "" && setRelease(d, m, override) {
+		changed = true
+	}
+	return changed
+}
+
+// setRelease sets the release details and identifiers found in
+// MusicBrainz.
+func setRelease(d *storedDocument, m *fps.Metadata, override bool) bool {
+	changed := false
+	for field, value := range map[string]string{
+		"album_artist": m.AlbumArtist,
+		"label":        m.Label,
+		"release_date": m.ReleaseDate,
+	} {
+		if setField(d, field, value, sourceMusicBrainz, override) {
+			changed = true
+		}
+	}
+	for field, value := range map[string]int{"track": m.TrackNumber, "year": m.Year()} {
+		if setNumberField(d, field, value, sourceMusicBrainz) {
+			changed = true
+		}
+	}
+
+	ids := map[string][]string{
+		fieldRecordingID:    {m.RecordingID},
+		fieldReleaseID:      {m.ReleaseID},
+		fieldReleaseGroupID: {m.ReleaseGroupID},
+		fieldArtistID:       m.ArtistIDs,
+	}
+	for field, values := range ids {
+		stored := [][]byte{}
+		for _, v := range values {
+			if v != "" {
+				stored = append(stored, []byte(v))
+			}
+		}
+		if len(stored) == 0 || equalValues(d.fields[field], stored) {
+			continue
+		}
+		d.fields[field] = stored
+		changed = true
+	}
+	return changed
+}
+
+// setNumberField sets a numeric song field from source if it's missing or
+// inferred from the song path.
+func setNumberField(d *storedDocument, field string, value int, source string) bool {
+	current, _ := d.number(field)
+	if value == 0 || float64(value) == current {
+		return false
+	}
+	if current != 0 && fieldSource(d, field) != sourcePath {
+		return false
+	}
+	d.setNumber(field, float64(value))
+	d.setText(sourceField(field), source)
+	return true
+}
+
+func equalValues(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if string(a[i]) != string(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// saveFingerprintMetadata stores the metadata found for a song in the
+// index, so it can be searched.
+func saveFingerprintMetadata(id string, m *fps.Metadata, override bool) error {
+	docs, err := searchDocuments("_id:" + id)
+	if err != nil || len(docs) == 0 {
+		return err
+	}
+
+	if !setFingerprintMetadata(docs[0], m, override) {
+		return nil
+	}
+	return updateDocuments(docs[:1])
+}
+
+// loadFingerprintMetadata returns the metadata found online for every
+// song, by song ID.
+func loadFingerprintMetadata() (map[string]*fps.Metadata, error) {
+	cache, err := metadataCache()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := cache.Entries()
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]*fps.Metadata{}
+	for _, m := range entries {
+		if !m.NotFound {
+			all[m.FileID] = m
+		}
+	}
+	return all, nil
+}
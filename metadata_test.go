@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rubiojr/rplay/internal/fps"
+)
+
+func TestSetFingerprintMetadata(t *testing.T) {
+	d := &storedDocument{id: "song", fields: map[string][][]byte{}}
+	d.setText("artist", "Queen")
+	d.setText("title", "")
+	d.setText("album", "Greatest Hits")
+
+	m := &fps.Metadata{Artist: "Queen", Title: "Don't Stop Me Now", Album: "Jazz"}
+	if !setFingerprintMetadata(d, m, false) {
+		t.Fatal("expected the song to change")
+	}
+	if d.text("title") != m.Title || d.text("album") != "Greatest Hits" {
+		t.Errorf("only missing fields should be set: %q, %q", d.text("title"), d.text("album"))
+	}
+	if fieldSource(d, "title") != sourceAcoustID || fieldSource(d, "album") != sourceTags {
+		t.Errorf("unexpected sources %s, %s", fieldSource(d, "title"), fieldSource(d, "album"))
+	}
+	if v, ok := d.fields[originalField("title")]; !ok || len(v[0]) != 0 {
+		t.Error("expected the empty original title to be kept")
+	}
+
+	if !setFingerprintMetadata(d, m, true) {
+		t.Fatal("expected the song to change when overriding")
+	}
+	if d.text("album") != "Jazz" || d.text(originalField("album")) != "Greatest Hits" {
+		t.Errorf("unexpected album %q, original %q", d.text("album"), d.text(originalField("album")))
+	}
+	if _, ok := d.fields[originalField("artist")]; ok {
+		t.Error("unchanged fields shouldn't have an original value")
+	}
+
+	m.Album = "Jazz (Remastered)"
+	setFingerprintMetadata(d, m, true)
+	if d.text(originalField("album")) != "Greatest Hits" {
+		t.Errorf("the original value changed to %q", d.text(originalField("album")))
+	}
+	if setFingerprintMetadata(d, m, true) {
+		t.Error("expected no changes")
+	}
+}
+
+func TestSetFieldInferred(t *testing.T) {
+	d := &storedDocument{id: "song", fields: map[string][][]byte{}}
+	d.setText("artist", "Queen")
+	d.setText(sourceField("artist"), sourcePath)
+	d.setText("album", "Jazz")
+
+	m := &fps.Metadata{Artist: "Queen + Bowie", Album: "Hot Space"}
+	if !setFingerprintMetadata(d, m, false) {
+		t.Fatal("expected the song to change")
+	}
+	if d.text("artist") != m.Artist || fieldSource(d, "artist") != sourceAcoustID {
+		t.Errorf("values inferred from the path should be replaced: %q", d.text("artist"))
+	}
+	if d.text("album") != "Jazz" {
+		t.Errorf("tags shouldn't be replaced: %q", d.text("album"))
+	}
+}
+
+func TestSongFromDocument(t *testing.T) {
+	d := &storedDocument{id: "song", fields: map[string][][]byte{}}
+	d.setText("path", "/music/Queen/Jazz/03 - Mustapha.mp3")
+	d.setText("artist", "Queen")
+	d.setText("title", "Mustapha")
+	d.setText(sourceField("title"), sourceAcoustID)
+	d.setText(originalField("title"), "Track 3")
+	d.setText("album", "Jazz")
+	d.setText(sourceField("album"), sourcePath)
+
+	song := songFromDocument(d, nil)
+	if song.ID != "song" || song.Path != d.text("path") {
+		t.Errorf("unexpected song %+v", song)
+	}
+	tags := song.Tags
+	if tags.Artist != "Queen" || tags.Title != "Track 3" || tags.Album != "" {
+		t.Errorf("only values from the song tags should be used: %+v", tags)
+	}
+}
+
+func TestSetRelease(t *testing.T) {
+	d := &storedDocument{id: "song", fields: map[string][][]byte{}}
+	d.setText("album_artist", "")
+	d.setNumber("track", 0)
+	d.setNumber("year", 1998)
+	d.setText(sourceField("year"), sourcePath)
+
+	m := &fps.Metadata{
+		RecordingID: "rec",
+		ReleaseID:   "rel",
+		ArtistIDs:   []string{"a1", "a2"},
+		AlbumArtist: "Artist",
+		TrackNumber: 4,
+		ReleaseDate: "1999-03-01",
+		Label:       "Label",
+	}
+	if !setFingerprintMetadata(d, m, false) {
+		t.Fatal("expected the song to change")
+	}
+	if d.text("album_artist") != "Artist" || d.text("label") != "Label" || d.text("release_date") != "1999-03-01" {
+		t.Errorf("unexpected release details %q, %q, %q", d.text("album_artist"), d.text("label"), d.text("release_date"))
+	}
+	if n, _ := d.number("track"); n != 4 {
+		t.Errorf("unexpected track %v", n)
+	}
+	if n, _ := d.number("year"); n != 1999 || fieldSource(d, "year") != sourceMusicBrainz {
+		t.Errorf("the inferred year should be replaced, got %v from %s", n, fieldSource(d, "year"))
+	}
+	if len(d.fields[fieldArtistID]) != 2 || d.text(fieldRecordingID) != "rec" {
+		t.Errorf("unexpected identifiers %q", d.fields[fieldArtistID])
+	}
+	if _, ok := d.fields[fieldReleaseGroupID]; ok {
+		t.Error("empty identifiers shouldn't be stored")
+	}
+	if setFingerprintMetadata(d, m, false) {
+		t.Error("expected no changes")
+	}
+}
+
+func TestBuildDocumentKeepsMetadata(t *testing.T) {
+	blobs, _ := fakeBlobs(id3v2Tag("Intro", 100), 1000)
+	b := MP3DocumentBuilder{metadata: map[string]*fps.Metadata{
+		"song": {
+			FileID:      "song",
+			Title:       "Outro",
+			Artist:      "Queen",
+			RecordingID: "rec",
+			ReleaseID:   "rel",
+			Sources:     map[string]string{"title": fps.ProviderAcoustID, "artist": fps.ProviderAcoustID},
+		},
+	}}
+
+	d := storedFields(b.buildDocument("song", "/music/intro.mp3", blobs))
+	if d.id != "song" {
+		t.Errorf("unexpected ID %q", d.id)
+	}
+	if d.text("title") != "Intro" || d.text("artist") != "Queen" {
+		t.Errorf("unexpected title %q, artist %q", d.text("title"), d.text("artist"))
+	}
+	if fieldSource(d, "artist") != sourceAcoustID || d.text(fieldReleaseID) != "rel" {
+		t.Errorf("the metadata found online wasn't applied: %v", d.fields)
+	}
+
+	d = storedFields(b.buildDocument("other", "/music/intro.mp3", blobs))
+	if d.text("artist") != "" || fieldSource(d, "artist") != sourceTags {
+		t.Errorf("unexpected artist %q", d.text("artist"))
+	}
+}
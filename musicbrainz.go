@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/rubiojr/rplay/internal/musicbrainz"
+	"gopkg.in/ini.v1"
+)
+
+var musicBrainzURL string
+
+// musicBrainzUserAgent identifies rplay, as MusicBrainz asks.
+const musicBrainzUserAgent = "rplay/" + RPLAY_VERSION + " ( https://github.com/rubiojr/rplay )"
+
+// newMusicBrainzClient returns a client for the MusicBrainz web service set
+// from the command line, the environment or the [musicbrainz] section of
+// the configuration file.
+func newMusicBrainzClient(cfg *ini.File) *musicbrainz.Client {
+	s := cfg.Section("musicbrainz")
+	u := musicBrainzURL
+	if u == "" {
+		u = s.Key("url").MustString(musicbrainz.DefaultBaseURL)
+	}
+	client := musicbrainz.NewClient(musicBrainzUserAgent)
+	client.BaseURL = strings.TrimSuffix(u, "/")
+	client.Timeout = s.Key("timeout").MustDuration(client.Timeout)
+	client.MaxRetries = s.Key("retries").MustInt(client.MaxRetries)
+	return client
+}
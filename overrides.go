@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+
+	"github.com/blugelabs/bluge"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// sourceUser is the source of the values set with rplay tag.
+const sourceUser = "user"
+
+// overrideFields are the song fields that can be set with rplay tag.
+var overrideFields = []string{"artist", "title", "album", "album_artist", "genre", "year"}
+
+// overrideStore keeps the tags set with rplay tag, keyed by song ID. Songs
+// can't be changed in the repository, so the tags are applied over the
+// ones read from the songs when indexing.
+type overrideStore struct {
+	db *leveldb.DB
+}
+
+func overridesPath() string {
+	return filepath.Join(filepath.Dir(indexPath), "overrides")
+}
+
+func openOverrides() (*overrideStore, error) {
+	db, err := leveldb.OpenFile(overridesPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &overrideStore{db: db}, nil
+}
+
+func (s *overrideStore) close() error {
+	return s.db.Close()
+}
+
+// get returns the tags set for a song, nil if none.
+func (s *overrideStore) get(songID string) (map[string]string, error) {
+	v, err := s.db.Get([]byte(songID), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]string{}
+	return tags, json.Unmarshal(v, &tags)
+}
+
+// set replaces the tags set for a song.
+func (s *overrideStore) set(songID string, tags map[string]string) error {
+	v, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	return s.db.Put([]byte(songID), v, nil)
+}
+
+func (s *overrideStore) remove(songID string) error {
+	return s.db.Delete([]byte(songID), nil)
+}
+
+// all returns the tags set for every song, by song ID.
+func (s *overrideStore) all() (map[string]map[string]string, error) {
+	all := map[string]map[string]string{}
+	iter := s.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		tags := map[string]string{}
+		if err := json.Unmarshal(iter.Value(), &tags); err != nil {
+			return nil, err
+		}
+		all[string(iter.Key())] = tags
+	}
+	return all, iter.Error()
+}
+
+// loadOverrides returns the tags set for every song, by song ID.
+func loadOverrides() (map[string]map[string]string, error) {
+	s, err := openOverrides()
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	return s.all()
+}
+
+// overrideTags sets song fields to the values set by the user, keeping
+// the values read from the song tags. Returns true if the song changed.
+func overrideTags(d *storedDocument, tags map[string]string) bool {
+	changed := false
+	for field, value := range tags {
+		if fieldSource(d, field) == sourceUser && d.text(field) == encodeOverride(field, value) {
+			continue
+		}
+		keepOriginal(d, field)
+		d.setText(field, encodeOverride(field, value))
+		d.setText(sourceField(field), sourceUser)
+		changed = true
+	}
+	return changed
+}
+
+// clearOverrides restores the song fields set by the user to the values
+// read from the song tags. Returns true if the song changed.
+func clearOverrides(d *storedDocument) bool {
+	changed := false
+	for _, field := range overrideFields {
+		if fieldSource(d, field) != sourceUser {
+			continue
+		}
+		if v, ok := d.fields[originalField(field)]; ok {
+			d.fields[field] = v
+			delete(d.fields, originalField(field))
+		} else if numericFields[field] {
+			d.setNumber(field, 0)
+		} else {
+			d.setText(field, "")
+		}
+		delete(d.fields, sourceField(field))
+		changed = true
+	}
+	return changed
+}
+
+// encodeOverride returns a value set by the user as stored in the index.
+func encodeOverride(field, value string) string {
+	if !numericFields[field] {
+		return value
+	}
+	n, _ := strconv.Atoi(value)
+	return string(bluge.NewNumericField(field, float64(n)).Value())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rubiojr/rplay/internal/fps"
+)
+
+func TestOverrideStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(p string) { indexPath = p }(indexPath)
+	indexPath = filepath.Join(dir, "rplay.bluge")
+
+	s, err := openOverrides()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	d := &storedDocument{id: "song", fields: map[string][][]byte{}}
+	d.setText("artist", "Wrong")
+	d.setText("title", "Song")
+	if ok, err := retag(s, d, map[string]string{"artist": "Artist"}, false); err != nil || !ok {
+		t.Fatalf("expected the song to change: %v", err)
+	}
+	if ok, _ := retag(s, d, map[string]string{"year": "1999"}, false); !ok {
+		t.Fatal("expected the song to change")
+	}
+	tags, err := s.get("song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags["artist"] != "Artist" || tags["year"] != "1999" {
+		t.Errorf("unexpected overrides %v", tags)
+	}
+	if y, _ := d.number("year"); y != 1999 || d.text("artist") != "Artist" || fieldSource(d, "artist") != sourceUser {
+		t.Errorf("unexpected song %v, %q from %s", y, d.text("artist"), fieldSource(d, "artist"))
+	}
+	if d.text(originalField("artist")) != "Wrong" {
+		t.Errorf("unexpected original artist %q", d.text(originalField("artist")))
+	}
+
+	// values set by the user aren't replaced by other sources
+	if setFingerprintMetadata(d, &fps.Metadata{Artist: "Other", Sources: map[string]string{"artist": sourceAcoustID}}, true) {
+		t.Error("the artist set by the user was replaced")
+	}
+
+	if ok, _ := retag(s, d, nil, true); !ok {
+		t.Fatal("expected the song to change")
+	}
+	if d.text("artist") != "Wrong" || fieldSource(d, "artist") != sourceTags {
+		t.Errorf("unexpected artist %q from %s", d.text("artist"), fieldSource(d, "artist"))
+	}
+	if y, _ := d.number("year"); y != 0 {
+		t.Errorf("unexpected year %v", y)
+	}
+	all, err := s.all()
+	if err != nil || len(all) != 0 {
+		t.Errorf("expected no overrides, got %v, %v", all, err)
+	}
+}
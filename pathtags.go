@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// sourcePath marks song fields inferred from the song path.
+const sourcePath = "path"
+
+// defaultTagPatterns are tried in order when no patterns are configured.
+var defaultTagPatterns = []string{
+	"{artist}/{year} - {album}/{track} - {title}",
+	"{artist}/{album}/{track} - {title}",
+	"{artist}/{album}/{track}. {title}",
+	"{artist}/{album}/{track} {title}",
+	"{track} - {title}",
+	"{artist} - {title}",
+}
+
+// pathTagFields are the fields patterns can have, numeric ones match
+// digits only. {*} matches anything within a path component.
+var pathTagFields = map[string]bool{
+	"artist": false,
+	"album":  false,
+	"title":  false,
+	"track":  true,
+	"year":   true,
+}
+
+// pathTagger infers the tags of songs from their path.
+type pathTagger struct {
+	patterns []*regexp.Regexp
+}
+
+// newPathTagger compiles patterns like {artist}/{album}/{track} - {title},
+// matched against the end of song paths without the file extension.
+func newPathTagger(patterns []string) (*pathTagger, error) {
+	t := &pathTagger{}
+	for _, p := range patterns {
+		re, err := compileTagPattern(p)
+		if err != nil {
+			return nil, err
+		}
+		t.patterns = append(t.patterns, re)
+	}
+	return t, nil
+}
+
+var placeholderRe = regexp.MustCompile(`\{([a-z*]+)\}`)
+
+func compileTagPattern(pattern string) (*regexp.Regexp, error) {
+	expr := ""
+	seen := map[string]bool{}
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(pattern, -1) {
+		expr += regexp.QuoteMeta(pattern[last:m[0]])
+		last = m[1]
+
+		name := pattern[m[2]:m[3]]
+		numeric, ok := pathTagFields[name]
+		switch {
+		case name == "*":
+			expr += `[^/]*?`
+			continue
+		case !ok:
+			return nil, fmt.Errorf("invalid tag pattern %s: unknown field %s", pattern, name)
+		case seen[name]:
+			return nil, fmt.Errorf("invalid tag pattern %s: repeated field %s", pattern, name)
+		}
+		seen[name] = true
+		if numeric {
+			expr += `(?P<` + name + `>\d+)`
+		} else {
+			expr += `(?P<` + name + `>[^/]+?)`
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("invalid tag pattern %s: no fields", pattern)
+	}
+	expr += regexp.QuoteMeta(pattern[last:])
+
+	return regexp.Compile(`(?:^|/)` + expr + `$`)
+}
+
+// infer returns the fields found in a song path by the first pattern
+// matching it.
+func (t *pathTagger) infer(p string) map[string]string {
+	p = strings.TrimSuffix(p, path.Ext(p))
+	for _, re := range t.patterns {
+		m := re.FindStringSubmatch(p)
+		if m == nil {
+			continue
+		}
+		fields := map[string]string{}
+		for i, name := range re.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			v := strings.Join(strings.Fields(strings.ReplaceAll(m[i], "_", " ")), " ")
+			if pathTagFields[name] {
+				n, _ := strconv.Atoi(v)
+				if n == 0 {
+					continue
+				}
+				v = strconv.Itoa(n)
+			}
+			if v != "" {
+				fields[name] = v
+			}
+		}
+		return fields
+	}
+	return map[string]string{}
+}
+
+// pathTaggerFromConfig returns the tagger for patterns, or the tag_pattern
+// keys of the [index] section of the configuration file. Paths are only
+// guessed from when there are patterns, or path_tags is true to use the
+// default ones. Returns nil if tags aren't inferred.
+func pathTaggerFromConfig(cfg *ini.File, patterns []string) (*pathTagger, error) {
+	s := cfg.Section("index")
+	if len(patterns) == 0 && s.HasKey("tag_pattern") {
+		patterns = s.Key("tag_pattern").ValueWithShadows()
+	}
+	if !s.Key("path_tags").MustBool(len(patterns) > 0) {
+		return nil, nil
+	}
+	if len(patterns) == 0 {
+		patterns = defaultTagPatterns
+	}
+	return newPathTagger(patterns)
+}
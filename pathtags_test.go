@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestPathTagger(t *testing.T) {
+	tagger, err := newPathTagger(defaultTagPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]map[string]string{
+		"/music/Queen/Jazz/03 - Don't Stop Me Now.mp3": {
+			"artist": "Queen", "album": "Jazz", "track": "3", "title": "Don't Stop Me Now",
+		},
+		"/music/Queen/1978 - Jazz/12 - Mustapha.flac": {
+			"artist": "Queen", "album": "Jazz", "year": "1978", "track": "12", "title": "Mustapha",
+		},
+		"/music/Queen/Jazz/07. Fat_Bottomed_Girls.ogg": {
+			"artist": "Queen", "album": "Jazz", "track": "7", "title": "Fat Bottomed Girls",
+		},
+		"/downloads/Queen - Bicycle Race.mp3": {
+			"artist": "Queen", "title": "Bicycle Race",
+		},
+		"/downloads/05 - Jealousy.mp3": {
+			"track": "5", "title": "Jealousy",
+		},
+		"/downloads/song.mp3": {},
+	}
+	for path, want := range tests {
+		if got := tagger.infer(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+
+	custom, err := newPathTagger([]string{"{album} ({year})/{*} {title}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"album": "Jazz", "year": "1978", "title": "Mustapha"}
+	if got := custom.infer("Jazz (1978)/A12 Mustapha.mp3"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	for _, p := range []string{"{artist}/{genre}", "{title} - {title}", "no fields"} {
+		if _, err := newPathTagger([]string{p}); err == nil {
+			t.Errorf("expected an error for %s", p)
+		}
+	}
+}
+
+func TestPathTaggerFromConfig(t *testing.T) {
+	for conf, want := range map[string]int{
+		"":                               0,
+		"path_tags = true":               len(defaultTagPatterns),
+		"tag_pattern = {artist}/{title}": 1,
+		"path_tags = false\ntag_pattern = {artist}/{title}": 0,
+	} {
+		cfg, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true}, []byte("[index]\n"+conf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tagger, err := pathTaggerFromConfig(cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		if tagger != nil {
+			got = len(tagger.patterns)
+		}
+		if got != want {
+			t.Errorf("%q: expected %d patterns, got %d", conf, want, got)
+		}
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 
-	"github.com/hajimehoshi/oto"
 	"github.com/jfreymuth/oggvorbis"
+	"github.com/rubiojr/rplay/internal/audioinfo"
+	"github.com/rubiojr/rplay/internal/flac"
 
 	"github.com/hajimehoshi/go-mp3"
 )
@@ -30,23 +33,23 @@ func NewReader(ctx context.Context, r io.Reader) io.Reader {
 	}
 }
 
-func play(ctx context.Context, t string, reader io.Reader) error {
-	rate, d, err := readerFromAudioType(t, reader)
-	if err != nil {
-		return err
-	}
+// The format of the audio output. Songs are resampled to it.
+const (
+	outputSampleRate = 44100
+	outputChannels   = 2
+	outputBitDepth   = 2
+	outputBufferSize = 32768
+)
 
-	c, err := oto.NewContext(rate, 2, 2, 32768)
+// decodeAudio returns the audio read from reader decoded to 16 bit stereo
+// samples at the output sample rate.
+func decodeAudio(t string, reader io.Reader) (io.Reader, error) {
+	rate, d, err := readerFromAudioType(t, reader)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer c.Close()
-
-	player := c.NewPlayer()
-	defer player.Close()
 
-	_, err = io.Copy(player, NewReader(ctx, d))
-	return err
+	return NewResampler(d, rate, outputSampleRate), nil
 }
 
 func readerFromAudioType(t string, f io.Reader) (int, io.Reader, error) {
@@ -56,14 +59,100 @@ func readerFromAudioType(t string, f io.Reader) (int, io.Reader, error) {
 		if err != nil {
 			return 0, nil, err
 		}
-		return d.SampleRate(), NewReaderFromFloat32Reader(d), nil
+		return d.SampleRate(), NewReaderFromFloat32Reader(newStereoFloat32Reader(d, d.Channels())), nil
 	case "audio/mpeg":
+		gap, trim := audioinfo.EncoderGap{}, false
+		if transition == transitionGapless {
+			gap, trim, f = readEncoderGap(f)
+		}
 		d, err := mp3.NewDecoder(f)
 		if err != nil {
 			return 0, nil, err
 		}
+		if trim {
+			return d.SampleRate(), trimEncoderGap(d, gap), nil
+		}
 		return d.SampleRate(), d, nil
+	case "audio/x-flac":
+		d, err := flac.NewDecoder(f)
+		if err != nil {
+			return 0, nil, err
+		}
+		return d.SampleRate(), NewReaderFromFLACDecoder(d), nil
 	default:
 		return 0, nil, fmt.Errorf("unsupported audio type %s", t)
 	}
 }
+
+// playableCodecs are the codecs, as indexed, readerFromAudioType decodes.
+var playableCodecs = map[string]bool{
+	"mp3":    true,
+	"vorbis": true,
+	"flac":   true,
+}
+
+// playableExtensions are the extensions of the songs the player decodes,
+// for songs indexed without a codec.
+var playableExtensions = map[string]bool{
+	".mp3":  true,
+	".ogg":  true,
+	".flac": true,
+}
+
+// playable is true if the player can decode an indexed song. Other audio
+// files can be indexed, but not played.
+func playable(codec, filename string) bool {
+	if codec != "" {
+		return playableCodecs[codec]
+	}
+	return playableExtensions[strings.ToLower(filepath.Ext(filename))]
+}
+
+// Front left and right channels for each Vorbis channel count, in Vorbis
+// channel order.
+var vorbisStereoChannels = map[int][2]int{
+	1: {0, 0},
+	2: {0, 1},
+	3: {0, 2},
+	4: {0, 1},
+	5: {0, 2},
+	6: {0, 2},
+	7: {0, 2},
+	8: {0, 2},
+}
+
+// stereoFloat32Reader turns interleaved samples with any number of channels
+// into stereo ones, duplicating mono channels and keeping the front
+// left and right channels of multi-channel streams.
+type stereoFloat32Reader struct {
+	r        Float32Reader
+	channels int
+	buf      []float32
+}
+
+func newStereoFloat32Reader(r Float32Reader, channels int) Float32Reader {
+	if channels == 2 {
+		return r
+	}
+	return &stereoFloat32Reader{r: r, channels: channels}
+}
+
+func (s *stereoFloat32Reader) Read(p []float32) (int, error) {
+	frames := len(p) / 2
+	if frames == 0 {
+		return 0, nil
+	}
+	if cap(s.buf) < frames*s.channels {
+		s.buf = make([]float32, frames*s.channels)
+	}
+	buf := s.buf[:frames*s.channels]
+
+	n, err := s.r.Read(buf)
+	ch := vorbisStereoChannels[s.channels]
+	frames = n / s.channels
+	for i := 0; i < frames; i++ {
+		p[2*i] = buf[i*s.channels+ch[0]]
+		p[2*i+1] = buf[i*s.channels+ch[1]]
+	}
+	return frames * 2, err
+}
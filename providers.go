@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/rubiojr/rplay/internal/fps"
+)
+
+// defaultProviders are the metadata providers asked, in order, when the
+// [metadata] section of the configuration file doesn't set them. Tags
+// inferred from paths are guesses, only used for what isn't found online.
+var defaultProviders = []string{
+	fps.ProviderUser,
+	fps.ProviderCache,
+	fps.ProviderTags,
+	fps.ProviderAcoustID,
+	fps.ProviderMusicBrainz,
+	fps.ProviderPath,
+}
+
+// newFingerprinter returns the chain of providers used to find song
+// metadata. Metadata found online is cached in the index directory. If
+// choose is set, it picks the AcoustID match for each song.
+func newFingerprinter(choose func(id string, candidates []fps.Candidate) *fps.Candidate) (*fps.Chain, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	names := defaultProviders
+	if s := cfg.Section("metadata"); s.HasKey("providers") {
+		names = strings.FieldsFunc(s.Key("providers").String(), func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	pathTags, err := pathTaggerFromConfig(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := []fps.Provider{}
+	for _, name := range names {
+		switch name {
+		case fps.ProviderUser:
+			providers = append(providers, fps.UserProvider{})
+		case fps.ProviderCache:
+			cache, err := metadataCache()
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, cache)
+		case fps.ProviderTags:
+			providers = append(providers, fps.TagsProvider{})
+		case fps.ProviderPath:
+			if pathTags != nil {
+				providers = append(providers, fps.PathProvider{Infer: pathTags.infer})
+			}
+		case fps.ProviderAcoustID:
+			providers = append(providers, fps.NewAcoustIDProvider(acoustIDClient, fps.Options{
+				MinConfidence: minConfidence,
+				Choose:        choose,
+				Fingerprint:   fingerprintFile,
+			}))
+		case fps.ProviderMusicBrainz:
+			providers = append(providers, fps.NewMusicBrainzProvider(newMusicBrainzClient(cfg)))
+		default:
+			return nil, fmt.Errorf("unknown metadata provider %s", name)
+		}
+	}
+	return fps.NewChain(providers...), nil
+}
+
+// metadataCache returns the cache of the metadata found online, in the
+// index directory. Songs not found are cached for the negative_ttl of the
+// [metadata] section.
+func metadataCache() (*fps.Cache, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	cache := fps.NewCache(filepath.Join(defaultIndexDir(), "acoustid.db"))
+	cache.NegativeTTL = cfg.Section("metadata").Key("negative_ttl").MustDuration(fps.DefaultNegativeTTL)
+	return cache, nil
+}
+
+// providerBefore is true if provider a is asked before b, or b isn't used.
+func providerBefore(chain *fps.Chain, a, b string) bool {
+	ia, ib := -1, -1
+	for i, name := range chain.Providers() {
+		switch name {
+		case a:
+			ia = i
+		case b:
+			ib = i
+		}
+	}
+	return ia >= 0 && (ib < 0 || ia < ib)
+}
+
+// songFromDocument returns an indexed song to look up its metadata. The
+// song is downloaded by file if it needs to be fingerprinted.
+func songFromDocument(d *storedDocument, file func(ctx context.Context) (string, error)) *fps.Song {
+	song := &fps.Song{ID: d.id, Path: d.text("path"), File: file}
+	for _, f := range fps.Fields {
+		switch fieldSource(d, f) {
+		case sourceTags:
+			*song.Tags.Field(f) = d.text(f)
+		case sourceUser:
+			*song.Overrides.Field(f) = d.text(f)
+			*song.Tags.Field(f) = d.text(originalField(f))
+		default:
+			*song.Tags.Field(f) = d.text(originalField(f))
+		}
+	}
+	return song
+}
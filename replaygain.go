@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/blugelabs/bluge"
+	"github.com/dhowden/tag"
+)
+
+const (
+	fieldTrackGain = "replaygain_track_gain"
+	fieldTrackPeak = "replaygain_track_peak"
+	fieldAlbumGain = "replaygain_album_gain"
+	fieldAlbumPeak = "replaygain_album_peak"
+	// integrated loudness in LUFS, only for songs measured by rplay analyze
+	fieldLoudness      = "loudness"
+	fieldAlbumLoudness = "album_loudness"
+	// where the gain comes from, tags or r128
+	fieldGainSource = "replaygain_source"
+)
+
+var replayGainFields = []string{fieldTrackGain, fieldTrackPeak, fieldAlbumGain, fieldAlbumPeak}
+
+// ReplayGain 2.0 reference loudness, in LUFS
+const replayGainReference = -18.0
+
+var replayGainMode = "track"
+
+func setupReplayGain() error {
+	switch replayGainMode {
+	case "track", "album", "off":
+		return nil
+	default:
+		return fmt.Errorf("invalid replaygain mode %s", replayGainMode)
+	}
+}
+
+// readReplayGain returns the ReplayGain values found in ID3v2 TXXX frames or
+// Vorbis comments.
+func readReplayGain(m tag.Metadata) map[string]float64 {
+	values := map[string]float64{}
+	if m == nil {
+		return values
+	}
+
+	for k, v := range m.Raw() {
+		name := strings.ToLower(k)
+		text := ""
+		switch v := v.(type) {
+		case *tag.Comm:
+			// ID3v2 user defined text frames
+			name = strings.ToLower(v.Description)
+			text = v.Text
+		case string:
+			text = v
+		default:
+			continue
+		}
+
+		for _, f := range replayGainFields {
+			if name != f {
+				continue
+			}
+			if n, err := parseReplayGain(text); err == nil {
+				values[f] = n
+			}
+		}
+	}
+
+	return values
+}
+
+// parseReplayGain parses gain values like "-6.54 dB" and peaks like "0.98".
+func parseReplayGain(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(s, "dB"), "db"))
+	return strconv.ParseFloat(s, 64)
+}
+
+// replayGain returns the linear gain to apply to a song with the stored
+// metadata meta, lowered if needed so the peak doesn't clip. Album mode
+// falls back to the track gain when the album one is missing.
+func replayGain(meta map[string][]byte) float64 {
+	number := func(field string) (float64, bool) {
+		v, ok := meta[field]
+		if !ok {
+			return 0, false
+		}
+		n, err := bluge.DecodeNumericFloat64(v)
+		return n, err == nil
+	}
+
+	var gain, peak float64
+	var ok bool
+	switch replayGainMode {
+	case "album":
+		if gain, ok = number(fieldAlbumGain); ok {
+			peak, _ = number(fieldAlbumPeak)
+			break
+		}
+		fallthrough
+	case "track":
+		if gain, ok = number(fieldTrackGain); !ok {
+			return 1
+		}
+		peak, _ = number(fieldTrackPeak)
+	default:
+		return 1
+	}
+
+	g := math.Pow(10, gain/20)
+	if peak > 0 && g*peak > 1 {
+		g = 1 / peak
+	}
+	return g
+}
+
+// gainReader applies a fixed gain to 16 bit samples.
+type gainReader struct {
+	r    io.Reader
+	gain float64
+}
+
+func newGainReader(r io.Reader, gain float64) io.Reader {
+	if gain == 1 {
+		return r
+	}
+	return &gainReader{r: r, gain: gain}
+}
+
+func (g *gainReader) Read(p []byte) (int, error) {
+	// whole samples only
+	n, err := io.ReadFull(g.r, p[:len(p)&^1])
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	applyGain(p[:n], g.gain)
+	return n, err
+}
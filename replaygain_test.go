@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/blugelabs/bluge"
+)
+
+func TestParseReplayGain(t *testing.T) {
+	tests := map[string]float64{
+		"-6.54 dB": -6.54,
+		"+2.10 dB": 2.1,
+		" 3 db":    3,
+		"0.988":    0.988,
+	}
+	for s, want := range tests {
+		got, err := parseReplayGain(s)
+		if err != nil || got != want {
+			t.Errorf("%q: expected %f, got %f (%v)", s, want, got, err)
+		}
+	}
+	if _, err := parseReplayGain("loud"); err == nil {
+		t.Error("expected an error parsing an invalid gain")
+	}
+}
+
+func TestReplayGain(t *testing.T) {
+	number := func(v float64) []byte {
+		return bluge.NewNumericField("", v).Value()
+	}
+	meta := map[string][]byte{
+		fieldTrackGain: number(-6),
+		fieldTrackPeak: number(0.5),
+		fieldAlbumGain: number(6),
+		fieldAlbumPeak: number(0.8),
+	}
+	defer func() { replayGainMode = "track" }()
+
+	tests := []struct {
+		mode string
+		meta map[string][]byte
+		want float64
+	}{
+		{"track", meta, math.Pow(10, -6.0/20)},
+		// lowered so the peak doesn't clip
+		{"album", meta, 1 / 0.8},
+		{"off", meta, 1},
+		{"album", map[string][]byte{fieldTrackGain: number(-6)}, math.Pow(10, -6.0/20)},
+		{"track", map[string][]byte{}, 1},
+	}
+	for _, tt := range tests {
+		replayGainMode = tt.mode
+		if got := replayGain(tt.meta); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: expected gain %f, got %f", tt.mode, tt.want, got)
+		}
+	}
+}
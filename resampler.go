@@ -0,0 +1,217 @@
+package main
+
+import (
+	"io"
+	"math"
+)
+
+const (
+	// Zero crossings of the sinc kernel on each side of the output sample.
+	resamplerZeroCrossings = 16
+	// Kernel phases precomputed between two input samples, the rest are
+	// linearly interpolated.
+	resamplerPhases = 256
+	// Fraction of the Nyquist frequency kept by the low-pass filter.
+	resamplerRolloff = 0.97
+	// Output frames generated per fill.
+	resamplerChunk = 1024
+)
+
+// resampler converts 16 bit little endian stereo audio from one sample rate
+// to another using a polyphase windowed-sinc filter.
+type resampler struct {
+	r      io.Reader
+	from   int
+	to     int
+	half   int
+	table  [][]float32
+	raw    []byte
+	carry  int
+	in     []float32
+	base   int64
+	total  int64
+	idx    int64
+	frac   int
+	eof    bool
+	outBuf []byte
+	out    []byte
+}
+
+// NewResampler returns a reader that yields the 16 bit stereo audio read from
+// r converted from sample rate from to sample rate to.
+func NewResampler(r io.Reader, from, to int) io.Reader {
+	if from == to {
+		return r
+	}
+
+	g := gcd(from, to)
+	rs := &resampler{
+		r:      r,
+		from:   from / g,
+		to:     to / g,
+		raw:    make([]byte, 16384),
+		outBuf: make([]byte, resamplerChunk*4),
+	}
+
+	cutoff := resamplerRolloff
+	if to < from {
+		cutoff *= float64(to) / float64(from)
+	}
+	rs.half = int(math.Ceil(resamplerZeroCrossings / cutoff))
+	rs.table = resamplerTable(rs.half, cutoff)
+
+	// Input frames before the first one are silence.
+	rs.in = make([]float32, 2*rs.half)
+	rs.base = -int64(rs.half)
+
+	return rs
+}
+
+// resamplerTable precomputes the filter taps for every phase. Row p holds
+// the taps used to compute an output sample p/resamplerPhases input samples
+// after an input sample.
+func resamplerTable(half int, cutoff float64) [][]float32 {
+	table := make([][]float32, resamplerPhases+1)
+	for p := range table {
+		phase := float64(p) / resamplerPhases
+		taps := make([]float32, 2*half)
+		sum := 0.0
+		h := make([]float64, 2*half)
+		for j := range taps {
+			x := phase - float64(j-half+1)
+			h[j] = cutoff * sinc(cutoff*x) * blackman(x/float64(half))
+			sum += h[j]
+		}
+		// normalize so the DC gain is exactly 1 for every phase
+		for j := range taps {
+			taps[j] = float32(h[j] / sum)
+		}
+		table[p] = taps
+	}
+	return table
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func (rs *resampler) Read(p []byte) (int, error) {
+	for len(rs.out) == 0 {
+		if err := rs.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, rs.out)
+	rs.out = rs.out[n:]
+	return n, nil
+}
+
+// readInput appends the next input frames to the history buffer.
+func (rs *resampler) readInput() error {
+	n, err := rs.r.Read(rs.raw[rs.carry:])
+	n += rs.carry
+	frames := n / 4
+	for i := 0; i < frames; i++ {
+		l := int16(uint16(rs.raw[4*i]) | uint16(rs.raw[4*i+1])<<8)
+		r := int16(uint16(rs.raw[4*i+2]) | uint16(rs.raw[4*i+3])<<8)
+		rs.in = append(rs.in, float32(l), float32(r))
+	}
+	rs.total += int64(frames)
+	rs.carry = copy(rs.raw, rs.raw[frames*4:n])
+
+	if err == io.EOF {
+		rs.eof = true
+		return nil
+	}
+	return err
+}
+
+func (rs *resampler) fill() error {
+	buf := rs.outBuf[:0]
+	for len(buf) < cap(buf) {
+		// make sure the history holds every input frame the filter needs
+		need := rs.idx + int64(rs.half)
+		for rs.base+int64(len(rs.in)/2) <= need && !rs.eof {
+			if err := rs.readInput(); err != nil {
+				return err
+			}
+		}
+		if rs.eof && rs.idx >= rs.total {
+			break
+		}
+		for rs.base+int64(len(rs.in)/2) <= need {
+			// past the end of the input, silence
+			rs.in = append(rs.in, 0, 0)
+		}
+
+		pos := float64(rs.frac) * resamplerPhases / float64(rs.to)
+		p := int(pos)
+		a := float32(pos - float64(p))
+		t0, t1 := rs.table[p], rs.table[p+1]
+
+		offset := int(rs.idx - int64(rs.half) + 1 - rs.base)
+		in := rs.in[2*offset : 2*(offset+2*rs.half)]
+		var l, r float32
+		for j := range t0 {
+			c := t0[j] + (t1[j]-t0[j])*a
+			l += in[2*j] * c
+			r += in[2*j+1] * c
+		}
+		buf = appendSample(buf, l)
+		buf = appendSample(buf, r)
+
+		rs.frac += rs.from
+		for rs.frac >= rs.to {
+			rs.frac -= rs.to
+			rs.idx++
+		}
+
+		// drop history the filter won't need anymore
+		if drop := int(rs.idx - int64(rs.half) + 1 - rs.base); drop > 4096 {
+			rs.in = append(rs.in[:0], rs.in[2*drop:]...)
+			rs.base += int64(drop)
+		}
+	}
+
+	if len(buf) == 0 {
+		return io.EOF
+	}
+	rs.out = buf
+	return nil
+}
+
+// appendSample appends v to buf as a clipped 16 bit little endian sample.
+func appendSample(buf []byte, v float32) []byte {
+	s := clipSample(float64(v))
+	return append(buf, uint8(s), uint8(s>>8))
+}
+
+// clipSample rounds v to the nearest 16 bit sample, clipping it if it's
+// out of range.
+func clipSample(v float64) int16 {
+	s := math.Round(v)
+	if s > math.MaxInt16 {
+		return math.MaxInt16
+	} else if s < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(s)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"testing"
+	"testing/iotest"
+)
+
+func sineFrames(rate, frames int, freq, amp float64) []byte {
+	buf := []byte{}
+	for i := 0; i < frames; i++ {
+		v := float32(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+		buf = appendSample(buf, v)
+		buf = appendSample(buf, -v)
+	}
+	return buf
+}
+
+func TestResamplerSameRate(t *testing.T) {
+	r := bytes.NewReader([]byte{1, 2, 3, 4})
+	if NewResampler(r, 44100, 44100) != r {
+		t.Error("resampling to the same rate should return the original reader")
+	}
+}
+
+func TestResampler(t *testing.T) {
+	tests := []struct {
+		from, to int
+	}{
+		{48000, 44100},
+		{22050, 44100},
+		{44100, 48000},
+		{8000, 44100},
+	}
+
+	for _, tt := range tests {
+		frames := tt.from / 2
+		in := sineFrames(tt.from, frames, 440, 10000)
+		out, err := ioutil.ReadAll(NewResampler(iotest.HalfReader(bytes.NewReader(in)), tt.from, tt.to))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out)%4 != 0 {
+			t.Fatalf("%d -> %d: incomplete frames in output", tt.from, tt.to)
+		}
+
+		got := len(out) / 4
+		want := int(math.Ceil(float64(frames) * float64(tt.to) / float64(tt.from)))
+		if got != want {
+			t.Errorf("%d -> %d: expected %d frames, got %d", tt.from, tt.to, want, got)
+		}
+
+		// Compare with the ideal signal, skipping the edges where the
+		// filter sees silence.
+		expected := sineFrames(tt.to, want, 440, 10000)
+		maxErr := 0.0
+		for i := 400; i < want-400; i++ {
+			for ch := 0; ch < 2; ch++ {
+				o := 4*i + 2*ch
+				g := int16(uint16(out[o]) | uint16(out[o+1])<<8)
+				e := int16(uint16(expected[o]) | uint16(expected[o+1])<<8)
+				maxErr = math.Max(maxErr, math.Abs(float64(g)-float64(e)))
+			}
+		}
+		if maxErr > 50 {
+			t.Errorf("%d -> %d: resampled signal too far from the ideal one, max error %.0f", tt.from, tt.to, maxErr)
+		}
+	}
+}
+
+func TestResamplerFiltersAliases(t *testing.T) {
+	// 20 kHz doesn't fit in a 32 kHz stream and has to be filtered out.
+	in := sineFrames(48000, 24000, 20000, 10000)
+	out, err := ioutil.ReadAll(NewResampler(bytes.NewReader(in), 48000, 32000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peak := 0.0
+	for i := 400; i < len(out)/4-400; i++ {
+		v := int16(uint16(out[4*i]) | uint16(out[4*i+1])<<8)
+		peak = math.Max(peak, math.Abs(float64(v)))
+	}
+	if peak > 200 {
+		t.Errorf("expected the out of band tone to be filtered, peak %.0f", peak)
+	}
+}
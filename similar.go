@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/rubiojr/rapi/restic"
+)
+
+// similarThreshold is the lowest similarity of songs considered copies of
+// each other.
+var similarThreshold = 0.8
+
+// durationTolerance is the largest difference in seconds between the
+// length of songs that look alike by their tags.
+const durationTolerance = 3.0
+
+// titleKeyLength is the length of the beginning and end of titles songs
+// are grouped by to be compared, so titles with a typo are compared too.
+const titleKeyLength = 6
+
+// similarSong holds what's compared to find near-duplicate songs.
+type similarSong struct {
+	doc *storedDocument
+	// data blobs of the song in the repository
+	blobs map[restic.ID]bool
+	// normalized artist and title
+	artist string
+	title  string
+	// length in seconds, 0 if unknown
+	duration float64
+}
+
+func newSimilarSong(d *storedDocument) *similarSong {
+	s := &similarSong{
+		doc:    d,
+		blobs:  map[restic.ID]bool{},
+		artist: normalizeTag(d.text("artist")),
+		title:  normalizeTag(d.text("title")),
+	}
+	s.duration, _ = d.number("duration")
+	// songs without title are compared by file name
+	if s.title == "" {
+		name := d.text("filename")
+		if i := strings.LastIndex(name, "."); i > 0 {
+			name = name[:i]
+		}
+		s.title = normalizeTag(name)
+	}
+
+	pbs := []restic.PackedBlob{}
+	if err := json.Unmarshal([]byte(d.text("blobs")), &pbs); err == nil {
+		for _, pb := range pbs {
+			s.blobs[pb.ID] = true
+		}
+	}
+	return s
+}
+
+// similarity is how alike two songs are, from 0 to 1.
+type similarity struct {
+	a, b *similarSong
+	// shared data blobs, over the blobs of both songs
+	blobs float64
+	// artist and title similarity
+	tags float64
+}
+
+// score is the highest of the blob and tag similarity: re-tagged songs share
+// most blobs, copies encoded again only look alike by their tags.
+func (s similarity) score() float64 {
+	if s.blobs > s.tags {
+		return s.blobs
+	}
+	return s.tags
+}
+
+func compareSongs(a, b *similarSong) similarity {
+	sim := similarity{a: a, b: b, blobs: blobOverlap(a.blobs, b.blobs)}
+	if mayBeSameTrack(a, b) {
+		sim.tags = tagSimilarity(a, b)
+	}
+	return sim
+}
+
+// mayBeSameTrack is false for songs that can't be the same track whatever
+// their tags: songs of different length, or with different numbers in
+// their titles, like the parts of a suite.
+func mayBeSameTrack(a, b *similarSong) bool {
+	if a.duration > 0 && b.duration > 0 && math.Abs(a.duration-b.duration) > durationTolerance {
+		return false
+	}
+	return equalStrings(titleNumbers(a.title), titleNumbers(b.title))
+}
+
+// titleNumbers returns the numbers in a normalized title.
+func titleNumbers(title string) []string {
+	numbers := []string{}
+	for _, w := range strings.Fields(title) {
+		if strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+			numbers = append(numbers, strings.TrimLeft(w, "0"))
+		}
+	}
+	return numbers
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// blobOverlap returns the Jaccard index of the blob sets.
+func blobOverlap(a, b map[restic.ID]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for id := range a {
+		if b[id] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// tagSimilarity compares the artist and title of two songs. Titles weigh
+// more, as the artist tag is often missing.
+func tagSimilarity(a, b *similarSong) float64 {
+	title := stringSimilarity(a.title, b.title)
+	if a.artist == "" || b.artist == "" {
+		// a missing artist can't tell if the songs are the same
+		return title * 0.9
+	}
+	return (stringSimilarity(a.artist, b.artist) + 2*title) / 3
+}
+
+// stringSimilarity returns 1 minus the Levenshtein distance over the length
+// of the longest string.
+func stringSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// normalizeTag lowercases a tag value and replaces punctuation and repeated
+// spaces with a single space.
+func normalizeTag(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// mayBeSimilar returns false if the songs can't reach the threshold, to
+// avoid comparing their tags.
+func mayBeSimilar(a, b *similarSong, threshold float64) bool {
+	if mayBeSameTrack(a, b) && tagBound(a, b) >= threshold {
+		return true
+	}
+	for id := range a.blobs {
+		if b.blobs[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// tagBound is the highest tag similarity possible for the songs, given the
+// length of their titles.
+func tagBound(a, b *similarSong) float64 {
+	la, lb := len([]rune(a.title)), len([]rune(b.title))
+	longest, diff := la, la-lb
+	if lb > la {
+		longest, diff = lb, lb-la
+	}
+	if longest == 0 {
+		return 0
+	}
+	title := 1 - float64(diff)/float64(longest)
+	if a.artist == "" || b.artist == "" {
+		return title * 0.9
+	}
+	return (1 + 2*title) / 3
+}
+
+// similarSongs returns the songs similar to song, most similar first.
+func similarSongs(song *similarSong, songs []*similarSong, threshold float64) []similarity {
+	found := []similarity{}
+	for _, s := range songs {
+		if s.doc.id == song.doc.id || !mayBeSimilar(song, s, threshold) {
+			continue
+		}
+		if sim := compareSongs(song, s); sim.score() >= threshold {
+			found = append(found, sim)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].score() > found[j].score()
+	})
+	return found
+}
+
+// candidateKeys returns the keys of the groups of songs a song is
+// compared with: one for each of its blobs, and its title without spaces,
+// its beginning and its end, so titles with a typo share one.
+func candidateKeys(s *similarSong) []string {
+	keys := []string{}
+	for id := range s.blobs {
+		keys = append(keys, "blob:"+string(id[:]))
+	}
+	title := []rune(strings.ReplaceAll(s.title, " ", ""))
+	if len(title) == 0 {
+		return keys
+	}
+	keys = append(keys, "title:"+string(title))
+	if len(title) > titleKeyLength {
+		keys = append(keys,
+			"start:"+string(title[:titleKeyLength]),
+			"end:"+string(title[len(title)-titleKeyLength:]))
+	}
+	return keys
+}
+
+// songCluster is a group of songs similar to each other, directly or
+// through other songs in the group.
+type songCluster struct {
+	songs []*similarSong
+	pairs []similarity
+}
+
+// clusterSongs groups the similar songs. Only songs sharing blobs or with
+// a title alike are compared, see candidateKeys.
+func clusterSongs(songs []*similarSong, threshold float64) []*songCluster {
+	parent := make([]int, len(songs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	keys := make([][]string, len(songs))
+	buckets := map[string][]int{}
+	for i, s := range songs {
+		keys[i] = candidateKeys(s)
+		for _, key := range keys[i] {
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	pairs := make([][]similarity, len(songs))
+	// compared[j] is i+1 once songs i and j are compared
+	compared := make([]int, len(songs))
+	for i := range songs {
+		for _, key := range keys[i] {
+			for _, j := range buckets[key] {
+				if j <= i || compared[j] == i+1 {
+					continue
+				}
+				compared[j] = i + 1
+				if !mayBeSimilar(songs[i], songs[j], threshold) {
+					continue
+				}
+				sim := compareSongs(songs[i], songs[j])
+				if sim.score() < threshold {
+					continue
+				}
+				parent[find(j)] = find(i)
+				pairs[i] = append(pairs[i], sim)
+			}
+		}
+	}
+
+	clusters := map[int]*songCluster{}
+	list := []*songCluster{}
+	for i, s := range songs {
+		root := find(i)
+		c, ok := clusters[root]
+		if !ok {
+			c = &songCluster{}
+			clusters[root] = c
+			list = append(list, c)
+		}
+		c.songs = append(c.songs, s)
+	}
+	for i, p := range pairs {
+		c := clusters[find(i)]
+		c.pairs = append(c.pairs, p...)
+	}
+
+	found := []*songCluster{}
+	for _, c := range list {
+		if len(c.songs) < 2 {
+			continue
+		}
+		sort.SliceStable(c.pairs, func(i, j int) bool {
+			return c.pairs[i].score() > c.pairs[j].score()
+		})
+		found = append(found, c)
+	}
+	return found
+}
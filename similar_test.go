@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/rubiojr/rapi/restic"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"beatles", "beatels", 2},
+		{"björk", "bjork", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("%s, %s: expected %d, got %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	if got := normalizeTag("  Don't Stop   Me Now (Remastered)"); got != "don t stop me now remastered" {
+		t.Errorf("unexpected normalized tag %q", got)
+	}
+}
+
+func similarTestSong(id, artist, title string, blobs ...byte) *similarSong {
+	pbs := []restic.PackedBlob{}
+	for _, b := range blobs {
+		pbs = append(pbs, restic.PackedBlob{Blob: restic.Blob{BlobHandle: restic.BlobHandle{ID: restic.ID{b}, Type: restic.DataBlob}}})
+	}
+	j, _ := json.Marshal(pbs)
+	d := &storedDocument{id: id, fields: map[string][][]byte{}}
+	d.setText("artist", artist)
+	d.setText("title", title)
+	d.setText("blobs", string(j))
+	return newSimilarSong(d)
+}
+
+func TestClusterSongs(t *testing.T) {
+	songs := []*similarSong{
+		similarTestSong("a", "Queen", "Don't Stop Me Now", 1, 2, 3, 4, 5),
+		// re-tagged
+		similarTestSong("b", "", "Untitled", 6, 2, 3, 4, 5),
+		// typo, another encoding
+		similarTestSong("c", "Queen", "Dont Stop Me Now", 7, 8),
+		similarTestSong("d", "Queen", "Bohemian Rhapsody", 9),
+		similarTestSong("e", "The Beatles", "Help!", 10),
+		similarTestSong("f", "Beatles", "Help", 11),
+	}
+
+	clusters := clusterSongs(songs, 0.6)
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clusters))
+	}
+	ids := func(c *songCluster) string {
+		s := ""
+		for _, song := range c.songs {
+			s += song.doc.id
+		}
+		return s
+	}
+	if ids(clusters[0]) != "abc" || ids(clusters[1]) != "ef" {
+		t.Errorf("unexpected clusters %s, %s", ids(clusters[0]), ids(clusters[1]))
+	}
+
+	p := compareSongs(songs[0], songs[1])
+	if math.Abs(p.blobs-4.0/6) > 1e-9 || p.score() != p.blobs {
+		t.Errorf("unexpected blob similarity %f", p.blobs)
+	}
+
+	// parts of a suite and a live version look alike by their tags only
+	parts := []*similarSong{
+		similarTestSong("p1", "Yes", "Close to the Edge Part 1", 20),
+		similarTestSong("p2", "Yes", "Close to the Edge Part 2", 21),
+		similarTestSong("studio", "Queen", "Love of My Life", 22),
+		similarTestSong("live", "Queen", "Love of My Life", 23),
+		similarTestSong("copy", "Queen", "Love of my life", 24),
+	}
+	parts[2].duration, parts[3].duration, parts[4].duration = 219, 280, 220
+	if clusters := clusterSongs(parts, similarThreshold); len(clusters) != 1 || ids(clusters[0]) != "studiocopy" {
+		t.Errorf("unexpected clusters %v", clusters)
+	}
+
+	found := similarSongs(songs[0], songs, 0.6)
+	if len(found) != 2 || found[0].b.doc.id != "c" || found[1].b.doc.id != "b" {
+		t.Errorf("unexpected similar songs %+v", found)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/oto"
+)
+
+const outputHelp = "Audio output: device, null, null:fast, wav:FILE or stdout"
+
+var outputName = "device"
+
+// audioSink is the long-lived output every song is played through, so there
+// are no gaps or clicks between songs. It receives 16 bit little endian
+// stereo samples at the output sample rate.
+type audioSink interface {
+	io.Writer
+	Close() error
+}
+
+// newAudioSink returns the sink for output:
+//
+//	device       the sound card
+//	null         discards the audio in real time
+//	null:fast    discards the audio as fast as it's decoded
+//	wav:FILE     writes the audio to a WAV file
+//	stdout       writes raw samples to stdout, messages go to stderr
+func newAudioSink(output string) (audioSink, error) {
+	name, arg := output, ""
+	if i := strings.Index(output, ":"); i >= 0 {
+		name, arg = output[:i], output[i+1:]
+	}
+
+	switch {
+	case name == "device" && arg == "":
+		return newDeviceSink()
+	case name == "null" && arg == "":
+		return newNullSink(true), nil
+	case name == "null" && arg == "fast":
+		return newNullSink(false), nil
+	case name == "wav" && arg != "":
+		return newWAVSink(arg)
+	case name == "stdout" && arg == "":
+		return &writerSink{w: os.Stdout}, nil
+	default:
+		return nil, fmt.Errorf("invalid output %s", output)
+	}
+}
+
+// uiWriter returns where the player shows the songs played and their
+// status, stderr when output writes the audio to stdout.
+func uiWriter(output string) io.Writer {
+	if output == "stdout" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// deviceSink plays the audio through the sound card.
+type deviceSink struct {
+	ctx    *oto.Context
+	player *oto.Player
+}
+
+func newDeviceSink() (*deviceSink, error) {
+	c, err := oto.NewContext(outputSampleRate, outputChannels, outputBitDepth, outputBufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deviceSink{ctx: c, player: c.NewPlayer()}, nil
+}
+
+func (s *deviceSink) Write(p []byte) (int, error) {
+	return s.player.Write(p)
+}
+
+func (s *deviceSink) Close() error {
+	s.player.Close()
+	return s.ctx.Close()
+}
+
+// nullSink discards the audio, optionally taking as long as playing it.
+type nullSink struct {
+	realTime bool
+	start    time.Time
+	frames   int64
+}
+
+func newNullSink(realTime bool) *nullSink {
+	return &nullSink{realTime: realTime}
+}
+
+func (s *nullSink) Write(p []byte) (int, error) {
+	if !s.realTime {
+		return len(p), nil
+	}
+
+	// start over after pauses, instead of catching up
+	now := time.Now()
+	if s.frames == 0 || now.Sub(s.playedUntil()) > time.Second {
+		s.start = now
+		s.frames = 0
+	}
+	s.frames += int64(len(p) / (outputChannels * outputBitDepth))
+	time.Sleep(time.Until(s.playedUntil()))
+
+	return len(p), nil
+}
+
+// playedUntil returns when the audio written so far ends playing.
+func (s *nullSink) playedUntil() time.Time {
+	return s.start.Add(time.Duration(s.frames) * time.Second / outputSampleRate)
+}
+
+func (s *nullSink) Close() error {
+	return nil
+}
+
+// writerSink writes raw samples to w.
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+const wavHeaderSize = 44
+
+// wavSink writes the audio to a WAV file. The sizes in the header are
+// filled in when closed.
+type wavSink struct {
+	f    *os.File
+	size int64
+}
+
+func newWAVSink(path string) (*wavSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &wavSink{f: f}
+	if err := s.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *wavSink) Write(p []byte) (int, error) {
+	n, err := s.f.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *wavSink) Close() error {
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		s.f.Close()
+		return err
+	}
+	if err := s.writeHeader(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+func (s *wavSink) writeHeader() error {
+	// sizes don't fit in the header past 4 GiB
+	size := s.size
+	if size > 0xffffffff-wavHeaderSize {
+		size = 0xffffffff - wavHeaderSize
+	}
+	blockAlign := outputChannels * outputBitDepth
+
+	h := struct {
+		riff          [4]byte
+		riffSize      uint32
+		wave          [8]byte
+		fmtSize       uint32
+		format        uint16
+		channels      uint16
+		sampleRate    uint32
+		byteRate      uint32
+		blockAlign    uint16
+		bitsPerSample uint16
+		data          [4]byte
+		dataSize      uint32
+	}{
+		riff:          [4]byte{'R', 'I', 'F', 'F'},
+		riffSize:      uint32(size + wavHeaderSize - 8),
+		wave:          [8]byte{'W', 'A', 'V', 'E', 'f', 'm', 't', ' '},
+		fmtSize:       16,
+		format:        1, // PCM
+		channels:      outputChannels,
+		sampleRate:    outputSampleRate,
+		byteRate:      uint32(outputSampleRate * blockAlign),
+		blockAlign:    uint16(blockAlign),
+		bitsPerSample: outputBitDepth * 8,
+		data:          [4]byte{'d', 'a', 't', 'a'},
+		dataSize:      uint32(size),
+	}
+
+	return binary.Write(s.f, binary.LittleEndian, h)
+}
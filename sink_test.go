@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestWAVSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	s, err := newAudioSink("wav:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	song := sineFrames(outputSampleRate, 1000, 440, 10000)
+	if _, err := s.Write(song); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wav, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wav) != wavHeaderSize+len(song) {
+		t.Fatalf("expected %d bytes, got %d", wavHeaderSize+len(song), len(wav))
+	}
+	if string(wav[:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || string(wav[36:40]) != "data" {
+		t.Error("invalid WAV header")
+	}
+	if rate := binary.LittleEndian.Uint32(wav[24:]); rate != outputSampleRate {
+		t.Errorf("expected sample rate %d, got %d", outputSampleRate, rate)
+	}
+	if size := binary.LittleEndian.Uint32(wav[40:]); int(size) != len(song) {
+		t.Errorf("expected data size %d, got %d", len(song), size)
+	}
+	if !bytes.Equal(wav[wavHeaderSize:], song) {
+		t.Error("samples don't match the ones written")
+	}
+}
+
+func TestInvalidSink(t *testing.T) {
+	for _, o := range []string{"speakers", "wav", "null:slow", "device:1"} {
+		if _, err := newAudioSink(o); err == nil {
+			t.Errorf("expected an error for output %s", o)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blugelabs/bluge"
+	"github.com/rubiojr/rapi/restic"
+)
+
+// snapshotScope selects the snapshots and paths indexed, like restic's
+// snapshot filters.
+type snapshotScope struct {
+	hosts []string
+	// a snapshot matches a tag list if it has all its tags
+	tags restic.TagLists
+	// only files under these paths are indexed
+	paths []string
+	// the latest snapshots for each host and paths, 0 for all
+	latest int
+	// snapshot IDs or ID prefixes
+	ids []string
+}
+
+// selectSnapshots returns the snapshots in scope, newest first.
+func (s *snapshotScope) selectSnapshots(snapshots []*restic.Snapshot) ([]*restic.Snapshot, error) {
+	selected := restic.Snapshots{}
+	for _, sn := range snapshots {
+		if sn.HasHostname(s.hosts) && sn.HasTagList(s.tags) && s.hasPaths(sn) && s.hasID(sn) {
+			selected = append(selected, sn)
+		}
+	}
+	for _, id := range s.ids {
+		if !s.found(id, selected) {
+			return nil, fmt.Errorf("snapshot %s not found", id)
+		}
+	}
+	sort.Sort(selected)
+
+	if s.latest <= 0 {
+		return selected, nil
+	}
+	groups, _, err := restic.GroupSnapshots(selected, "host,paths")
+	if err != nil {
+		return nil, err
+	}
+	latest := restic.Snapshots{}
+	for _, g := range groups {
+		sort.Sort(g)
+		if len(g) > s.latest {
+			g = g[:s.latest]
+		}
+		latest = append(latest, g...)
+	}
+	sort.Sort(latest)
+
+	return latest, nil
+}
+
+func (s *snapshotScope) hasID(sn *restic.Snapshot) bool {
+	if len(s.ids) == 0 {
+		return true
+	}
+	for _, id := range s.ids {
+		if strings.HasPrefix(sn.ID().String(), id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *snapshotScope) found(id string, snapshots restic.Snapshots) bool {
+	for _, sn := range snapshots {
+		if strings.HasPrefix(sn.ID().String(), id) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPaths returns true if the snapshot has files under the paths in scope.
+func (s *snapshotScope) hasPaths(sn *restic.Snapshot) bool {
+	if len(s.paths) == 0 {
+		return true
+	}
+	for _, p := range sn.Paths {
+		if s.walksPath(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// includesFile returns true if the file at p is in scope.
+func (s *snapshotScope) includesFile(p string) bool {
+	if len(s.paths) == 0 {
+		return true
+	}
+	for _, prefix := range s.paths {
+		if isUnder(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// walksPath returns true if the directory at p has to be walked to find
+// files in scope.
+func (s *snapshotScope) walksPath(p string) bool {
+	if len(s.paths) == 0 {
+		return true
+	}
+	for _, prefix := range s.paths {
+		if isUnder(p, prefix) || isUnder(prefix, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// key identifies the scope paths, as snapshots indexed with a path scope
+// still have files to index.
+func (s *snapshotScope) key() string {
+	if len(s.paths) == 0 {
+		return ""
+	}
+	paths := append([]string{}, s.paths...)
+	sort.Strings(paths)
+	return strings.Join(paths, "\x00")
+}
+
+// isUnder returns true if p is dir or a path inside dir.
+func isUnder(p, dir string) bool {
+	p, dir = path.Clean("/"+p), path.Clean("/"+dir)
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// songSnapshots are the snapshots a song was found in.
+type songSnapshots struct {
+	first, last time.Time
+	tags        map[string]bool
+}
+
+func (s *songSnapshots) add(t time.Time, tags []string) {
+	if s.first.IsZero() || t.Before(s.first) {
+		s.first = t
+	}
+	if t.After(s.last) {
+		s.last = t
+	}
+	for _, tag := range tags {
+		s.tags[tag] = true
+	}
+}
+
+// addTo adds the snapshots to the snapshot_tags of song d, and keeps the
+// time of the first and last snapshots in snapshot_time, so searches for
+// snapshots before or after a date find the song. Returns true if the song
+// changed.
+func (s *songSnapshots) addTo(d *storedDocument) bool {
+	changed := false
+	tags := map[string]bool{}
+	for _, v := range d.fields["snapshot_tags"] {
+		tags[string(v)] = true
+	}
+	for tag := range s.tags {
+		if !tags[tag] {
+			d.fields["snapshot_tags"] = append(d.fields["snapshot_tags"], []byte(tag))
+			changed = true
+		}
+	}
+
+	span := &songSnapshots{first: s.first, last: s.last}
+	for _, v := range d.fields["snapshot_time"] {
+		if t, err := bluge.DecodeDateTime(v); err == nil {
+			span.add(t, nil)
+		}
+	}
+	times := [][]byte{bluge.NewDateTimeField("snapshot_time", span.first).Value()}
+	if span.last.After(span.first) {
+		times = append(times, bluge.NewDateTimeField("snapshot_time", span.last).Value())
+	}
+	if !equalValues(d.fields["snapshot_time"], times) {
+		d.fields["snapshot_time"] = times
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blugelabs/bluge"
+	"github.com/rubiojr/rapi/restic"
+	"github.com/rubiojr/rindex"
+	"github.com/rubiojr/rindex/blugeindex"
+)
+
+func TestSelectSnapshots(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 11, d, 0, 0, 0, 0, time.UTC)
+	}
+	snapshots := []*restic.Snapshot{
+		{Hostname: "desktop", Paths: []string{"/music"}, Tags: []string{"music"}, Time: day(1)},
+		{Hostname: "desktop", Paths: []string{"/music"}, Tags: []string{"music", "flac"}, Time: day(3)},
+		{Hostname: "desktop", Paths: []string{"/home"}, Time: day(2)},
+		{Hostname: "laptop", Paths: []string{"/music"}, Tags: []string{"music"}, Time: day(4)},
+	}
+
+	tests := []struct {
+		name  string
+		scope snapshotScope
+		want  []time.Time
+	}{
+		{"all", snapshotScope{}, []time.Time{day(4), day(3), day(2), day(1)}},
+		{"host", snapshotScope{hosts: []string{"desktop"}}, []time.Time{day(3), day(2), day(1)}},
+		{"tags", snapshotScope{tags: restic.TagLists{{"music", "flac"}}}, []time.Time{day(3)}},
+		{"any tag list", snapshotScope{tags: restic.TagLists{{"flac"}, {"music"}}}, []time.Time{day(4), day(3), day(1)}},
+		{"path", snapshotScope{paths: []string{"/music/rock"}}, []time.Time{day(4), day(3), day(1)}},
+		{"parent path", snapshotScope{paths: []string{"/"}}, []time.Time{day(4), day(3), day(2), day(1)}},
+		{"latest", snapshotScope{latest: 1}, []time.Time{day(4), day(3), day(2)}},
+		{"latest for host", snapshotScope{hosts: []string{"desktop"}, paths: []string{"/music"}, latest: 1}, []time.Time{day(3)}},
+	}
+	for _, tt := range tests {
+		got, err := tt.scope.selectSnapshots(snapshots)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %d snapshots, got %d", tt.name, len(tt.want), len(got))
+			continue
+		}
+		for i, sn := range got {
+			if !sn.Time.Equal(tt.want[i]) {
+				t.Errorf("%s: expected snapshot %d from %v, got %v", tt.name, i, tt.want[i], sn.Time)
+			}
+		}
+	}
+}
+
+func TestSnapshotScopePaths(t *testing.T) {
+	s := snapshotScope{paths: []string{"/music/rock/", "/home/me/songs"}}
+
+	files := map[string]bool{
+		"/music/rock/song.mp3":       true,
+		"/music/rock/live/song.mp3":  true,
+		"/music/rockabilly/song.mp3": false,
+		"/home/me/song.mp3":          false,
+	}
+	for p, want := range files {
+		if got := s.includesFile(p); got != want {
+			t.Errorf("file %s: expected %t, got %t", p, want, got)
+		}
+	}
+
+	dirs := map[string]bool{
+		"/music":           true,
+		"/music/rock":      true,
+		"/music/rock/live": true,
+		"/music/pop":       false,
+		"/home":            true,
+		"/home/other":      false,
+	}
+	for p, want := range dirs {
+		if got := s.walksPath(p); got != want {
+			t.Errorf("dir %s: expected %t, got %t", p, want, got)
+		}
+	}
+}
+
+func TestSongSnapshots(t *testing.T) {
+	defer func(i rindex.Indexer) { idx = i }(idx)
+	idx = rindex.Indexer{IndexEngine: blugeindex.NewBlugeIndex(t.TempDir(), 0)}
+	day := func(d int) time.Time {
+		return time.Date(2020, 11, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	d := &storedDocument{id: "song", fields: map[string][][]byte{}}
+	d.setText("title", "Song")
+	d.fields["snapshot_time"] = [][]byte{bluge.NewDateTimeField("snapshot_time", day(10)).Value()}
+	d.fields["snapshot_tags"] = [][]byte{[]byte("laptop")}
+
+	s := &songSnapshots{tags: map[string]bool{}}
+	s.add(day(5), []string{"music"})
+	s.add(day(20), []string{"laptop"})
+	if !s.addTo(d) {
+		t.Fatal("expected the song to change")
+	}
+	if s.addTo(d) {
+		t.Error("expected no changes adding the same snapshots")
+	}
+	if err := updateDocuments([]*storedDocument{d}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []string{
+		"+snapshot_tags:music +snapshot_tags:laptop",
+		`snapshot_time:<"2020-11-06T00:00:00Z"`,
+		`snapshot_time:>"2020-11-15T00:00:00Z"`,
+	} {
+		if docs, err := searchDocuments(q); err != nil || len(docs) != 1 {
+			t.Errorf("%s: expected the song, got %d songs, %v", q, len(docs), err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/h2non/filetype"
+)
+
+// Read-ahead buffer size used when streaming songs from the repository.
+// Restic data blobs are at most 8 MiB, so the download can always
+// stay at least a blob ahead of the decoder.
+const streamBufferSize = 16 * 1024 * 1024
+
+// Bytes needed by filetype to detect the audio type.
+const sniffLen = 262
+
+// streamBuffer is an in-memory pipe with a read-ahead ring buffer.
+// Writes only block when the buffer is full, so a slow blob download
+// doesn't stall playback while there's still data buffered.
+type streamBuffer struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	r    int
+	n    int
+	werr error
+	rerr error
+}
+
+func newStreamBuffer(size int) *streamBuffer {
+	sb := &streamBuffer{buf: make([]byte, size)}
+	sb.cond = sync.NewCond(&sb.mu)
+	return sb
+}
+
+func (sb *streamBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		for sb.n == len(sb.buf) && sb.rerr == nil {
+			sb.cond.Wait()
+		}
+		if sb.rerr != nil {
+			return written, sb.rerr
+		}
+		if sb.werr != nil {
+			return written, io.ErrClosedPipe
+		}
+
+		w := (sb.r + sb.n) % len(sb.buf)
+		end := len(sb.buf)
+		if w < sb.r {
+			end = sb.r
+		}
+		c := copy(sb.buf[w:end], p)
+		sb.n += c
+		written += c
+		p = p[c:]
+		sb.cond.Broadcast()
+	}
+
+	return written, nil
+}
+
+func (sb *streamBuffer) Read(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	for sb.n == 0 && sb.werr == nil && sb.rerr == nil {
+		sb.cond.Wait()
+	}
+	if sb.rerr != nil {
+		return 0, sb.rerr
+	}
+	if sb.n == 0 {
+		return 0, sb.werr
+	}
+
+	end := sb.r + sb.n
+	if end > len(sb.buf) {
+		end = len(sb.buf)
+	}
+	c := copy(p, sb.buf[sb.r:end])
+	sb.r = (sb.r + c) % len(sb.buf)
+	sb.n -= c
+	sb.cond.Broadcast()
+
+	return c, nil
+}
+
+// CloseWithError closes the writing side. Reads return err (io.EOF if nil)
+// once the buffered data has been consumed.
+func (sb *streamBuffer) CloseWithError(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	sb.mu.Lock()
+	if sb.werr == nil {
+		sb.werr = err
+	}
+	sb.cond.Broadcast()
+	sb.mu.Unlock()
+}
+
+// CloseRead closes the reading side, making pending and future writes fail.
+func (sb *streamBuffer) CloseRead() {
+	sb.mu.Lock()
+	sb.rerr = io.ErrClosedPipe
+	sb.cond.Broadcast()
+	sb.mu.Unlock()
+}
+
+// streamSong starts fetching the song from the repository in the background
+// and returns a reader that yields the song bytes as they are downloaded.
+// Cancelling ctx stops the download.
+func streamSong(ctx context.Context, id string) *streamBuffer {
+	sb := newStreamBuffer(streamBufferSize)
+	go func() {
+		sb.CloseWithError(idx.Fetch(ctx, id, sb))
+	}()
+	return sb
+}
+
+// sniffAudioType detects the MIME type of the audio stream from its first
+// bytes, returning a reader that still includes them.
+func sniffAudioType(r io.Reader) (string, io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffLen*4)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", nil, err
+	}
+
+	kind, err := filetype.Match(head)
+	if err != nil {
+		return "", nil, err
+	}
+	if kind.MIME.Value == "" {
+		return "", nil, fmt.Errorf("mime type not found. damaged file?")
+	}
+
+	return kind.MIME.Value, br, nil
+}
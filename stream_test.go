@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestStreamBufferWrapAround(t *testing.T) {
+	sb := newStreamBuffer(8)
+	if n, err := sb.Write([]byte("abcdef")); n != 6 || err != nil {
+		t.Fatalf("unexpected write %d, %v", n, err)
+	}
+	p := make([]byte, 4)
+	if n, _ := sb.Read(p); string(p[:n]) != "abcd" {
+		t.Fatalf("unexpected read %q", p[:n])
+	}
+
+	// fills the end of the buffer and its beginning again
+	if n, err := sb.Write([]byte("ghijk")); n != 5 || err != nil {
+		t.Fatalf("unexpected write %d, %v", n, err)
+	}
+	sb.CloseWithError(nil)
+	rest, err := ioutil.ReadAll(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "efghijk" {
+		t.Errorf("unexpected data %q", rest)
+	}
+}
+
+func TestStreamBufferBlocksWhenFull(t *testing.T) {
+	sb := newStreamBuffer(4)
+	data := []byte("0123456789")
+	go func() {
+		sb.Write(data)
+		sb.CloseWithError(nil)
+	}()
+
+	got, err := ioutil.ReadAll(sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("unexpected data %q", got)
+	}
+}
+
+func TestStreamBufferCloseRead(t *testing.T) {
+	sb := newStreamBuffer(4)
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		n, err := sb.Write([]byte("01234567"))
+		done <- result{n, err}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("the write should block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	sb.CloseRead()
+	select {
+	case r := <-done:
+		if r.n != 4 || r.err != io.ErrClosedPipe {
+			t.Errorf("unexpected write %d, %v", r.n, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CloseRead didn't unblock the writer")
+	}
+
+	if _, err := sb.Read(make([]byte, 4)); err != io.ErrClosedPipe {
+		t.Errorf("expected io.ErrClosedPipe, got %v", err)
+	}
+}
+
+func TestStreamBufferWriteError(t *testing.T) {
+	sb := newStreamBuffer(8)
+	fetchErr := errors.New("fetch failed")
+	sb.Write([]byte("abc"))
+	sb.CloseWithError(fetchErr)
+
+	// the data buffered is read before the error
+	p := make([]byte, 8)
+	if n, err := sb.Read(p); string(p[:n]) != "abc" || err != nil {
+		t.Fatalf("unexpected read %q, %v", p[:n], err)
+	}
+	if _, err := sb.Read(p); err != fetchErr {
+		t.Errorf("expected the write error, got %v", err)
+	}
+	if _, err := sb.Write([]byte("d")); err != io.ErrClosedPipe {
+		t.Errorf("expected io.ErrClosedPipe, got %v", err)
+	}
+}
+
+func TestSniffAudioType(t *testing.T) {
+	pad := func(head string) []byte {
+		return append([]byte(head), make([]byte, 1024)...)
+	}
+	tests := []struct {
+		data []byte
+		mime string
+	}{
+		{pad("ID3\x03\x00\x00\x00\x00\x00\x00"), "audio/mpeg"},
+		{pad("\xff\xfb\x90\x64"), "audio/mpeg"},
+		{pad("OggS\x00\x02"), "audio/ogg"},
+		{pad("fLaC\x00\x00\x00\x22"), "audio/x-flac"},
+	}
+	for _, tt := range tests {
+		mime, r, err := sniffAudioType(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.mime, err)
+			continue
+		}
+		if mime != tt.mime {
+			t.Errorf("expected %s, got %s", tt.mime, mime)
+		}
+		// the bytes sniffed are still read
+		if got, _ := ioutil.ReadAll(r); !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: the reader lost data", tt.mime)
+		}
+	}
+
+	if _, _, err := sniffAudioType(bytes.NewReader(pad("not a song"))); err == nil {
+		t.Error("expected an error for unknown data")
+	}
+}
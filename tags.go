@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/dhowden/tag"
+	"github.com/rubiojr/rapi/repository"
+	"github.com/rubiojr/rapi/restic"
+)
+
+// tagBudget is the most bytes loaded from a song to read its tags and
+// properties, besides its first blob.
+var tagBudget int64 = 16 * 1024 * 1024
+
+var errTagBudget = errors.New("tag byte budget exceeded")
+
+// songBlobs loads the blobs of a song being indexed, at most once each.
+type songBlobs struct {
+	// number of blobs and song size
+	count  int
+	size   int64
+	load   func(i int) ([]byte, error)
+	blobs  map[int][]byte
+	loaded int64
+}
+
+func newSongBlobs(repo *repository.Repository, node *restic.Node) *songBlobs {
+	return &songBlobs{
+		count: len(node.Content),
+		size:  int64(node.Size),
+		load: func(i int) ([]byte, error) {
+			return repo.LoadBlob(context.Background(), restic.DataBlob, node.Content[i], nil)
+		},
+		blobs: map[int][]byte{},
+	}
+}
+
+// blob returns blob i of the song. Only the first one is loaded when the
+// budget is exhausted.
+func (s *songBlobs) blob(i int) ([]byte, error) {
+	if b, ok := s.blobs[i]; ok {
+		return b, nil
+	}
+	if i > 0 && s.loaded >= tagBudget {
+		return nil, errTagBudget
+	}
+
+	b, err := s.load(i)
+	if err != nil {
+		return nil, err
+	}
+	s.blobs[i] = b
+	if i > 0 {
+		s.loaded += int64(len(b))
+	}
+	return b, nil
+}
+
+// tail returns the last blob of the song.
+func (s *songBlobs) tail() ([]byte, error) {
+	return s.blob(s.count - 1)
+}
+
+// readSongTags reads the tags at the beginning of the song, loading blobs
+// until they are complete, and the ID3v1 and APE tags at its end. It also
+// returns the beginning of the song loaded, including the whole tag.
+func readSongTags(s *songBlobs) (tag.Metadata, []byte, error) {
+	head, err := s.blob(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	blobs := s.count
+
+	tags := mergedTags{}
+	n := 1
+	for {
+		// tags can be parsed from incomplete data, make sure they are
+		// complete first
+		if need := tagHeaderSize(head); need > len(head) && n < blobs {
+			next, err := s.blob(n)
+			if err != nil {
+				break
+			}
+			head = append(head[:len(head):len(head)], next...)
+			n++
+			continue
+		}
+
+		m, err := tag.ReadFrom(bytes.NewReader(head))
+		if err == nil {
+			// ID3v1 tags are read from the end of the file below
+			if m.Format() != tag.ID3v1 {
+				tags = append(tags, m)
+			}
+			break
+		}
+		if err == tag.ErrNoTagsFound || n == blobs {
+			break
+		}
+		// a large tag, with embedded pictures for example
+		next, err := s.blob(n)
+		if err != nil {
+			break
+		}
+		head = append(head[:len(head):len(head)], next...)
+		n++
+	}
+
+	if bytes.HasPrefix(head, []byte("fLaC")) || bytes.HasPrefix(head, []byte("OggS")) {
+		// no trailing tags
+		return tags, head, nil
+	}
+	end := head
+	if n < blobs {
+		if end, err = s.tail(); err != nil {
+			return tags, head, nil
+		}
+	}
+
+	if m, ok := readTrailingAPE(s, end, n); ok {
+		tags = append(tags, m)
+	}
+	if m, err := tag.ReadID3v1Tags(bytes.NewReader(end)); err == nil {
+		tags = append(tags, m)
+	}
+
+	return tags, head, nil
+}
+
+// tagHeaderSize returns the bytes needed to read the ID3v2 tag or the FLAC
+// metadata blocks at the beginning of b, as far as it's known from b.
+func tagHeaderSize(b []byte) int {
+	switch {
+	case bytes.HasPrefix(b, []byte("ID3")) && len(b) >= 10:
+		size := 10 + (int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f))
+		if b[5]&0x10 != 0 {
+			size += 10
+		}
+		return size
+	case bytes.HasPrefix(b, []byte("fLaC")):
+		pos := 4
+		for pos+4 <= len(b) {
+			last := b[pos]&0x80 != 0
+			pos += 4 + (int(b[pos+1])<<16 | int(b[pos+2])<<8 | int(b[pos+3]))
+			if last {
+				return pos
+			}
+		}
+		// the next block header
+		return pos + 4
+	default:
+		return 0
+	}
+}
+
+// readTrailingAPE reads the APE tag at end, the last blob of the song,
+// loading the previous ones if the tag doesn't fit. Blobs before loaded
+// are part of end already.
+func readTrailingAPE(s *songBlobs, end []byte, loaded int) (tag.Metadata, bool) {
+	start, footer, err := findAPETag(end)
+	if err != nil {
+		return nil, false
+	}
+
+	last := s.count - 1
+	for i := last - 1; start < 0 && i >= loaded; i-- {
+		b, err := s.blob(i)
+		if err != nil {
+			return nil, false
+		}
+		end = append(append([]byte{}, b...), end...)
+		start += len(b)
+		footer += len(b)
+	}
+	if start < 0 {
+		return nil, false
+	}
+
+	return readAPETag(end[start:footer]), true
+}
+
+// mergedTags returns the first value found in a list of tags.
+type mergedTags []tag.Metadata
+
+func (t mergedTags) str(f func(tag.Metadata) string) string {
+	for _, m := range t {
+		if v := f(m); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (t mergedTags) numberOf(f func(tag.Metadata) (int, int)) (int, int) {
+	for _, m := range t {
+		if n, total := f(m); n != 0 {
+			return n, total
+		}
+	}
+	return 0, 0
+}
+
+func (t mergedTags) Format() tag.Format {
+	if len(t) == 0 {
+		return tag.UnknownFormat
+	}
+	return t[0].Format()
+}
+
+func (t mergedTags) FileType() tag.FileType {
+	if len(t) == 0 {
+		return tag.UnknownFileType
+	}
+	return t[0].FileType()
+}
+
+func (t mergedTags) Title() string       { return t.str(tag.Metadata.Title) }
+func (t mergedTags) Album() string       { return t.str(tag.Metadata.Album) }
+func (t mergedTags) Artist() string      { return t.str(tag.Metadata.Artist) }
+func (t mergedTags) AlbumArtist() string { return t.str(tag.Metadata.AlbumArtist) }
+func (t mergedTags) Composer() string    { return t.str(tag.Metadata.Composer) }
+func (t mergedTags) Genre() string       { return t.str(tag.Metadata.Genre) }
+func (t mergedTags) Lyrics() string      { return t.str(tag.Metadata.Lyrics) }
+func (t mergedTags) Comment() string     { return t.str(tag.Metadata.Comment) }
+func (t mergedTags) Track() (int, int)   { return t.numberOf(tag.Metadata.Track) }
+func (t mergedTags) Disc() (int, int)    { return t.numberOf(tag.Metadata.Disc) }
+
+func (t mergedTags) Year() int {
+	for _, m := range t {
+		if y := m.Year(); y != 0 {
+			return y
+		}
+	}
+	return 0
+}
+
+func (t mergedTags) Picture() *tag.Picture {
+	for _, m := range t {
+		if p := m.Picture(); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// Raw merges the raw tags, the first ones found win.
+func (t mergedTags) Raw() map[string]interface{} {
+	raw := map[string]interface{}{}
+	for i := len(t) - 1; i >= 0; i-- {
+		for k, v := range t[i].Raw() {
+			raw[k] = v
+		}
+	}
+	return raw
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func id3v2Tag(title string, padding int) []byte {
+	frame := append([]byte("TIT2"), 0, 0, 0, byte(len(title)+1), 0, 0, 0)
+	frame = append(frame, title...)
+	body := append(frame, make([]byte, padding)...)
+
+	size := len(body)
+	h := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(h, body...)
+}
+
+func apeTagBytes(items map[string]string) []byte {
+	b := []byte{}
+	for k, v := range items {
+		item := make([]byte, 8)
+		binary.LittleEndian.PutUint32(item, uint32(len(v)))
+		item = append(item, k...)
+		item = append(item, 0)
+		b = append(b, append(item, v...)...)
+	}
+	footer := make([]byte, apeFooterSize)
+	copy(footer, "APETAGEX")
+	binary.LittleEndian.PutUint32(footer[8:], 2000)
+	binary.LittleEndian.PutUint32(footer[12:], uint32(len(b)+apeFooterSize))
+	binary.LittleEndian.PutUint32(footer[16:], uint32(len(items)))
+	return append(b, footer...)
+}
+
+func id3v1Tag(album string, year string) []byte {
+	b := make([]byte, id3v1Size)
+	copy(b, "TAG")
+	copy(b[63:], album)
+	copy(b[93:], year)
+	return b
+}
+
+// fakeBlobs splits file in blobs of size bytes.
+func fakeBlobs(file []byte, size int) (*songBlobs, *int) {
+	chunks := [][]byte{}
+	for len(file) > size {
+		chunks = append(chunks, file[:size])
+		file = file[size:]
+	}
+	chunks = append(chunks, file)
+
+	loads := 0
+	return &songBlobs{
+		count: len(chunks),
+		size:  int64(len(file)),
+		load: func(i int) ([]byte, error) {
+			loads++
+			return chunks[i], nil
+		},
+		blobs: map[int][]byte{},
+	}, &loads
+}
+
+func TestReadSongTags(t *testing.T) {
+	file := id3v2Tag("Big Title", 2500)
+	file = append(file, make([]byte, 10000)...)
+	file = append(file, apeTagBytes(map[string]string{
+		"Artist":                "APE Artist",
+		"REPLAYGAIN_TRACK_GAIN": "-3.5 dB",
+	})...)
+	file = append(file, id3v1Tag("Old Album", "1999")...)
+
+	blobs, loads := fakeBlobs(file, 1000)
+	m, head, err := readSongTags(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(head) < 2500 {
+		t.Errorf("expected the whole ID3v2 tag loaded, got %d bytes", len(head))
+	}
+	if m.Title() != "Big Title" || m.Artist() != "APE Artist" || m.Album() != "Old Album" || m.Year() != 1999 {
+		t.Errorf("unexpected tags: %q %q %q %d", m.Title(), m.Artist(), m.Album(), m.Year())
+	}
+	if rg := readReplayGain(m); rg[fieldTrackGain] != -3.5 {
+		t.Errorf("expected ReplayGain from the APE tag, got %v", rg)
+	}
+	// the ID3v2 tag, the last blob and the previous one for the APE tag
+	if *loads > 6 {
+		t.Errorf("expected blobs in the middle of the song not to be loaded, %d loaded", *loads)
+	}
+}
+
+func TestReadSongTagsBudget(t *testing.T) {
+	file := id3v2Tag("Big Title", 5000)
+	file = append(file, id3v1Tag("Old Album", "1999")...)
+
+	defer func(b int64) { tagBudget = b }(tagBudget)
+	tagBudget = 2000
+
+	blobs, _ := fakeBlobs(file, 1000)
+	m, _, err := readSongTags(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Title() != "" {
+		t.Errorf("expected the ID3v2 tag past the budget to be skipped")
+	}
+	if blobs.loaded > tagBudget+1000 {
+		t.Errorf("loaded %d bytes, over the budget", blobs.loaded)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/blugelabs/bluge"
@@ -25,7 +26,10 @@ var filterField = func(name string) bool {
 
 var filterFieldPlay = func(name string) bool {
 	switch name {
-	case "_id", "cached metadata", "album", "genre", "year", "filename", "title", "artist":
+	case "_id", "cached metadata", "album", "genre", "year", "filename", "title", "artist",
+		"album_artist", "composer", "track", "disc",
+		fieldTrackGain, fieldTrackPeak, fieldAlbumGain, fieldAlbumPeak,
+		"duration", "bitrate", "sample_rate", "channels", "codec":
 		return false
 	default:
 		return true
@@ -38,11 +42,11 @@ func colorize(str, color string) string {
 	return out.Foreground(p.Color(color)).String()
 }
 
-func printRow(header, value, color string) {
-	fmt.Printf("%s %s\n", padding.String(colorize(header+":", color), colPadding), value)
+func printRow(w io.Writer, header, value, color string) {
+	fmt.Fprintf(w, "%s %s\n", padding.String(colorize(header+":", color), colPadding), value)
 }
 
-func printMetadata(field string, value []byte, color string) {
+func printMetadata(w io.Writer, field string, value []byte, color string) {
 	var f string
 	if field == "_id" {
 		f = "ID"
@@ -54,7 +58,7 @@ func printMetadata(field string, value []byte, color string) {
 
 	v := ""
 	switch field {
-	case "mtime":
+	case "mtime", "snapshot_time":
 		t, err := bluge.DecodeDateTime(value)
 		if err != nil {
 			v = "error"
@@ -68,7 +72,7 @@ func printMetadata(field string, value []byte, color string) {
 		} else {
 			v = fmt.Sprintf("%0.f", t)
 		}
-	case "year":
+	case "year", "track", "disc":
 		y, err := bluge.DecodeNumericFloat64(value)
 		if err != nil {
 			v = "error"
@@ -76,6 +80,55 @@ func printMetadata(field string, value []byte, color string) {
 		if y != 0 {
 			v = fmt.Sprintf("%0.f", y)
 		}
+	case "duration":
+		d, err := bluge.DecodeNumericFloat64(value)
+		if err != nil {
+			v = "error"
+		} else {
+			v = formatDuration(int64(d * outputSampleRate))
+		}
+	case "bitrate":
+		b, err := bluge.DecodeNumericFloat64(value)
+		if err != nil {
+			v = "error"
+		} else {
+			v = fmt.Sprintf("%0.f kbps", b)
+		}
+	case "sample_rate":
+		r, err := bluge.DecodeNumericFloat64(value)
+		if err != nil {
+			v = "error"
+		} else {
+			v = fmt.Sprintf("%0.f Hz", r)
+		}
+	case "channels":
+		c, err := bluge.DecodeNumericFloat64(value)
+		if err != nil {
+			v = "error"
+		} else {
+			v = fmt.Sprintf("%0.f", c)
+		}
+	case fieldTrackGain, fieldAlbumGain:
+		g, err := bluge.DecodeNumericFloat64(value)
+		if err != nil {
+			v = "error"
+		} else {
+			v = fmt.Sprintf("%+.2f dB", g)
+		}
+	case fieldTrackPeak, fieldAlbumPeak:
+		p, err := bluge.DecodeNumericFloat64(value)
+		if err != nil {
+			v = "error"
+		} else {
+			v = fmt.Sprintf("%.6f", p)
+		}
+	case fieldLoudness, fieldAlbumLoudness:
+		l, err := bluge.DecodeNumericFloat64(value)
+		if err != nil {
+			v = "error"
+		} else {
+			v = fmt.Sprintf("%.1f LUFS", l)
+		}
 	case "metadata source":
 		v = "🌍"
 		if string(value) == "true" {
@@ -87,6 +140,6 @@ func printMetadata(field string, value []byte, color string) {
 	}
 
 	if v != "" {
-		printRow(f, v, headerColor)
+		printRow(w, f, v, headerColor)
 	}
 }
@@ -0,0 +1,35 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import "golang.org/x/sys/unix"
+
+func isTerminal(fd int) bool {
+	_, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	return err == nil
+}
+
+// makeCbreak puts the terminal in cbreak mode: key presses are read
+// immediately, without echo, and Ctrl-C is read as a regular key instead of
+// raising SIGINT. Reads return nothing after a tenth of a second without
+// key presses, so readers can stop. Output processing is left untouched.
+// The returned function restores the previous terminal state.
+func makeCbreak(fd int) (func() error, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	old := *termios
+
+	termios.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cc[unix.VMIN] = 0
+	termios.Cc[unix.VTIME] = 1
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, termios); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return unix.IoctlSetTermios(fd, ioctlWriteTermios, &old)
+	}, nil
+}
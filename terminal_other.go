@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "errors"
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeCbreak(fd int) (func() error, error) {
+	return nil, errors.New("terminal cbreak mode not supported on this platform")
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/rubiojr/rplay/internal/audioinfo"
+)
+
+type transitionMode int
+
+const (
+	// songs are fetched and played one after another
+	transitionNone transitionMode = iota
+	// the next song is prepared in advance and starts with no gap
+	transitionGapless
+	// the end of a song overlaps the beginning of the next one
+	transitionCrossfade
+)
+
+var transition = transitionNone
+var crossfadeSeconds = 0
+var fadeCurve = "equal-power"
+
+// fadeCurveFunc returns the gain of the song fading out and the song fading in
+// at x, from 0 (crossfade start) to 1 (crossfade end).
+type fadeCurveFunc func(x float64) (float64, float64)
+
+var fadeCurves = map[string]fadeCurveFunc{
+	"linear": func(x float64) (float64, float64) {
+		return 1 - x, x
+	},
+	// constant perceived loudness for uncorrelated songs
+	"equal-power": func(x float64) (float64, float64) {
+		return math.Cos(x * math.Pi / 2), math.Sin(x * math.Pi / 2)
+	},
+	// slow start and end, quick change in the middle
+	"s-curve": func(x float64) (float64, float64) {
+		in := x * x * (3 - 2*x)
+		return 1 - in, in
+	},
+}
+
+func setupTransition(gapless bool, crossfade int) error {
+	if _, ok := fadeCurves[fadeCurve]; !ok {
+		return fmt.Errorf("invalid fade curve %s", fadeCurve)
+	}
+	if crossfade < 0 {
+		return fmt.Errorf("invalid crossfade duration %d", crossfade)
+	}
+
+	switch {
+	case crossfade > 0:
+		transition = transitionCrossfade
+		crossfadeSeconds = crossfade
+	case gapless:
+		transition = transitionGapless
+	default:
+		transition = transitionNone
+	}
+	return nil
+}
+
+// crossfadeFrames returns the length of the crossfade in frames at the
+// output sample rate.
+func crossfadeFrames() int {
+	if transition != transitionCrossfade {
+		return 0
+	}
+	return crossfadeSeconds * outputSampleRate
+}
+
+// preload is a song being prepared in the background while another one
+// plays.
+type preload struct {
+	id     string
+	t      *track
+	err    error
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+func preloadSong(id string) *preload {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &preload{id: id, done: make(chan struct{}), cancel: cancel}
+	go func() {
+		p.t, p.err = prepareSong(ctx, id)
+		close(p.done)
+	}()
+	return p
+}
+
+// wait returns the prepared song, once ready.
+func (p *preload) wait(ctx context.Context) (*track, error) {
+	select {
+	case <-p.done:
+		return p.t, p.err
+	case <-ctx.Done():
+		p.discard()
+		return nil, ctx.Err()
+	}
+}
+
+// discard stops preparing the song and releases it.
+func (p *preload) discard() {
+	p.cancel()
+	go func() {
+		<-p.done
+		if p.t != nil {
+			p.t.Close()
+		}
+	}()
+}
+
+// MP3 decoders output this many samples before the first one encoded. The
+// encoder delay and padding in LAME headers don't include it.
+const mp3DecoderDelay = 529
+
+// gapHeadSize is how much of an MP3 song, after its ID3v2 tag, is read to
+// find the silence added by its encoder.
+const gapHeadSize = 4096
+
+// readEncoderGap returns the silence added by the encoder to an MP3 song,
+// if known, and the song to decode. The ID3v2 tag is skipped, as the decoder
+// would, so it isn't kept in memory. Read errors are left to the decoder.
+func readEncoderGap(r io.Reader) (audioinfo.EncoderGap, bool, io.Reader) {
+	head := make([]byte, gapHeadSize)
+	n, err := io.ReadFull(r, head[:10])
+	if size := audioinfo.TagSize(head[:n]); size > 0 {
+		_, err = io.CopyN(ioutil.Discard, r, size-10)
+		n = 0
+	}
+	if err == nil {
+		m, _ := io.ReadFull(r, head[n:])
+		n += m
+	}
+	head = head[:n]
+
+	gap, ok := audioinfo.ReadEncoderGap(head)
+	return gap, ok, io.MultiReader(bytes.NewReader(head), r)
+}
+
+// trimEncoderGap removes the silence added by the encoder from the 16 bit
+// stereo samples decoded from an MP3 song, so it joins the songs before and
+// after it without gaps.
+func trimEncoderGap(r io.Reader, gap audioinfo.EncoderGap) io.Reader {
+	// the Xing or Info frame is decoded as silence too
+	start, end := gap.Header, 0
+	if gap.Delay > 0 || gap.Padding > 0 {
+		start += gap.Delay + mp3DecoderDelay
+		end = gap.Padding - mp3DecoderDelay
+	}
+	if end < 0 {
+		end = 0
+	}
+	return newLookahead(&frameSkipper{r: r, skip: int64(start) * 4}, end)
+}
+
+// frameSkipper discards the first frames of a 16 bit stereo stream.
+type frameSkipper struct {
+	r    io.Reader
+	skip int64
+}
+
+func (s *frameSkipper) Read(p []byte) (int, error) {
+	if s.skip > 0 {
+		n, err := io.CopyN(ioutil.Discard, s.r, s.skip)
+		s.skip -= n
+		if err != nil {
+			return 0, err
+		}
+	}
+	return s.r.Read(p)
+}
+
+// lookahead delays a 16 bit stereo stream by a number of frames, so the end
+// of the stream is known before it's played. When the stream ends, the
+// frames not returned yet are available with tail.
+type lookahead struct {
+	r    io.Reader
+	size int
+	buf  []byte
+	eof  bool
+}
+
+func newLookahead(r io.Reader, frames int) *lookahead {
+	return &lookahead{r: r, size: frames * 4}
+}
+
+func (l *lookahead) Read(p []byte) (int, error) {
+	if l.size == 0 {
+		return l.r.Read(p)
+	}
+
+	want := l.size + len(p)
+	if cap(l.buf) < want {
+		buf := make([]byte, len(l.buf), want)
+		copy(buf, l.buf)
+		l.buf = buf
+	}
+	for !l.eof && len(l.buf) < want {
+		n, err := l.r.Read(l.buf[len(l.buf):want])
+		l.buf = l.buf[:len(l.buf)+n]
+		if err == io.EOF {
+			l.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	avail := (len(l.buf) - l.size) &^ 3
+	if avail <= 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, l.buf[:avail])
+	l.buf = l.buf[:copy(l.buf, l.buf[n:])]
+
+	return n, nil
+}
+
+// tail returns the frames left when the stream ended.
+func (l *lookahead) tail() []byte {
+	if !l.eof || len(l.buf) == 0 {
+		return nil
+	}
+	return l.buf
+}
+
+// fadeMixer mixes the end of the previous song into the beginning of the
+// stream read from r, fading one out and the other in.
+type fadeMixer struct {
+	r     io.Reader
+	tail  []byte
+	total int
+	pos   int
+	curve fadeCurveFunc
+}
+
+func newFadeMixer(tail []byte, r io.Reader, curve fadeCurveFunc) io.Reader {
+	if len(tail) < 4 {
+		return r
+	}
+	return &fadeMixer{r: r, tail: tail, total: len(tail) / 4, curve: curve}
+}
+
+func (m *fadeMixer) Read(p []byte) (int, error) {
+	if m.pos >= m.total {
+		return m.r.Read(p)
+	}
+
+	n, err := m.r.Read(p)
+	if err == io.EOF && n == 0 {
+		// the new song is shorter than the fade, play the rest of the
+		// previous one fading out
+		n = (m.total - m.pos) * 4
+		if n > len(p)&^3 {
+			n = len(p) &^ 3
+		}
+		n = copy(p, make([]byte, n))
+		err = nil
+	}
+
+	for i := 0; i+3 < n && m.pos < m.total; i += 4 {
+		out, in := m.curve(float64(m.pos) / float64(m.total))
+		for ch := 0; ch < 2; ch++ {
+			o := i + 2*ch
+			t := 4*m.pos + 2*ch
+			prev := float64(int16(uint16(m.tail[t]) | uint16(m.tail[t+1])<<8))
+			cur := float64(int16(uint16(p[o]) | uint16(p[o+1])<<8))
+			v := clipSample(prev*out + cur*in)
+			p[o] = uint8(v)
+			p[o+1] = uint8(v >> 8)
+		}
+		m.pos++
+	}
+
+	return n, err
+}
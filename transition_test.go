@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/rubiojr/rplay/internal/audioinfo"
+)
+
+func constantFrames(frames int, v int16) []byte {
+	buf := []byte{}
+	for i := 0; i < frames*2; i++ {
+		buf = append(buf, uint8(v), uint8(v>>8))
+	}
+	return buf
+}
+
+func TestLookahead(t *testing.T) {
+	song := sineFrames(44100, 5000, 440, 10000)
+	la := newLookahead(iotest.HalfReader(bytes.NewReader(song)), 1000)
+
+	played, err := ioutil.ReadAll(la)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(played) != 4000*4 {
+		t.Errorf("expected 4000 frames played, got %d", len(played)/4)
+	}
+
+	tail := la.tail()
+	if !bytes.Equal(append(played, tail...), song) {
+		t.Error("played frames and tail should add up to the whole song")
+	}
+}
+
+func TestEncoderGap(t *testing.T) {
+	// ID3v2 tag and a LAME Info frame, MPEG 1 layer III, 128 kbps, 44.1 kHz
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 1, 0}, make([]byte, 128)...)
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	copy(frame[36:], "Info")
+	binary.BigEndian.PutUint32(frame[40:], 1)
+	binary.BigEndian.PutUint32(frame[44:], 100)
+	copy(frame[48:], "LAME3.100")
+	// 576 samples of delay and 1000 of padding
+	copy(frame[48+21:], []byte{576 >> 4, 576&0xf<<4 | 1000>>8, 1000 & 0xff})
+
+	gap, ok, song := readEncoderGap(iotest.HalfReader(bytes.NewReader(append(tag, frame...))))
+	if want := (audioinfo.EncoderGap{Header: 1152, Delay: 576, Padding: 1000}); !ok || gap != want {
+		t.Errorf("expected encoder gap %+v, got %+v", want, gap)
+	}
+	if got, _ := ioutil.ReadAll(song); !bytes.Equal(got, frame) {
+		t.Error("the song should be read after its tag")
+	}
+
+	// the frame number is the sample value
+	pcm := []byte{}
+	for i := 0; i < 10000; i++ {
+		pcm = append(pcm, constantFrames(1, int16(i))...)
+	}
+	played, err := ioutil.ReadAll(trimEncoderGap(iotest.HalfReader(bytes.NewReader(pcm)), gap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end := 1152+576+529, 10000-(1000-529)
+	if !bytes.Equal(played, pcm[start*4:end*4]) {
+		t.Errorf("expected frames %d to %d, got %d frames", start, end, len(played)/4)
+	}
+}
+
+func TestLookaheadShortSong(t *testing.T) {
+	song := sineFrames(44100, 500, 440, 10000)
+	la := newLookahead(bytes.NewReader(song), 1000)
+
+	played, _ := ioutil.ReadAll(la)
+	if len(played) != 0 {
+		t.Errorf("expected nothing played, got %d frames", len(played)/4)
+	}
+	if !bytes.Equal(la.tail(), song) {
+		t.Error("the whole song should be in the tail")
+	}
+}
+
+func TestFadeMixer(t *testing.T) {
+	tail := constantFrames(100, 1000)
+	next := constantFrames(300, 2000)
+
+	out, err := ioutil.ReadAll(newFadeMixer(tail, bytes.NewReader(next), fadeCurves["linear"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(next) {
+		t.Fatalf("expected %d frames, got %d", len(next)/4, len(out)/4)
+	}
+
+	sample := func(frame int) int16 {
+		return int16(uint16(out[4*frame]) | uint16(out[4*frame+1])<<8)
+	}
+	if sample(0) != 1000 {
+		t.Errorf("fade should start with the previous song, got %d", sample(0))
+	}
+	if sample(50) != 1500 {
+		t.Errorf("expected both songs mixed halfway through the fade, got %d", sample(50))
+	}
+	if sample(100) != 2000 || sample(299) != 2000 {
+		t.Errorf("expected the next song after the fade, got %d", sample(100))
+	}
+}
+
+func TestFadeMixerShortSong(t *testing.T) {
+	tail := constantFrames(100, 1000)
+	next := constantFrames(10, 0)
+
+	out, err := ioutil.ReadAll(newFadeMixer(tail, bytes.NewReader(next), fadeCurves["linear"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(tail) {
+		t.Errorf("expected the whole fade to be played, got %d frames", len(out)/4)
+	}
+}